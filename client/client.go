@@ -0,0 +1,335 @@
+// Package client drives a running irbankmock server from tests. It wraps the
+// management api and the merchant api of each bank with typed methods.
+//
+// The request and response types mirror the json of the server api, pin the client to
+// the release of the server it calls. They are defined here rather than shared with
+// the server, so tests using the client don't link the server along with its database
+// drivers.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/version"
+)
+
+// Version is the release of the server this client was built from.
+var Version = version.ServerVersion
+
+const versionPath = "/version"
+const managementPrefix = "/management"
+
+// selects the namespace of a request
+const namespaceHeader = "X-IRBankMock-Namespace"
+
+// the body of the error responses of the server
+type errorResponse struct {
+	Error   string `json:"error"`
+	ErrorId string `json:"errorId"`
+}
+
+type createNamespaceRequest struct {
+	Name string `json:"name"`
+}
+
+type namespaceResponse struct {
+	Name string `json:"name"`
+}
+
+type resetRequest struct {
+	KeepTerminals bool `json:"keepTerminals"`
+}
+
+type clockRequest struct {
+	// empty for the global clock
+	Namespace string     `json:"namespace"`
+	Time      *time.Time `json:"time"`
+	Duration  string     `json:"duration"`
+}
+
+type VersionResponse struct {
+	Version   string   `json:"version"`
+	GoVersion string   `json:"goVersion"`
+	Banks     []string `json:"banks"`
+	// latest applied migration, zero if the database is unreachable
+	SchemaVersion int64 `json:"schemaVersion"`
+}
+
+// Error is returned when the server responds with a non-2xx status.
+type Error struct {
+	StatusCode int
+	Message    string
+	// set for unexpected server errors, it's logged along with the error
+	ErrorId string
+}
+
+func (e *Error) Error() string {
+	if e.ErrorId != "" {
+		return fmt.Sprintf("irbankmock: %d %s (error id %s)", e.StatusCode, e.Message, e.ErrorId)
+	}
+	return fmt.Sprintf("irbankmock: %d %s", e.StatusCode, e.Message)
+}
+
+// Client calls an irbankmock server. The zero value isn't usable, create it with New.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	namespace  string
+	username   string
+	password   string
+	token      string
+}
+
+// New returns a client of the server at baseURL, e.g. http://localhost:3000.
+func New(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+}
+
+func (c *Client) clone() *Client {
+	clone := *c
+	return &clone
+}
+
+// WithHTTPClient returns a copy of the client that sends its requests with hc.
+func (c *Client) WithHTTPClient(hc *http.Client) *Client {
+	clone := c.clone()
+	clone.httpClient = hc
+	return clone
+}
+
+// WithNamespace returns a copy of the client whose bank requests select the namespace,
+// so parallel tests don't see each other's terminals.
+func (c *Client) WithNamespace(name string) *Client {
+	clone := c.clone()
+	clone.namespace = name
+	return clone
+}
+
+// WithAdminAuth returns a copy of the client that authenticates the management
+// requests, needed when the server sets admin.username.
+func (c *Client) WithAdminAuth(username string, password string) *Client {
+	clone := c.clone()
+	clone.username = username
+	clone.password = password
+	clone.token = ""
+	return clone
+}
+
+// WithAdminToken returns a copy of the client that authenticates the management
+// requests with the bearer token, needed when the server sets admin.token.
+func (c *Client) WithAdminToken(token string) *Client {
+	clone := c.clone()
+	clone.token = token
+	clone.username = ""
+	clone.password = ""
+	return clone
+}
+
+// BaseURL returns the url of the server without a trailing slash.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// Namespace returns the namespace selected by the client, empty for the default one.
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, body any) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.namespace != "" {
+		req.Header.Set(namespaceHeader, c.namespace)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return req, nil
+}
+
+// send sends a json request and returns the status and the body of the response.
+func (c *Client) send(ctx context.Context, method string, path string, body any) (int, []byte, error) {
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, content, nil
+}
+
+// do sends a json request and decodes the response into out. Non-2xx responses are
+// returned as *Error.
+func (c *Client) do(ctx context.Context, method string, path string, body any, out any) error {
+	status, content, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status > 299 {
+		return newError(status, content)
+	}
+	if out == nil {
+		return nil
+	}
+	return decode(method, path, content, out)
+}
+
+func decode(method string, path string, content []byte, out any) error {
+	err := json.Unmarshal(content, out)
+	if err != nil {
+		return fmt.Errorf("irbankmock: decoding the response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+func newError(status int, content []byte) *Error {
+	var body errorResponse
+	if json.Unmarshal(content, &body) == nil && body.Error != "" {
+		return &Error{StatusCode: status, Message: body.Error, ErrorId: body.ErrorId}
+	}
+	message := strings.TrimSpace(string(content))
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return &Error{StatusCode: status, Message: message}
+}
+
+// ServerVersion returns the build information of the server.
+func (c *Client) ServerVersion(ctx context.Context) (*VersionResponse, error) {
+	resp := new(VersionResponse)
+	err := c.do(ctx, http.MethodGet, versionPath, nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CreateNamespace creates a namespace and returns a client that selects it.
+func (c *Client) CreateNamespace(ctx context.Context, name string) (*Client, error) {
+	resp := new(namespaceResponse)
+	err := c.do(ctx, http.MethodPost, managementPrefix+"/namespaces", &createNamespaceRequest{Name: name}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return c.WithNamespace(resp.Name), nil
+}
+
+// DestroyNamespace removes the namespace along with its terminals and transactions.
+func (c *Client) DestroyNamespace(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, managementPrefix+"/namespaces/"+name, nil, nil)
+}
+
+// Reset removes the transactions of all namespaces, and the terminals and namespaces
+// too unless keepTerminals is set.
+func (c *Client) Reset(ctx context.Context, keepTerminals bool) error {
+	return c.do(ctx, http.MethodPost, managementPrefix+"/db/reset", &resetRequest{KeepTerminals: keepTerminals}, nil)
+}
+
+type ClockResponse struct {
+	// empty for the global clock
+	Namespace string    `json:"namespace"`
+	Now       time.Time `json:"now"`
+	Frozen    bool      `json:"frozen"`
+	// how far the clock is ahead of the real time, negative if it's behind
+	Offset string `json:"offset"`
+	// the clock the scope follows: its own, the global one or the real time
+	Source string `json:"source"`
+}
+
+// Clock returns the time the banks see in the namespace of the client, or the global
+// clock if it selects none.
+func (c *Client) Clock(ctx context.Context) (*ClockResponse, error) {
+	path := managementPrefix + "/clock"
+	if c.namespace != "" {
+		path += "?namespace=" + url.QueryEscape(c.namespace)
+	}
+	resp := new(ClockResponse)
+	err := c.do(ctx, http.MethodGet, path, nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) changeClock(ctx context.Context, action string, req *clockRequest) (*ClockResponse, error) {
+	req.Namespace = c.namespace
+	resp := new(ClockResponse)
+	err := c.do(ctx, http.MethodPost, managementPrefix+"/clock/"+action, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// FreezeClock stops the clock of the namespace of the client at its current time.
+func (c *Client) FreezeClock(ctx context.Context) (*ClockResponse, error) {
+	return c.changeClock(ctx, "freeze", &clockRequest{})
+}
+
+// FreezeClockAt stops the clock of the namespace of the client at t.
+func (c *Client) FreezeClockAt(ctx context.Context, t time.Time) (*ClockResponse, error) {
+	return c.changeClock(ctx, "freeze", &clockRequest{Time: &t})
+}
+
+func (c *Client) ResumeClock(ctx context.Context) (*ClockResponse, error) {
+	return c.changeClock(ctx, "resume", &clockRequest{})
+}
+
+// AdvanceClock moves the clock of the namespace of the client forward, expiring the
+// tokens that become due.
+func (c *Client) AdvanceClock(ctx context.Context, d time.Duration) (*ClockResponse, error) {
+	return c.changeClock(ctx, "advance", &clockRequest{Duration: d.String()})
+}
+
+func (c *Client) SetClock(ctx context.Context, t time.Time) (*ClockResponse, error) {
+	return c.changeClock(ctx, "set", &clockRequest{Time: &t})
+}
+
+// ResetClock makes the namespace of the client follow the global clock again, or the
+// global clock follow the real time.
+func (c *Client) ResetClock(ctx context.Context) (*ClockResponse, error) {
+	path := managementPrefix + "/clock"
+	if c.namespace != "" {
+		path += "?namespace=" + url.QueryEscape(c.namespace)
+	}
+	resp := new(ClockResponse)
+	err := c.do(ctx, http.MethodDelete, path, nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
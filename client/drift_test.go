@@ -0,0 +1,156 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/banks/registry"
+	"github.com/abramad-labs/irbankmock/internal/banks/sep"
+	"github.com/abramad-labs/irbankmock/internal/health"
+	"github.com/abramad-labs/irbankmock/internal/management"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	fibererror "github.com/abramad-labs/irbankmock/internal/usererror/fiber"
+)
+
+// the types of the client are copies of the ones of the server, these tests notice
+// when they drift apart
+
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonShape describes how t is encoded, ignoring the names of the types and whether
+// the values are optional.
+func jsonShape(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == jsonNumberType:
+		return "number"
+	case t == timeType:
+		return "time"
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := jsonFields(t)
+		names := make([]string, 0, len(fields))
+		for name, shape := range fields {
+			names = append(names, name+":"+shape)
+		}
+		slices.Sort(names)
+		return "{" + strings.Join(names, ",") + "}"
+	case reflect.Slice:
+		return "[]" + jsonShape(t.Elem())
+	}
+	return t.Kind().String()
+}
+
+// jsonFields returns the shapes of the json fields of the struct, by their names
+func jsonFields(t reflect.Type) map[string]string {
+	fields := map[string]string{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == "-" || !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for name, shape := range jsonFields(f.Type) {
+				fields[name] = shape
+			}
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		fields[tag] = jsonShape(f.Type)
+	}
+	return fields
+}
+
+// compareFields reports the fields of the client type missing in the server type or
+// encoded differently. Requests must send every field the server reads, responses may
+// leave out fields the client doesn't need.
+func compareFields(t *testing.T, clientType any, serverType any, request bool) {
+	t.Helper()
+	ct, st := reflect.TypeOf(clientType), reflect.TypeOf(serverType)
+	client, server := jsonFields(ct), jsonFields(st)
+	for name, shape := range client {
+		serverShape, ok := server[name]
+		if !ok {
+			t.Errorf("%s.%s isn't a field of %s", ct.Name(), name, st)
+		} else if shape != serverShape {
+			t.Errorf("%s.%s is %s, %s has %s", ct.Name(), name, shape, st, serverShape)
+		}
+	}
+	if !request {
+		return
+	}
+	for name := range server {
+		if _, ok := client[name]; !ok {
+			t.Errorf("%s has no field %s of %s", ct.Name(), name, st)
+		}
+	}
+}
+
+func TestRequestsMatchServer(t *testing.T) {
+	for _, pair := range []struct{ client, server any }{
+		{createNamespaceRequest{}, management.CreateNamespaceRequest{}},
+		{resetRequest{}, management.ResetDbRequest{}},
+		{clockRequest{}, management.ClockRequest{}},
+		{SamanTokenRequest{}, sep.BankSepTransactionRequest{}},
+		{SamanPreloadRequest{}, sep.BankSepPreloadIdentifiersRequest{}},
+		{samanCreateTerminalRequest{}, sep.BankSepCreateTerminalRequest{}},
+		{samanSetSeedRequest{}, sep.BankSepSetIdentifierSeedRequest{}},
+		{samanSubmitRequest{}, sep.BankSepSubmitTokenRequest{}},
+		{samanCancelOrFailRequest{}, sep.BankSepCancelOrFailTokenRequest{}},
+		{samanReceiptRequest{}, sep.BankSepGetReceiptRequest{}},
+		{samanVerificationRequest{}, sep.BankSepVerificationRequest{}},
+		{samanVerificationRequest{}, sep.BankSepReverseRequest{}},
+	} {
+		compareFields(t, pair.client, pair.server, true)
+	}
+}
+
+func TestResponsesMatchServer(t *testing.T) {
+	for _, pair := range []struct{ client, server any }{
+		{errorResponse{}, fibererror.NonUserErrorResponse{}},
+		{VersionResponse{}, health.VersionResponse{}},
+		{namespaceResponse{}, management.NamespaceResponse{}},
+		{ClockResponse{}, management.ClockResponse{}},
+		{SamanTerminal{}, sep.BankSepTerminalResponse{}},
+		{SamanTerminals{}, sep.BankSepGetTerminalsResponse{}},
+		{SamanTokenResponse{}, sep.BankSepTransactionResponse{}},
+		{SamanPayment{}, sep.BankSepTokenFinalizeResponse{}},
+		{SamanReceipt{}, sep.BankSepGetReceiptResponse{}},
+		{SamanVerification{}, sep.BankSepVerificationResponse{}},
+		{SamanReverse{}, sep.BankSepReverseResponse{}},
+		{SamanIdentifiers{}, sep.BankSepIdentifiersResponse{}},
+	} {
+		compareFields(t, pair.client, pair.server, false)
+	}
+}
+
+func TestPathsMatchServer(t *testing.T) {
+	for _, pair := range [][2]string{
+		{versionPath, health.VersionPath},
+		{managementPrefix, management.RouterPrefix},
+		{namespaceHeader, namespace.HeaderName},
+		{banksPrefix, registry.RegistryBanksPrefix},
+		{namespacePrefix, registry.RegistryNamespacePrefix},
+		{samanName, sep.BankSepName},
+		{samanPathGateway, sep.BankSepPathOnlinePaymentGateway},
+		{samanPathSendToken, sep.BankSepPathOnlinePaymenyTokenRedirect},
+		{samanPathReceipt, sep.BankSepPathGetReceipt},
+		{samanPathVerify, sep.BankSepPathVerifyTransaction},
+		{samanPathReverse, sep.BankSepPathReverseTransaction},
+	} {
+		if pair[0] != pair[1] {
+			t.Errorf("the client uses %q, the server %q", pair[0], pair[1])
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const banksPrefix = "/banks/"
+const namespacePrefix = "/ns/"
+
+const samanName = "saman"
+const samanPathGateway = "/OnlinePG/OnlinePG"
+const samanPathSendToken = "/OnlinePG/SendToken"
+const samanPathReceipt = "/verifyTxnRandomSessionkey/api/v2/ipg/payment/receipt"
+const samanPathVerify = "/verifyTxnRandomSessionkey/ipg/VerifyTransaction"
+const samanPathReverse = "/verifyTxnRandomSessionkey/ipg/ReverseTransaction"
+
+type SamanTerminal struct {
+	ID        uint64 `json:"id"`
+	Name      string `json:"name"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Namespace string `json:"namespace"`
+}
+
+// SamanEndpoints are the urls merchants call.
+type SamanEndpoints struct {
+	PaymentGateway     string `json:"paymentGateway"`
+	PaymentToken       string `json:"paymentToken"`
+	Receipt            string `json:"receipt"`
+	VerifyTransaction  string `json:"verifyTransaction"`
+	ReverseTransaction string `json:"reverseTransaction"`
+}
+
+type SamanTerminals struct {
+	Terminals []*SamanTerminal `json:"terminals"`
+	Endpoints *SamanEndpoints  `json:"endpoints"`
+}
+
+// SamanTokenRequest is the token request of a merchant, see NewTokenRequest for the
+// required fields.
+type SamanTokenRequest struct {
+	Action     string      `json:"action"`
+	TerminalId json.Number `json:"terminalId"`
+	// in IRR
+	Amount  int64   `json:"amount"`
+	ResNum  string  `json:"resNum"`
+	ResNum1 *string `json:"resNum1,omitempty"`
+	ResNum2 *string `json:"resNum2,omitempty"`
+	ResNum3 *string `json:"resNum3,omitempty"`
+	ResNum4 *string `json:"resNum4,omitempty"`
+
+	RedirectURL     string  `json:"redirectURL"`
+	Wage            *int64  `json:"wage,omitempty"`
+	AffectiveAmount *int64  `json:"affectiveAmount,omitempty"`
+	CellNumber      *string `json:"cellNumber,omitempty"`
+	// 20 to 3600, zero for the default
+	TokenExpiryInMin int `json:"tokenExpiryInMin,omitempty"`
+	// md5 hashes of the only cards allowed to pay, separated by one of |;,
+	HashedCardNumber    *string `json:"hashedCardNumber,omitempty"`
+	TxnRandomSessionKey *int64  `json:"txnRandomSessionKey,omitempty"`
+}
+
+type SamanTokenResponse struct {
+	// 1 if the token is issued, -1 otherwise
+	Status    int    `json:"status"`
+	Token     string `json:"token,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	ErrorDesc string `json:"errorDesc,omitempty"`
+}
+
+// SamanCallbackData is the form posted to the redirect url of the merchant.
+type SamanCallbackData struct {
+	MID              string `json:"MID"`
+	TerminalId       string `json:"terminalId"`
+	State            string `json:"state"`
+	Status           string `json:"status"`
+	Rrn              string `json:"rrn"`
+	RefNum           string `json:"refNum"`
+	ResNum           string `json:"resNum"`
+	TraceNo          string `json:"traceNo"`
+	Amount           string `json:"amount"`
+	AffectiveAmount  string `json:"affectiveAmount"`
+	Wage             string `json:"wage"`
+	SecurePan        string `json:"securePan"`
+	HashedCardNumber string `json:"hashedCardNumber"`
+	Token            string `json:"token"`
+}
+
+type SamanPayment struct {
+	RedirectURL  string             `json:"redirectURL"`
+	CallbackData *SamanCallbackData `json:"callbackData"`
+}
+
+type SamanReceiptData struct {
+	State            string
+	Status           int
+	TerminalId       int64
+	Token            string
+	RefNum           string
+	ResNum           string
+	TraceNo          int64
+	Amount           int64
+	AffectiveAmount  int64
+	Rrn              int64
+	HashedCardNumber string
+}
+
+type SamanValidationError struct {
+	FieldName     string
+	ErrorMessages []string
+}
+
+type SamanReceipt struct {
+	HasError         bool
+	Data             SamanReceiptData
+	ValidationErrors []*SamanValidationError
+	ErrorCode        int32
+	ErrorMessage     string
+}
+
+type SamanTransactionDetail struct {
+	RRN             string
+	RefNum          string
+	MaskedPan       string
+	HashedPan       string
+	TerminalNumber  int32
+	OrginalAmount   int64
+	AffectiveAmount int64
+	StraceDate      time.Time
+	StraceNo        string
+}
+
+type SamanVerification struct {
+	TransactionDetail *SamanTransactionDetail
+	ResultCode        int32
+	ResultDescription string
+	Success           bool
+}
+
+type SamanReverse SamanVerification
+
+type SamanIdentifiers struct {
+	TerminalId uint64 `json:"terminalId"`
+	// seed of the terminal, empty if it follows the seed of the server
+	Seed string `json:"seed"`
+	// whether the identifiers are generated from a seed rather than randomly
+	Seeded   bool                      `json:"seeded"`
+	Tokens   []string                  `json:"tokens"`
+	Payments []SamanPaymentIdentifiers `json:"payments"`
+}
+
+type SamanPaymentIdentifiers struct {
+	RefNum  string `json:"refNum"`
+	Rrn     int64  `json:"rrn"`
+	TraceNo int64  `json:"traceNo"`
+}
+
+type SamanPreloadRequest struct {
+	// number of tokens and payment identifiers to generate and preload
+	Count int `json:"count"`
+	// tokens to hand out as they are, before the generated ones
+	Tokens []string `json:"tokens"`
+	// payment identifiers to hand out as they are, before the generated ones
+	Payments []SamanPaymentIdentifiers `json:"payments"`
+}
+
+type samanCreateTerminalRequest struct {
+	Name string `json:"name"`
+}
+
+type samanSetSeedRequest struct {
+	Seed string `json:"seed"`
+}
+
+type samanSubmitRequest struct {
+	Token        string `json:"token"`
+	CardNumber   string `json:"cardNumber"`
+	Cvv          int32  `json:"cvv"`
+	ExpiryMonth  int32  `json:"expiryMonth"`
+	ExpiryYear   int32  `json:"expiryYear"`
+	CardPassword string `json:"cardPassword"`
+	Captcha      string `json:"captcha"`
+}
+
+type samanCancelOrFailRequest struct {
+	Token string `json:"token"`
+}
+
+type samanReceiptRequest struct {
+	TerminalNumber      json.Number
+	TxnRandomSessionKey *int64
+	Rrn                 *int64
+	Token               *string
+	RefNum              *string
+}
+
+type samanVerificationRequest struct {
+	RefNum         string
+	TerminalNumber json.Number
+}
+
+// SamanTokenError is returned when the gateway refuses to issue a token, e.g. for an
+// unknown terminal or an invalid redirect url.
+type SamanTokenError struct {
+	ErrorCode string
+	ErrorDesc string
+}
+
+func (e *SamanTokenError) Error() string {
+	return fmt.Sprintf("saman: token request failed with error code %s: %s", e.ErrorCode, e.ErrorDesc)
+}
+
+// Card is used to pay a token. The mock accepts any card, only the number shows up
+// in the receipts and callbacks.
+type Card struct {
+	Number      string
+	Cvv2        int32
+	ExpiryMonth int32
+	ExpiryYear  int32
+	Password    string
+}
+
+// TestCard is a made up card for tests that don't care about the card.
+var TestCard = Card{
+	Number:      "6037990000000006",
+	Cvv2:        123,
+	ExpiryMonth: 12,
+	ExpiryYear:  9,
+	Password:    "12345",
+}
+
+// Outcome is how the customer finishes the payment page.
+type Outcome string
+
+const (
+	OutcomePaid     Outcome = "submit"
+	OutcomeFailed   Outcome = "fail"
+	OutcomeCanceled Outcome = "cancel"
+)
+
+// SamanClient calls the routes of the Saman (SEP) bank.
+type SamanClient struct {
+	c *Client
+}
+
+func (c *Client) Saman() *SamanClient {
+	return &SamanClient{c: c}
+}
+
+// Prefix returns the path of the bank routes, under the namespace prefix if the client
+// selects a namespace.
+func (s *SamanClient) Prefix() string {
+	prefix := banksPrefix + samanName
+	if s.c.namespace != "" {
+		prefix = namespacePrefix + s.c.namespace + prefix
+	}
+	return prefix
+}
+
+// URL returns the absolute url of a route of the bank, e.g. for the merchant
+// configuration of the service under test.
+func (s *SamanClient) URL(path string) string {
+	return s.c.baseURL + s.Prefix() + path
+}
+
+// PaymentPageURL returns the url the customer is redirected to for paying the token.
+// The page is served outside the namespace prefix and told the namespace of the token
+// by a query parameter.
+func (s *SamanClient) PaymentPageURL(token string) string {
+	u := s.c.baseURL + banksPrefix + samanName + samanPathSendToken + "?token=" + url.QueryEscape(token)
+	if s.c.namespace != "" {
+		u += "&namespace=" + url.QueryEscape(s.c.namespace)
+	}
+	return u
+}
+
+func (s *SamanClient) CreateTerminal(ctx context.Context, name string) (*SamanTerminal, error) {
+	resp := new(SamanTerminal)
+	err := s.c.do(ctx, http.MethodPost, s.Prefix()+"/management/terminal",
+		&samanCreateTerminalRequest{Name: name}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Terminals lists the terminals of the namespace along with the endpoints merchants
+// should call.
+func (s *SamanClient) Terminals(ctx context.Context) (*SamanTerminals, error) {
+	resp := new(SamanTerminals)
+	err := s.c.do(ctx, http.MethodGet, s.Prefix()+"/management/terminal", nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *SamanClient) identifiersPath(terminalId uint64) string {
+	return s.Prefix() + "/management/terminal/" + strconv.FormatUint(terminalId, 10) + "/identifiers"
+}
+
+// Identifiers returns the seed of the terminal and its preloaded identifiers.
+func (s *SamanClient) Identifiers(ctx context.Context, terminalId uint64) (*SamanIdentifiers, error) {
+	resp := new(SamanIdentifiers)
+	err := s.c.do(ctx, http.MethodGet, s.identifiersPath(terminalId), nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SetIdentifierSeed makes the tokens, rrns, trace numbers and reference numbers of the
+// terminal deterministic, the same seed yields the same identifiers in the same order.
+// An empty seed follows the seed of the server.
+func (s *SamanClient) SetIdentifierSeed(ctx context.Context, terminalId uint64, seed string) (*SamanIdentifiers, error) {
+	resp := new(SamanIdentifiers)
+	err := s.c.do(ctx, http.MethodPut, s.identifiersPath(terminalId),
+		&samanSetSeedRequest{Seed: seed}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// PreloadIdentifiers queues the identifiers the next tokens and payments of the
+// terminal get, set Count to learn the generated ones in advance.
+func (s *SamanClient) PreloadIdentifiers(ctx context.Context, terminalId uint64, req *SamanPreloadRequest) (*SamanIdentifiers, error) {
+	resp := new(SamanIdentifiers)
+	err := s.c.do(ctx, http.MethodPost, s.identifiersPath(terminalId), req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RequestToken asks the gateway for a payment token like a merchant does. Action
+// defaults to token. Rejected requests are returned as *SamanTokenError.
+func (s *SamanClient) RequestToken(ctx context.Context, req *SamanTokenRequest) (string, error) {
+	body := *req
+	if body.Action == "" {
+		body.Action = "token"
+	}
+	path := s.Prefix() + samanPathGateway
+	status, content, err := s.c.send(ctx, http.MethodPost, path, &body)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK && status != http.StatusBadRequest {
+		return "", newError(status, content)
+	}
+	resp := new(SamanTokenResponse)
+	err = decode(http.MethodPost, path, content, resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.Status != 1 {
+		return "", &SamanTokenError{ErrorCode: resp.ErrorCode, ErrorDesc: resp.ErrorDesc}
+	}
+	return resp.Token, nil
+}
+
+// NewTokenRequest returns a token request of the terminal with the required fields set.
+func NewTokenRequest(terminalId uint64, amount int64, resNum string, redirectURL string) *SamanTokenRequest {
+	return &SamanTokenRequest{
+		Action:      "token",
+		TerminalId:  json.Number(strconv.FormatUint(terminalId, 10)),
+		Amount:      amount,
+		ResNum:      resNum,
+		RedirectURL: redirectURL,
+	}
+}
+
+// Pay finishes the payment page of the token as the customer would. The card is only
+// used by OutcomePaid.
+func (s *SamanClient) Pay(ctx context.Context, token string, card Card, outcome Outcome) (*SamanPayment, error) {
+	var body any
+	switch outcome {
+	case OutcomePaid:
+		body = &samanSubmitRequest{
+			Token:        token,
+			CardNumber:   card.Number,
+			Cvv:          card.Cvv2,
+			ExpiryMonth:  card.ExpiryMonth,
+			ExpiryYear:   card.ExpiryYear,
+			CardPassword: card.Password,
+		}
+	case OutcomeFailed, OutcomeCanceled:
+		body = &samanCancelOrFailRequest{Token: token}
+	default:
+		return nil, fmt.Errorf("saman: unknown outcome %q", outcome)
+	}
+	resp := new(SamanPayment)
+	err := s.c.do(ctx, http.MethodPost, s.Prefix()+"/management/token/"+string(outcome), body, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// FollowCallback posts the callback form to the redirect url of the merchant, like the
+// payment page does once the customer finishes it. The caller must close the body of
+// the response.
+func (s *SamanClient) FollowCallback(ctx context.Context, payment *SamanPayment) (*http.Response, error) {
+	cb := payment.CallbackData
+	if cb == nil {
+		return nil, errors.New("saman: the payment has no callback data")
+	}
+	form := url.Values{}
+	form.Set("MID", cb.MID)
+	form.Set("TerminalId", cb.TerminalId)
+	form.Set("AffectiveAmount", cb.AffectiveAmount)
+	// the typo of the older versions of the document is kept by the gateway
+	form.Set("OrginalAmount", cb.Amount)
+	form.Set("Amount", cb.Amount)
+	form.Set("HashedCardNumber", cb.HashedCardNumber)
+	form.Set("RefNum", cb.RefNum)
+	form.Set("ResNum", cb.ResNum)
+	form.Set("RRN", cb.Rrn)
+	form.Set("SecurePan", cb.SecurePan)
+	form.Set("State", cb.State)
+	form.Set("Status", cb.Status)
+	form.Set("Token", cb.Token)
+	form.Set("TraceNo", cb.TraceNo)
+	form.Set("Wage", cb.Wage)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, payment.RedirectURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.c.httpClient.Do(req)
+}
+
+// PayAndFollow pays the token and delivers the callback to the merchant.
+func (s *SamanClient) PayAndFollow(ctx context.Context, token string, card Card, outcome Outcome) (*SamanPayment, *http.Response, error) {
+	payment, err := s.Pay(ctx, token, card, outcome)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := s.FollowCallback(ctx, payment)
+	if err != nil {
+		return payment, nil, err
+	}
+	return payment, resp, nil
+}
+
+// GetReceipt returns the receipt of a paid transaction. Failures are reported by
+// HasError and ErrorCode of the receipt, like the real gateway does.
+func (s *SamanClient) GetReceipt(ctx context.Context, terminalId uint64, refNum string) (*SamanReceipt, error) {
+	return s.getReceipt(ctx, &samanReceiptRequest{
+		TerminalNumber: json.Number(strconv.FormatUint(terminalId, 10)),
+		RefNum:         &refNum,
+	})
+}
+
+func (s *SamanClient) GetReceiptByToken(ctx context.Context, terminalId uint64, token string) (*SamanReceipt, error) {
+	return s.getReceipt(ctx, &samanReceiptRequest{
+		TerminalNumber: json.Number(strconv.FormatUint(terminalId, 10)),
+		Token:          &token,
+	})
+}
+
+func (s *SamanClient) getReceipt(ctx context.Context, req *samanReceiptRequest) (*SamanReceipt, error) {
+	resp := new(SamanReceipt)
+	err := s.c.do(ctx, http.MethodPost, s.Prefix()+samanPathReceipt, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Verify verifies a paid transaction. Check Success and ResultCode of the response,
+// the error is only set when the request itself fails.
+func (s *SamanClient) Verify(ctx context.Context, terminalId uint64, refNum string) (*SamanVerification, error) {
+	resp := new(SamanVerification)
+	err := s.c.do(ctx, http.MethodPost, s.Prefix()+samanPathVerify, &samanVerificationRequest{
+		RefNum:         refNum,
+		TerminalNumber: json.Number(strconv.FormatUint(terminalId, 10)),
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Reverse reverses a paid transaction, the response is checked like the one of Verify.
+func (s *SamanClient) Reverse(ctx context.Context, terminalId uint64, refNum string) (*SamanReverse, error) {
+	resp := new(SamanReverse)
+	err := s.c.do(ctx, http.MethodPost, s.Prefix()+samanPathReverse, &samanVerificationRequest{
+		RefNum:         refNum,
+		TerminalNumber: json.Number(strconv.FormatUint(terminalId, 10)),
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
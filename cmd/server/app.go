@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/eventbus"
+	"github.com/abramad-labs/irbankmock/internal/scheduler"
+	"github.com/abramad-labs/irbankmock/internal/server"
+	"github.com/abramad-labs/irbankmock/internal/tlscert"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// serve runs the http servers and the scheduler until ctx is done, then drains them
+// within the shutdown timeout.
+func serve(ctx context.Context, db *gorm.DB) error {
+	err := scheduler.Start(db)
+	if err != nil {
+		return err
+	}
+
+	app := server.NewApp(db, server.Options{})
+	PrintAllRoutes(app)
+
+	errCh := make(chan error, 2)
+	if addr := conf.GetTLSListenAddress(); addr != "" {
+		tlsConfig, err := tlscert.Config()
+		if err != nil {
+			return err
+		}
+		ln, err := tls.Listen("tcp", addr, tlsConfig)
+		if err != nil {
+			return err
+		}
+		go func() {
+			errCh <- app.Listener(ln)
+		}()
+	}
+	if addr := conf.GetListenAddress(); addr != "" {
+		go func() {
+			errCh <- app.Listen(addr)
+		}()
+	}
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+	}
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.GetShutdownTimeout())
+	defer cancel()
+
+	// live feed streams never finish by themselves
+	eventbus.CloseAll(db)
+	shutdownErr := app.ShutdownWithContext(shutdownCtx)
+	if shutdownErr != nil {
+		slog.Error("failed to drain the http servers", "error", shutdownErr)
+	}
+	scheduler.Stop(shutdownCtx)
+	closeErr := dbutils.Close(db)
+	if closeErr != nil {
+		slog.Error("failed to close the database", "error", closeErr)
+	}
+	return err
+}
+
+func PrintAllRoutes(app *fiber.App) {
+	routes := app.GetRoutes()
+
+	pathMap := make(map[string][]string)
+	for _, r := range routes {
+		pathMap[r.Path] = append(pathMap[r.Path], r.Method)
+	}
+
+	paths := make([]string, 0, len(pathMap))
+	for p := range pathMap {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Println()
+	fmt.Fprintln(w, "PATH\tMETHODS")
+
+	for _, p := range paths {
+		methods := pathMap[p]
+		sort.Strings(methods)
+		fmt.Fprintf(w, "%s\t%s\n", p, methods)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/abramad-labs/irbankmock/internal/banks/registry"
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/fixtures"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/abramad-labs/irbankmock/internal/server"
+	"github.com/abramad-labs/irbankmock/internal/version"
+	"gorm.io/gorm"
+)
+
+const commandsUsage = `usage: server [-config file] [-<setting> value ...] <command>
+
+  server [serve]                          start the http server
+  server version                          print the version
+  server config                           print the effective configuration, secrets redacted
+  server routes                           list the http routes
+  server healthcheck [-path p]            probe /readyz, or p, of the running server
+  server migrate status                   list the migrations and whether they are applied
+  server migrate up [-dry-run] [-to v]    apply the pending migrations, up to version v if given
+  server migrate down [-dry-run] [-steps n]
+                                          roll back the latest n migrations, one by default
+  server seed <file>                      apply a fixtures file
+  server reset [-keep-terminals]          remove all bank data
+  server snapshot list                    list snapshots
+  server snapshot create <name>           take a snapshot of the database
+  server snapshot restore <name>          restore the database from a snapshot
+  server snapshot delete <name>           delete a snapshot
+  server terminal list [-namespace ns]    list terminals
+  server terminal create [-namespace ns] <name>
+                                          create a terminal
+  server terminal rotate <id>             replace the credentials of a terminal
+  server tx list [-namespace ns] [-terminal id] [-limit n]
+                                          list transactions, newest first
+  server tx show <id|token>               show a transaction
+  server tx force <id|token> <state>      move an in-progress transaction into the OK,
+                                          CanceledByUser, Failed or Expired state
+
+terminal and tx commands accept -bank to select the bank, the first bank by default.
+Every setting listed by the config command can be set by a flag of the same name.`
+
+func runCommand(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "serve":
+		db, err := openDb()
+		if err != nil {
+			return err
+		}
+		return serve(ctx, db)
+	case "help", "-h", "-help", "--help":
+		fmt.Println(commandsUsage)
+		return nil
+	case "version":
+		fmt.Println(version.ServerVersion)
+		return nil
+	case "config":
+		printConfig()
+		return nil
+	case "healthcheck":
+		return runHealthcheck(args[1:])
+	case "routes":
+		// routes don't touch the database while being registered
+		PrintAllRoutes(server.NewApp(nil, server.Options{}))
+		return nil
+	case "migrate":
+		// the migrate command manages the schema by itself, so the database is left as is
+		db, err := dbutils.InitializeDb()
+		if err != nil {
+			return err
+		}
+		return runMigrateCommand(db, args[1:])
+	}
+
+	db, err := openDb()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "seed":
+		if len(args) != 2 {
+			return errors.New(commandsUsage)
+		}
+		return fixtures.ApplyFile(db, args[1])
+	case "reset":
+		fs := flag.NewFlagSet("reset", flag.ExitOnError)
+		keepTerminals := fs.Bool("keep-terminals", false, "keep terminals of all banks")
+		fs.Parse(args[1:])
+		return snapshot.Reset(db, snapshot.ResetOptions{KeepTerminals: *keepTerminals})
+	case "snapshot":
+		return runSnapshotCommand(db, args[1:])
+	case "terminal":
+		return runTerminalCommand(db, args[1:])
+	case "tx":
+		return runTxCommand(db, args[1:])
+	}
+	return errors.New(commandsUsage)
+}
+
+func printConfig() {
+	if file := conf.ConfigFile(); file != "" {
+		fmt.Printf("config file: %s\n\n", file)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE\tENV")
+	for _, s := range conf.Effective() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Key, s.Value, s.Source, s.Env)
+	}
+	w.Flush()
+}
+
+// openDb opens the database, applies the pending migrations if enabled and seeds
+// the fixtures if configured.
+func openDb() (*gorm.DB, error) {
+	db, err := dbutils.InitializeDb()
+	if err != nil {
+		return nil, fmt.Errorf("failed to init db: %w", err)
+	}
+
+	if conf.ShouldAutoMigrate() {
+		_, err = migration.Up(db, migration.UpOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("migration failed: %w", err)
+		}
+	}
+
+	if fixturesPath := conf.GetFixturesPath(); fixturesPath != "" {
+		err = fixtures.ApplyFile(db, fixturesPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply fixtures: %w", err)
+		}
+	}
+	return db, nil
+}
+
+func runSnapshotCommand(db *gorm.DB, args []string) error {
+	if len(args) == 1 && args[0] == "list" {
+		snapshots, err := snapshot.List()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSIZE\tCREATED AT")
+		for _, s := range snapshots {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", s.Name, s.Size, s.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+	}
+	if len(args) != 2 {
+		return errors.New(commandsUsage)
+	}
+
+	name := args[1]
+	switch args[0] {
+	case "create":
+		_, err := snapshot.Create(db, name)
+		return err
+	case "restore":
+		return snapshot.Restore(db, name)
+	case "delete":
+		return snapshot.Delete(name)
+	}
+	return errors.New(commandsUsage)
+}
+
+func runMigrateCommand(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(commandsUsage)
+	}
+	switch args[0] {
+	case "status":
+		entries, err := migration.Status(db)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, e := range entries {
+			status := "pending"
+			appliedAt := ""
+			if e.Applied {
+				status = "applied"
+				appliedAt = e.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if e.Unknown {
+				status = "unknown"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", e.Version, e.Name, status, appliedAt)
+		}
+		return w.Flush()
+	case "up":
+		fs := flag.NewFlagSet("migrate up", flag.ExitOnError)
+		dryRun := fs.Bool("dry-run", false, "only list the pending migrations")
+		target := fs.Int64("to", 0, "apply up to and including this version")
+		fs.Parse(args[1:])
+		applied, err := migration.Up(db, migration.UpOptions{DryRun: *dryRun, Target: *target})
+		printMigrations(applied, *dryRun, "applied", "would apply")
+		return err
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		dryRun := fs.Bool("dry-run", false, "only list the migrations to roll back")
+		steps := fs.Int("steps", 1, "number of migrations to roll back")
+		fs.Parse(args[1:])
+		rolledBack, err := migration.Down(db, migration.DownOptions{DryRun: *dryRun, Steps: *steps})
+		printMigrations(rolledBack, *dryRun, "rolled back", "would roll back")
+		return err
+	}
+	return errors.New(commandsUsage)
+}
+
+func printMigrations(migrations []*migration.Migration, dryRun bool, done string, planned string) {
+	verb := done
+	if dryRun {
+		verb = planned
+	}
+	if len(migrations) == 0 {
+		fmt.Println("nothing to do")
+	}
+	for _, m := range migrations {
+		fmt.Printf("%s %d %s\n", verb, m.Version, m.Name)
+	}
+}
+
+// bankFlags parses the flags shared by the terminal and tx commands, set adds the
+// flags of the subcommand.
+func bankFlags(name string, args []string, set func(fs *flag.FlagSet)) (registry.Commands, *flag.FlagSet, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	banks := registry.CommandBanks()
+	defaultBank := ""
+	if len(banks) > 0 {
+		defaultBank = banks[0]
+	}
+	bank := fs.String("bank", defaultBank, "one of "+strings.Join(banks, ", "))
+	if set != nil {
+		set(fs)
+	}
+	fs.Parse(args)
+	cmds, ok := registry.GetCommands(*bank)
+	if !ok {
+		return nil, nil, fmt.Errorf("bank %q has no commands", *bank)
+	}
+	return cmds, fs, nil
+}
+
+func runTerminalCommand(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(commandsUsage)
+	}
+	var ns *string
+	withNamespace := func(fs *flag.FlagSet) {
+		ns = fs.String("namespace", "", "namespace of the terminals")
+	}
+
+	switch args[0] {
+	case "list":
+		cmds, _, err := bankFlags("terminal list", args[1:], withNamespace)
+		if err != nil {
+			return err
+		}
+		return printJson(cmds.ListTerminals(db, strings.ToLower(*ns)))
+	case "create":
+		cmds, fs, err := bankFlags("terminal create", args[1:], withNamespace)
+		if err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New(commandsUsage)
+		}
+		terminalNs := strings.ToLower(*ns)
+		if terminalNs == "" {
+			terminalNs = namespace.Default
+		}
+		return printJson(cmds.CreateTerminal(db, terminalNs, fs.Arg(0)))
+	case "rotate":
+		cmds, fs, err := bankFlags("terminal rotate", args[1:], nil)
+		if err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New(commandsUsage)
+		}
+		id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid terminal id %q", fs.Arg(0))
+		}
+		return printJson(cmds.RotateTerminal(db, id))
+	}
+	return errors.New(commandsUsage)
+}
+
+func runTxCommand(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(commandsUsage)
+	}
+	switch args[0] {
+	case "list":
+		var ns *string
+		var terminalId, limit *int64
+		cmds, _, err := bankFlags("tx list", args[1:], func(fs *flag.FlagSet) {
+			ns = fs.String("namespace", "", "namespace of the terminals")
+			terminalId = fs.Int64("terminal", 0, "id of the terminal")
+			limit = fs.Int64("limit", 100, "maximum number of transactions")
+		})
+		if err != nil {
+			return err
+		}
+		filter := &registry.TransactionFilter{
+			Namespace: strings.ToLower(*ns),
+			Limit:     int(*limit),
+		}
+		if *terminalId != 0 {
+			filter.TerminalId = terminalId
+		}
+		return printJson(cmds.ListTransactions(db, filter))
+	case "show":
+		cmds, fs, err := bankFlags("tx show", args[1:], nil)
+		if err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New(commandsUsage)
+		}
+		return printJson(cmds.ShowTransaction(db, fs.Arg(0)))
+	case "force":
+		cmds, fs, err := bankFlags("tx force", args[1:], nil)
+		if err != nil {
+			return err
+		}
+		if fs.NArg() != 2 {
+			return errors.New(commandsUsage)
+		}
+		return printJson(cmds.ForceTransaction(db, fs.Arg(0), fs.Arg(1)))
+	}
+	return errors.New(commandsUsage)
+}
+
+func printJson(v any, err error) error {
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/health"
+)
+
+// runHealthcheck probes the running server for container healthchecks, the distroless
+// image has no curl or wget.
+func runHealthcheck(args []string) error {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	path := fs.String("path", health.ReadyPath, "path to probe, /healthz for liveness")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout of the probe")
+	fs.Parse(args)
+
+	scheme, addr := "http", conf.GetListenAddress()
+	if addr == "" {
+		scheme, addr = "https", conf.GetTLSListenAddress()
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	client := &http.Client{
+		Timeout: *timeout,
+		Transport: &http.Transport{
+			// the generated certificate may not cover the loopback address
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get(scheme + "://" + net.JoinHostPort(host, port) + *path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Println(string(body))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", *path, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrUnauthorized = errors.New("authentication required")
+var ErrForbidden = errors.New("invalid credentials")
+
+// RequireAdmin protects the management routes when admin authentication is enabled.
+// Both a bearer token and basic auth are accepted, whichever is configured.
+func RequireAdmin(c *fiber.Ctx) error {
+	if !conf.IsAdminAuthEnabled() {
+		return c.Next()
+	}
+
+	header := c.Get(fiber.HeaderAuthorization)
+	scheme, credentials, found := strings.Cut(header, " ")
+	if !found || credentials == "" {
+		return usererror.NewWithStatus(ErrUnauthorized, fiber.StatusUnauthorized)
+	}
+
+	var ok bool
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		ok = checkToken(credentials)
+	case "basic":
+		ok = checkBasic(credentials)
+	default:
+		return usererror.NewWithStatus(ErrUnauthorized, fiber.StatusUnauthorized)
+	}
+	if !ok {
+		return usererror.NewWithStatus(ErrForbidden, fiber.StatusForbidden)
+	}
+	return c.Next()
+}
+
+func checkToken(token string) bool {
+	expected := conf.GetAdminToken()
+	if expected == "" {
+		return false
+	}
+	return secureEqual(token, expected)
+}
+
+func checkBasic(credentials string) bool {
+	expectedUsername := conf.GetAdminUsername()
+	if expectedUsername == "" {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(credentials)
+	if err != nil {
+		return false
+	}
+	username, password, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return false
+	}
+	// both are compared to keep the timing independent of which one is wrong
+	usernameOk := secureEqual(username, expectedUsername)
+	passwordOk := secureEqual(password, conf.GetAdminPassword())
+	return usernameOk && passwordOk
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
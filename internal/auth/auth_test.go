@@ -0,0 +1,110 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/abramad-labs/irbankmock/internal/banks"
+	"github.com/abramad-labs/irbankmock/internal/banks/sep"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/dbtest"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/server"
+	"github.com/gofiber/fiber/v2"
+)
+
+const token = "admin-token"
+const username = "admin"
+const password = "admin-password"
+
+func basic(username string, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+func newApp(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Setenv("IRBANKMOCK_ADMIN_TOKEN", token)
+	t.Setenv("IRBANKMOCK_ADMIN_USERNAME", username)
+	t.Setenv("IRBANKMOCK_ADMIN_PASSWORD", password)
+	db := dbtest.Open(t)
+	_, err := migration.Up(db, migration.UpOptions{})
+	if err != nil {
+		t.Fatalf("migrations failed: %v", err)
+	}
+	return server.NewApp(db, server.Options{DisableStartupMessage: true})
+}
+
+// do sends the request with the authorization header unless it's empty and returns
+// the status.
+func do(t *testing.T, app *fiber.App, method string, path string, body string, authorization string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if authorization != "" {
+		req.Header.Set(fiber.HeaderAuthorization, authorization)
+	}
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestManagementRoutesRequireAdmin(t *testing.T) {
+	app := newApp(t)
+	if status := do(t, app, http.MethodPost, "/management/namespaces", `{"name":"x"}`, "Bearer "+token); status != http.StatusOK {
+		t.Fatalf("creating the namespace responded with %d", status)
+	}
+
+	paths := []string{
+		"/management/auth/check",
+		"/banks/saman/management/terminal",
+		"/ns/x/banks/saman/management/terminal",
+	}
+	cases := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"no credentials", "", http.StatusUnauthorized},
+		{"unknown scheme", "Digest " + token, http.StatusUnauthorized},
+		{"scheme only", "Bearer", http.StatusUnauthorized},
+		{"wrong bearer", "Bearer wrong-token", http.StatusForbidden},
+		{"wrong username", basic("someone", password), http.StatusForbidden},
+		{"wrong password", basic(username, "wrong-password"), http.StatusForbidden},
+		{"malformed basic", "Basic not-base64", http.StatusForbidden},
+		{"bearer", "Bearer " + token, http.StatusOK},
+		{"basic", basic(username, password), http.StatusOK},
+	}
+	for _, path := range paths {
+		for _, tc := range cases {
+			status := do(t, app, http.MethodGet, path, "", tc.authorization)
+			if status != tc.status {
+				t.Errorf("%s with %s responded with %d, want %d", path, tc.name, status, tc.status)
+			}
+		}
+	}
+}
+
+func TestMerchantRoutesStayOpen(t *testing.T) {
+	app := newApp(t)
+	if status := do(t, app, http.MethodPost, "/management/namespaces", `{"name":"x"}`, basic(username, password)); status != http.StatusOK {
+		t.Fatalf("creating the namespace responded with %d", status)
+	}
+	for _, prefix := range []string{"/banks/saman", "/ns/x/banks/saman"} {
+		for _, path := range []string{
+			sep.BankSepPathOnlinePaymentGateway,
+			sep.BankSepPathGetReceipt,
+			sep.BankSepPathVerifyTransaction,
+			sep.BankSepPathReverseTransaction,
+		} {
+			status := do(t, app, http.MethodPost, prefix+path, `{"TerminalNumber":1,"RefNum":"ref"}`, "")
+			if status == http.StatusUnauthorized || status == http.StatusForbidden {
+				t.Errorf("%s responded with %d without credentials", prefix+path, status)
+			}
+		}
+	}
+}
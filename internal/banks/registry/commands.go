@@ -0,0 +1,51 @@
+package registry
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// TransactionFilter narrows down the transactions of the tx list command.
+type TransactionFilter struct {
+	Namespace  string
+	TerminalId *int64
+	Limit      int
+}
+
+// Commands let the server binary manage the terminals and transactions of a bank from
+// the command line. The results are printed as json. Transactions are referenced by
+// either their id or their token.
+type Commands interface {
+	CreateTerminal(db *gorm.DB, namespace string, name string) (any, error)
+	ListTerminals(db *gorm.DB, namespace string) (any, error)
+	// RotateTerminal replaces the credentials of the terminal
+	RotateTerminal(db *gorm.DB, id int64) (any, error)
+
+	ListTransactions(db *gorm.DB, filter *TransactionFilter) (any, error)
+	ShowTransaction(db *gorm.DB, ref string) (any, error)
+	// ForceTransaction moves the transaction into the given state without going
+	// through the payment page
+	ForceTransaction(db *gorm.DB, ref string, state string) (any, error)
+}
+
+var commands = map[string]Commands{}
+
+func RegisterCommands(bankName string, cmds Commands) {
+	commands[bankName] = cmds
+}
+
+func GetCommands(bankName string) (Commands, bool) {
+	cmds, ok := commands[bankName]
+	return cmds, ok
+}
+
+// CommandBanks returns the names of the banks with registered commands.
+func CommandBanks() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/openapi"
+	"github.com/gofiber/fiber/v2"
+)
+
+// BanksPath lists the enabled banks and their metadata.
+const BanksPath = "/banks"
+
+// Capability is a management feature a bank supports besides its merchant routes.
+type Capability string
+
+const (
+	// terminals can be created and listed by the management api
+	CapabilityTerminals Capability = "terminals"
+	// the web app serves a payment page for the tokens of the bank
+	CapabilityPaymentPage Capability = "paymentPage"
+	// tokens can be paid, cancelled or failed by the management api
+	CapabilityTokenActions Capability = "tokenActions"
+	// terminals and transactions can be managed by the commands of the server binary
+	CapabilityCommands Capability = "commands"
+	// terminals and transactions can be seeded from fixtures
+	CapabilityFixtures Capability = "fixtures"
+)
+
+// Endpoint is a route merchants call. Path is relative to the bank prefix.
+type Endpoint struct {
+	Name        string `json:"name"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Description string `json:"description,omitempty"`
+}
+
+// BankInfo describes a bank for the discovery api and the web app.
+type BankInfo struct {
+	// the path segment of the bank routes, e.g. saman in /banks/saman
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	PersianName string `json:"persianName"`
+	// path of the logo served by the web app
+	Logo             string   `json:"logo,omitempty"`
+	ProtocolVersions []string `json:"protocolVersions"`
+	DocumentationURL string   `json:"documentationUrl,omitempty"`
+	// path of the management page in the web app
+	ManagementPage string       `json:"managementPage,omitempty"`
+	Endpoints      []Endpoint   `json:"endpoints"`
+	Capabilities   []Capability `json:"capabilities"`
+}
+
+var ErrUnknownBank = errors.New("unknown bank")
+
+func init() {
+	conf.Register(&conf.Setting{Key: "banks.enabled", Env: "IRBANKMOCK_BANKS_ENABLED", Validate: validateBankNames,
+		Description: "comma separated banks to serve, all of them if empty"})
+	conf.Register(&conf.Setting{Key: "banks.disabled", Env: "IRBANKMOCK_BANKS_DISABLED", Validate: validateBankNames,
+		Description: "comma separated banks not to serve, wins over banks.enabled"})
+}
+
+// validateBankNames runs after the init of all packages, once every bank is registered.
+func validateBankNames(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && findBank(name) == nil {
+			return fmt.Errorf("%w %s, registered banks are %s", ErrUnknownBank, name, strings.Join(allBankNames(), ", "))
+		}
+	}
+	return nil
+}
+
+func findBank(name string) *bankEntry {
+	for i := range banks {
+		if strings.EqualFold(banks[i].Info.Name, name) {
+			return &banks[i]
+		}
+	}
+	return nil
+}
+
+func allBankNames() []string {
+	names := make([]string, 0, len(banks))
+	for _, b := range banks {
+		names = append(names, b.Info.Name)
+	}
+	return names
+}
+
+// IsEnabled reports whether the routes of the bank are served.
+func IsEnabled(name string) bool {
+	matches := func(list []string) bool {
+		return slices.ContainsFunc(list, func(n string) bool {
+			return strings.EqualFold(n, name)
+		})
+	}
+	enabled := conf.GetList("banks.enabled")
+	if len(enabled) > 0 && !matches(enabled) {
+		return false
+	}
+	return !matches(conf.GetList("banks.disabled"))
+}
+
+// Banks returns the metadata of the enabled banks in their registration order.
+func Banks() []*BankInfo {
+	var result []*BankInfo
+	for _, b := range banks {
+		if IsEnabled(b.Info.Name) {
+			result = append(result, b.Info)
+		}
+	}
+	return result
+}
+
+type EndpointResponse struct {
+	Endpoint
+	// absolute url of the endpoint in the default namespace
+	URL string `json:"url"`
+}
+
+type BankResponse struct {
+	*BankInfo
+	// path prefix of the bank routes
+	Prefix    string              `json:"prefix"`
+	Endpoints []*EndpointResponse `json:"endpoints"`
+}
+
+// ConfigBanksRouter adds the route listing the banks.
+func ConfigBanksRouter(r fiber.Router) {
+	openapi.Route(r, fiber.MethodGet, BanksPath, &openapi.Operation{
+		Summary:     "List the enabled banks",
+		Description: "Metadata of the banks along with the absolute urls of their merchant endpoints.",
+		Tags:        []string{"banks"},
+		Response:    []*BankResponse{},
+	}, ListBanks)
+}
+
+// ListBanks serves the metadata of the enabled banks, e.g. for the home page of the
+// web app.
+func ListBanks(c *fiber.Ctx) error {
+	result := []*BankResponse{}
+	for _, info := range Banks() {
+		prefix := RegistryBanksPrefix + info.Name
+		resp := &BankResponse{BankInfo: info, Prefix: prefix, Endpoints: []*EndpointResponse{}}
+		for _, e := range info.Endpoints {
+			resp.Endpoints = append(resp.Endpoints, &EndpointResponse{
+				Endpoint: e,
+				URL:      AbsoluteURL(c, prefix+e.Path),
+			})
+		}
+		result = append(result, resp)
+	}
+	return c.JSON(result)
+}
@@ -1,45 +1,140 @@
 package registry
 
 import (
+	"slices"
+	"strings"
+
+	"github.com/abramad-labs/irbankmock/internal/auth"
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/abramad-labs/irbankmock/internal/openapi"
 	"github.com/gofiber/fiber/v2"
 )
 
 const RegistryBanksPrefix = "/banks/"
 
+// banks are also served under this prefix to select the namespace using the url,
+// e.g. /ns/pipeline-1/banks/saman/...
+const RegistryNamespacePrefix = "/ns/"
+
+// routes of a bank under this prefix require admin authentication, if enabled.
+// merchant-facing routes must never be registered under it.
+const RegistryManagementPrefix = "/management"
+
 type routerPrefixType struct{}
+type bankPrefixType struct{}
 
 var routerPrefixKey routerPrefixType
+var bankPrefixKey bankPrefixType
 
 type bankEntry struct {
-	Name   string
+	Info   *BankInfo
 	Action func(g fiber.Router)
 }
 
 var banks []bankEntry
 
-func RegisterBank(name string, action func(g fiber.Router)) {
+// RegisterBank adds a bank, action registers its routes. It must be called in init.
+func RegisterBank(info *BankInfo, action func(g fiber.Router)) {
 	banks = append(banks, bankEntry{
-		Name:   name,
+		Info:   info,
 		Action: action,
 	})
 }
 
+// BankNames returns the enabled banks in their registration order.
+func BankNames() []string {
+	names := []string{}
+	for _, info := range Banks() {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+// Route adds a route of the bank to g along with its openapi metadata. path is relative
+// to the bank prefix.
+func Route(g fiber.Router, bankName string, method string, path string, op *openapi.Operation, handlers ...fiber.Handler) {
+	// the routes are added under every prefix of the bank, each gets its own copy
+	described := *op
+	if len(described.Tags) == 0 {
+		described.Tags = []string{bankName}
+	}
+	described.Parameters = append(slices.Clone(op.Parameters), openapi.Parameter{
+		Name:        namespace.HeaderName,
+		In:          "header",
+		Description: "namespace of the terminals, also selectable with the " + RegistryNamespacePrefix + "{namespace} path prefix",
+		Schema:      &openapi.Schema{Type: "string"},
+	})
+	openapi.Route(g, method, path, &described, handlers...)
+}
+
 func Cleanup() {
 	banks = nil
 }
 
 func ConfigAppRouters(app *fiber.Group) {
 	for _, entry := range banks {
-		grpPath := RegistryBanksPrefix + entry.Name
+		if !IsEnabled(entry.Info.Name) {
+			continue
+		}
+		grpPath := RegistryBanksPrefix + entry.Info.Name
 		grp := app.Group(grpPath)
+		grp.Use(RegistryManagementPrefix, auth.RequireAdmin)
 		grp.Use(func(c *fiber.Ctx) error {
 			c.Locals(routerPrefixKey, grpPath)
+			c.Locals(bankPrefixKey, grpPath)
+			err := namespace.Use(c, "")
+			if err != nil {
+				return err
+			}
 			return c.Next()
 		})
 		entry.Action(grp)
+
+		nsGrp := app.Group(RegistryNamespacePrefix + ":namespace" + grpPath)
+		nsGrp.Use(RegistryManagementPrefix, auth.RequireAdmin)
+		nsGrp.Use(func(c *fiber.Ctx) error {
+			ns := c.Params("namespace")
+			c.Locals(routerPrefixKey, RegistryNamespacePrefix+ns+grpPath)
+			c.Locals(bankPrefixKey, grpPath)
+			err := namespace.Use(c, ns)
+			if err != nil {
+				return err
+			}
+			return c.Next()
+		})
+		entry.Action(nsGrp)
 	}
 }
 
+// GetRouterPrefix returns the path prefix the request was routed with, including the
+// namespace prefix if any.
 func GetRouterPrefix(c *fiber.Ctx) string {
 	return c.Locals(routerPrefixKey).(string)
 }
+
+// GetBankPrefix returns the path prefix of the bank regardless of the namespace. Pages
+// of the web app are only served under this prefix.
+func GetBankPrefix(c *fiber.Ctx) string {
+	return c.Locals(bankPrefixKey).(string)
+}
+
+// GetPublicBaseURL returns the scheme and host merchants reach the service at. The
+// configured public hostname wins, otherwise it's taken from the request along with
+// the X-Forwarded-Proto and X-Forwarded-Host headers of trusted proxies.
+func GetPublicBaseURL(c *fiber.Ctx) string {
+	hostname := conf.GetPublicHostname()
+	if hostname == "" {
+		return c.BaseURL()
+	}
+	if !strings.Contains(hostname, "://") {
+		return c.Protocol() + "://" + hostname
+	}
+	return hostname
+}
+
+// AbsoluteURL returns the public url of path, banks must use it for every url they
+// hand out to merchants.
+func AbsoluteURL(c *fiber.Ctx, path string) string {
+	return GetPublicBaseURL(c) + path
+}
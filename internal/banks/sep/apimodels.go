@@ -23,10 +23,11 @@ type BankSepCreateTerminalRequest struct {
 }
 
 type BankSepTerminalResponse struct {
-	ID       uint64 `json:"id"`
-	Name     string `json:"name"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	ID        uint64 `json:"id"`
+	Name      string `json:"name"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Namespace string `json:"namespace"`
 }
 
 type BankSepManagementError struct {
@@ -263,3 +264,88 @@ type BankSepVerificationResponse struct {
 
 type BankSepReverseRequest BankSepVerificationRequest
 type BankSepReverseResponse BankSepVerificationResponse
+
+// transaction data sent along with the webhook events
+type BankSepEventTransaction struct {
+	Token            string               `json:"token"`
+	ResNum           string               `json:"resNum"`
+	Amount           int64                `json:"amount"`
+	State            PaymentReceiptState  `json:"state"`
+	Status           PaymentReceiptStatus `json:"status"`
+	RefNum           string               `json:"refNum,omitempty"`
+	Rrn              int64                `json:"rrn,omitempty"`
+	TraceNo          int64                `json:"traceNo,omitempty"`
+	SecurePan        string               `json:"securePan,omitempty"`
+	HashedCardNumber string               `json:"hashedCardNumber,omitempty"`
+	CreatedAt        time.Time            `json:"createdAt"`
+	ExpiresAt        time.Time            `json:"expiresAt"`
+	VerifiedAt       *time.Time           `json:"verifiedAt,omitempty"`
+	ReversedAt       *time.Time           `json:"reversedAt,omitempty"`
+}
+
+// outcome of a token request sent to the live feed
+type BankSepFeedTokenRequest struct {
+	ResNum    string `json:"resNum"`
+	Amount    int64  `json:"amount"`
+	Token     string `json:"token,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	ErrorDesc string `json:"errorDesc,omitempty"`
+}
+
+// outcome of a receipt request sent to the live feed
+type BankSepFeedReceiptRequest struct {
+	RefNum       *string             `json:"refNum,omitempty"`
+	Token        *string             `json:"token,omitempty"`
+	State        PaymentReceiptState `json:"state,omitempty"`
+	HasError     bool                `json:"hasError"`
+	ErrorCode    int32               `json:"errorCode,omitempty"`
+	ErrorMessage string              `json:"errorMessage,omitempty"`
+}
+
+// outcome of a verify or reverse request sent to the live feed
+type BankSepFeedVerification struct {
+	RefNum            string `json:"refNum"`
+	Success           bool   `json:"success"`
+	ResultCode        int32  `json:"resultCode"`
+	ResultDescription string `json:"resultDescription"`
+}
+
+// transaction printed by the tx commands of the server binary
+type BankSepTransactionInfo struct {
+	ID         uint64 `json:"id"`
+	TerminalId int64  `json:"terminalId"`
+	Namespace  string `json:"namespace"`
+	BankSepEventTransaction
+}
+
+type BankSepPaymentIdentifiers struct {
+	RefNum  string `json:"refNum"`
+	Rrn     int64  `json:"rrn"`
+	TraceNo int64  `json:"traceNo"`
+}
+
+type BankSepSetIdentifierSeedRequest struct {
+	// seed of the identifiers of the terminal, the seed of the server is used if empty
+	Seed string `json:"seed"`
+}
+
+type BankSepPreloadIdentifiersRequest struct {
+	// number of tokens and payment identifiers to generate and preload
+	Count int `json:"count"`
+	// tokens to hand out as they are, before the generated ones
+	Tokens []string `json:"tokens"`
+	// payment identifiers to hand out as they are, before the generated ones
+	Payments []BankSepPaymentIdentifiers `json:"payments"`
+}
+
+type BankSepIdentifiersResponse struct {
+	TerminalId uint64 `json:"terminalId"`
+	// seed of the terminal, empty if it follows the seed of the server
+	Seed string `json:"seed"`
+	// whether the identifiers are generated from a seed rather than randomly
+	Seeded bool `json:"seeded"`
+	// preloaded tokens, handed out to the next token requests in order
+	Tokens []string `json:"tokens"`
+	// preloaded payment identifiers, handed out to the next payments in order
+	Payments []BankSepPaymentIdentifiers `json:"payments"`
+}
@@ -0,0 +1,219 @@
+package sep
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/abramad-labs/irbankmock/internal/banks/registry"
+	"github.com/abramad-labs/irbankmock/internal/banks/sep/managementerrors"
+	"github.com/abramad-labs/irbankmock/internal/clock"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/abramad-labs/irbankmock/internal/webhook"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// card used for the transactions forced into the OK state
+const forcedCardNumber = "6037990000000000"
+
+var ErrTerminalNotFound = errors.New("terminal not found")
+var ErrUnknownState = errors.New("state must be one of OK, CanceledByUser, Failed or Expired")
+
+// PaymentReceiptStateExpired is only accepted by the tx force command, expired
+// transactions keep the InProgress status.
+const PaymentReceiptStateExpired = PaymentReceiptState("Expired")
+
+type bankSepCommands struct{}
+
+// CreateTerminal creates the namespace of the terminal too if it doesn't exist, like
+// the fixtures do.
+func (bankSepCommands) CreateTerminal(db *gorm.DB, ns string, name string) (any, error) {
+	var resp *BankSepTerminalResponse
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := namespace.Ensure(tx, ns)
+		if err != nil {
+			return fmt.Errorf("namespace %q: %w", ns, err)
+		}
+		resp, err = insertTerminal(tx, ns, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (bankSepCommands) ListTerminals(db *gorm.DB, ns string) (any, error) {
+	var terminals []*BankSepTerminal
+	query := db.Order("id")
+	if ns != "" {
+		query = query.Where("namespace = ?", ns)
+	}
+	err := query.Find(&terminals).Error
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]*BankSepTerminalResponse, len(terminals))
+	for i, t := range terminals {
+		resp[i] = newTerminalResponse(t)
+	}
+	return resp, nil
+}
+
+func (bankSepCommands) RotateTerminal(db *gorm.DB, id int64) (any, error) {
+	var terminal BankSepTerminal
+	err := db.Take(&terminal, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTerminalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	terminal.Username = uuid.NewString()
+	terminal.Password = uuid.NewString()
+	err = db.Model(&terminal).Updates(map[string]any{
+		"username": terminal.Username,
+		"password": terminal.Password,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return newTerminalResponse(&terminal), nil
+}
+
+func (bankSepCommands) ListTransactions(db *gorm.DB, filter *registry.TransactionFilter) (any, error) {
+	query := db.Model(&BankSepTransaction{}).Preload("Terminal").Order("id desc")
+	if filter.Namespace != "" {
+		terminals := db.Model(&BankSepTerminal{}).Select("id").Where("namespace = ?", filter.Namespace)
+		query = query.Where("terminal_id IN (?)", terminals)
+	}
+	if filter.TerminalId != nil {
+		query = query.Where("terminal_id = ?", *filter.TerminalId)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	var transactions []*BankSepTransaction
+	err := query.Limit(limit).Find(&transactions).Error
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]*BankSepTransactionInfo, len(transactions))
+	for i, t := range transactions {
+		resp[i] = newTransactionInfo(t)
+	}
+	return resp, nil
+}
+
+func (bankSepCommands) ShowTransaction(db *gorm.DB, ref string) (any, error) {
+	btrx, err := findTransaction(db, ref)
+	if err != nil {
+		return nil, err
+	}
+	return newTransactionInfo(btrx), nil
+}
+
+func (bankSepCommands) ForceTransaction(db *gorm.DB, ref string, state string) (any, error) {
+	var btrx *BankSepTransaction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		btrx, err = findTransaction(tx, ref)
+		if err != nil {
+			return err
+		}
+		if btrx.Status != PaymentReceiptStatusInProgress || btrx.ExpiredAt != nil {
+			return managementerrors.ErrTokenNoLongerAvailable
+		}
+
+		now := clock.For(tx, btrx.Terminal.Namespace).Now()
+		var updates map[string]any
+		var event webhook.EventType
+		switch PaymentReceiptState(state) {
+		case PaymentReceiptStateOK:
+			ids, err := nextPaymentIdentifiers(tx, btrx.TerminalId)
+			if err != nil {
+				return err
+			}
+			cardHashBinary := sha256.Sum256([]byte(forcedCardNumber))
+			updates = map[string]any{
+				"status":             PaymentReceiptStatusOK,
+				"rrn":                ids.Rrn,
+				"ref_num":            ids.RefNum,
+				"submitted_at":       now,
+				"verify_deadline":    now.Add(getVerifyWindow()),
+				"reverse_deadline":   now.Add(getReverseWindow()),
+				"paid_card_number":   forcedCardNumber,
+				"hashed_card_number": hex.EncodeToString(cardHashBinary[:]),
+				"trace_no":           ids.TraceNo,
+				"trace_date":         now,
+			}
+			event = webhook.EventPaymentPaid
+		case PaymentReceiptStateCanceledByUser:
+			updates = map[string]any{
+				"cancelled_at": now,
+				"status":       PaymentReceiptStatusCanceledByUser,
+			}
+			event = webhook.EventPaymentCancelled
+		case PaymentReceiptStateFailed:
+			updates = map[string]any{
+				"failed_at": now,
+				"status":    PaymentReceiptStatusFailed,
+			}
+			event = webhook.EventPaymentFailed
+		case PaymentReceiptStateExpired:
+			updates = map[string]any{
+				"expires_at": now,
+				"expired_at": now,
+			}
+			event = webhook.EventPaymentExpired
+		default:
+			return fmt.Errorf("%w: %s", ErrUnknownState, state)
+		}
+
+		err = tx.Model(&BankSepTransaction{}).Where("id = ?", btrx.ID).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+		publishTransactionEvent(tx, event, btrx.ID)
+		btrx, err = findTransaction(tx, ref)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	webhook.Wake()
+	return newTransactionInfo(btrx), nil
+}
+
+// findTransaction looks up the transaction by its id, or its token if ref is not a
+// number.
+func findTransaction(db *gorm.DB, ref string) (*BankSepTransaction, error) {
+	query := db.Model(&BankSepTransaction{}).Preload("Terminal")
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("token = ?", ref)
+	}
+	var btrx BankSepTransaction
+	err := query.Take(&btrx).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, managementerrors.ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &btrx, nil
+}
+
+func newTransactionInfo(btrx *BankSepTransaction) *BankSepTransactionInfo {
+	return &BankSepTransactionInfo{
+		ID:                      btrx.ID,
+		TerminalId:              btrx.TerminalId,
+		Namespace:               btrx.Terminal.Namespace,
+		BankSepEventTransaction: *newEventTransaction(btrx),
+	}
+}
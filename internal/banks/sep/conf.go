@@ -0,0 +1,31 @@
+package sep
+
+import (
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+)
+
+func registerSettings() {
+	conf.RegisterBank(BankSepName, &conf.Setting{Key: "verifyWindow", Env: "IRBANKMOCK_SAMAN_VERIFY_WINDOW",
+		Default: "30m", Validate: conf.ValidateDuration,
+		Description: "how long a paid transaction can be verified"})
+	conf.RegisterBank(BankSepName, &conf.Setting{Key: "reverseWindow", Env: "IRBANKMOCK_SAMAN_REVERSE_WINDOW",
+		Default: "50m", Validate: conf.ValidateDuration,
+		Description: "how long a paid transaction can be reversed"})
+	conf.RegisterBank(BankSepName, &conf.Setting{Key: "receiptExpiry", Env: "IRBANKMOCK_SAMAN_RECEIPT_EXPIRY",
+		Default: "1h", Validate: conf.ValidateDuration,
+		Description: "how long the receipt of a token can be fetched"})
+}
+
+func getVerifyWindow() time.Duration {
+	return conf.GetDuration("banks." + BankSepName + ".verifyWindow")
+}
+
+func getReverseWindow() time.Duration {
+	return conf.GetDuration("banks." + BankSepName + ".reverseWindow")
+}
+
+func getReceiptExpiry() time.Duration {
+	return conf.GetDuration("banks." + BankSepName + ".receiptExpiry")
+}
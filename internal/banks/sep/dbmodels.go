@@ -9,13 +9,39 @@ type BankSepTerminal struct {
 	Name     string
 	Username string
 	Password string
+
+	// terminals are only visible to the requests of their own namespace
+	Namespace string `gorm:"size:64;not null;default:default;index"`
+
+	// seed of the tokens and payment identifiers of the terminal, the seed of the
+	// server is used if empty
+	IdSeed string `gorm:"size:128"`
+
+	// number of seeded tokens and payments generated so far, each one gets the next
+	// identifiers of the sequence of the seed
+	TokenCount   uint64 `gorm:"not null;default:0"`
+	PaymentCount uint64 `gorm:"not null;default:0"`
+}
+
+// BankSepPreloadedIdentifier is handed out before the generated identifiers of its
+// terminal, in the order they were preloaded. Tokens only set Token, payments set the
+// rest.
+type BankSepPreloadedIdentifier struct {
+	ID         uint64 `gorm:"primarykey"`
+	TerminalId int64  `gorm:"index"`
+	Kind       string `gorm:"size:16"`
+
+	Token   string
+	RefNum  string
+	Rrn     int64
+	TraceNo int64
 }
 
 type BankSepTransaction struct {
 	ID uint64 `gorm:"primarykey"`
 
 	// the merchant/termianl ID
-	TerminalId int64           `gorm:"index:,unique,composite:terminal_resnum_idx"`
+	TerminalId int64           `gorm:"index:,unique,composite:terminal_resnum_idx;index:,unique,composite:terminal_refnum_idx"`
 	Terminal   BankSepTerminal `gorm:"foreignKey:TerminalId"`
 
 	// amount of payment in IRR
@@ -66,14 +92,14 @@ type BankSepTransaction struct {
 	// if provided, you should pass this key to be able to receive the receipt
 	TxnRandomSessionKey *int64
 
-	Token string
+	Token string `gorm:"size:255;index:,unique"`
 
 	TraceNo   *int64
 	TraceDate *time.Time
 
 	// reference number used for validation and verification of transaction
 	// generated in bank side only after a successful transaction
-	RefNum *string
+	RefNum *string `gorm:"size:255;index:,unique,composite:terminal_refnum_idx"`
 
 	// Retrieval Reference Number (RRN) is a unique identifier assigned to a specific transaction
 	// to facilitate the retrieval of transaction details
@@ -86,6 +112,9 @@ type BankSepTransaction struct {
 	VerifiedAt  *time.Time
 	ReversedAt  *time.Time
 
+	// set once the expiry of an unpaid token is noticed
+	ExpiredAt *time.Time
+
 	// merchant has 30 minutes to verify
 	VerifyDeadline *time.Time
 
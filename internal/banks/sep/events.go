@@ -0,0 +1,75 @@
+package sep
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/eventbus"
+	"github.com/abramad-labs/irbankmock/internal/pointers"
+	"github.com/abramad-labs/irbankmock/internal/webhook"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// publishTransactionEvent notifies the subscribers about a state change of the
+// transaction. It reloads the transaction, so it must be called after the update, and
+// the caller wakes the dispatcher once its transaction committed. Failures are only
+// logged since they must not affect the bank operation: the publish runs in a nested
+// transaction, a savepoint inside the caller's one, that is rolled back on its own.
+// Postgres would abort the whole transaction of the caller otherwise.
+func publishTransactionEvent(db *gorm.DB, event webhook.EventType, transactionId uint64) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var btrx BankSepTransaction
+		err := tx.Model(&BankSepTransaction{}).Preload("Terminal").Where("id = ?", transactionId).Take(&btrx).Error
+		if err != nil {
+			return fmt.Errorf("failed to load the transaction: %w", err)
+		}
+		return webhook.Publish(tx, &webhook.Event{
+			Type:       event,
+			Bank:       BankSepName,
+			Namespace:  btrx.Terminal.Namespace,
+			TerminalId: btrx.TerminalId,
+			Data:       newEventTransaction(&btrx),
+		})
+	})
+	if err != nil {
+		slog.Error("failed to publish event", "transactionId", transactionId, "event", event, "error", err)
+	}
+}
+
+func newEventTransaction(btrx *BankSepTransaction) *BankSepEventTransaction {
+	return &BankSepEventTransaction{
+		Token:            btrx.Token,
+		ResNum:           btrx.ResNum,
+		Amount:           btrx.Amount,
+		State:            btrx.Status.GetState(),
+		Status:           btrx.Status,
+		RefNum:           pointers.DerefZero(btrx.RefNum),
+		Rrn:              pointers.DerefZero(btrx.Rrn),
+		TraceNo:          pointers.DerefZero(btrx.TraceNo),
+		SecurePan:        maskThirdQuarter(pointers.DerefZero(btrx.PaidCardNumber)),
+		HashedCardNumber: pointers.DerefZero(btrx.HashedCardNumber),
+		CreatedAt:        btrx.CreatedAt,
+		ExpiresAt:        btrx.ExpiresAt,
+		VerifiedAt:       btrx.VerifiedAt,
+		ReversedAt:       btrx.ReversedAt,
+	}
+}
+
+// publishFeedEvent pushes the outcome of a request to the live feed subscribers.
+func publishFeedEvent(c *fiber.Ctx, eventType string, ns string, terminalId int64, data any) {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return
+	}
+	requestId, _ := c.Locals("requestid").(string)
+	eventbus.Publish(db, &eventbus.Event{
+		Type:       eventType,
+		Bank:       BankSepName,
+		Namespace:  ns,
+		TerminalId: terminalId,
+		RequestId:  requestId,
+		Data:       data,
+	})
+}
@@ -0,0 +1,245 @@
+package sep
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/clock"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type bankSepFixtures struct {
+	Terminals    []bankSepTerminalFixture    `yaml:"terminals"`
+	Transactions []bankSepTransactionFixture `yaml:"transactions"`
+}
+
+type bankSepTerminalFixture struct {
+	ID        uint64 `yaml:"id"`
+	Name      string `yaml:"name"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+	Namespace string `yaml:"namespace"`
+	// seed of the generated tokens and payment identifiers of the terminal
+	IdSeed string `yaml:"idSeed"`
+}
+
+type bankSepTransactionFixture struct {
+	TerminalId       int64   `yaml:"terminalId"`
+	Amount           int64   `yaml:"amount"`
+	ResNum           string  `yaml:"resNum"`
+	RedirectURL      string  `yaml:"redirectURL"`
+	Token            string  `yaml:"token"`
+	TokenExpiryInMin int     `yaml:"tokenExpiryInMin"`
+	CellNumber       *string `yaml:"cellNumber"`
+
+	// one of InProgress, OK, CanceledByUser or Failed. defaults to InProgress.
+	State PaymentReceiptState `yaml:"state"`
+
+	// the following fields are only used when state is OK. refNum, rrn and traceNo are
+	// generated by the terminal if missing.
+	CardNumber string `yaml:"cardNumber"`
+	RefNum     string `yaml:"refNum"`
+	Rrn        int64  `yaml:"rrn"`
+	TraceNo    int64  `yaml:"traceNo"`
+	Verified   bool   `yaml:"verified"`
+	Reversed   bool   `yaml:"reversed"`
+}
+
+func applyFixtures(db *gorm.DB, decode func(v any) error) error {
+	var fixtures bankSepFixtures
+	err := decode(&fixtures)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range fixtures.Terminals {
+		if t.ID == 0 {
+			return fmt.Errorf("terminal %q must have an id", t.Name)
+		}
+		if strings.TrimSpace(t.Name) == "" {
+			return fmt.Errorf("terminal %d must have a name", t.ID)
+		}
+		t.Namespace = strings.ToLower(t.Namespace)
+		if t.Namespace == "" {
+			t.Namespace = namespace.Default
+		}
+		err = namespace.Ensure(db, t.Namespace)
+		if err != nil {
+			return fmt.Errorf("terminal %d: %w", t.ID, err)
+		}
+		model := &BankSepTerminal{
+			ID:        t.ID,
+			Name:      t.Name,
+			Username:  t.Username,
+			Password:  t.Password,
+			Namespace: t.Namespace,
+			IdSeed:    t.IdSeed,
+		}
+		if model.Username == "" {
+			model.Username = uuid.NewString()
+		}
+		if model.Password == "" {
+			model.Password = uuid.NewString()
+		}
+		// terminals declared in the fixtures are the source of truth, so the stored
+		// ones are overwritten. generated credentials are kept across restarts.
+		updates := []string{"name", "namespace", "id_seed"}
+		if t.Username != "" {
+			updates = append(updates, "username")
+		}
+		if t.Password != "" {
+			updates = append(updates, "password")
+		}
+		err = db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns(updates),
+		}).Create(model).Error
+		if err != nil {
+			return fmt.Errorf("failed seeding terminal %d: %w", t.ID, err)
+		}
+	}
+	err = dbutils.SyncSequence(db, &BankSepTerminal{})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range fixtures.Transactions {
+		var terminal BankSepTerminal
+		err := db.Select("id", "namespace").Where("id = ?", t.TerminalId).Take(&terminal).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("transaction %q references unknown terminal %d", t.ResNum, t.TerminalId)
+		}
+		if err != nil {
+			return err
+		}
+		now := clock.For(db, terminal.Namespace).Now()
+		model, err := t.toModel(now)
+		if err != nil {
+			return err
+		}
+		missingIds := model.Status == PaymentReceiptStatusOK && (t.RefNum == "" || t.Rrn == 0 || t.TraceNo == 0)
+		if model.Token == "" || missingIds {
+			// seeded identifiers aren't spent on transactions that were seeded before
+			var exists bool
+			err = db.Model(&BankSepTransaction{}).Select("count(*) > 0").
+				Where("terminal_id = ? AND res_num = ?", t.TerminalId, t.ResNum).Find(&exists).Error
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+		}
+		if model.Token == "" {
+			model.Token, err = nextToken(db, t.TerminalId)
+			if err != nil {
+				return err
+			}
+		}
+		if missingIds {
+			// like paying through the gateway, the missing ones are taken from the
+			// identifiers of the terminal
+			ids, err := nextPaymentIdentifiers(db, t.TerminalId)
+			if err != nil {
+				return err
+			}
+			if t.RefNum == "" {
+				model.RefNum = &ids.RefNum
+			}
+			if t.Rrn == 0 {
+				model.Rrn = &ids.Rrn
+			}
+			if t.TraceNo == 0 {
+				model.TraceNo = &ids.TraceNo
+			}
+		}
+		// transactions are owned by the mock once they are created, hence an existing
+		// transaction with the same terminal and resnum is left untouched.
+		created := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "terminal_id"}, {Name: "res_num"}},
+			DoNothing: true,
+		}).Create(model)
+		if created.Error != nil {
+			return fmt.Errorf("failed seeding transaction %q: %w", t.ResNum, created.Error)
+		}
+		if created.RowsAffected > 0 && model.Status == PaymentReceiptStatusInProgress {
+			err = scheduleExpiry(db, model, now)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *bankSepTransactionFixture) toModel(now time.Time) (*BankSepTransaction, error) {
+	if strings.TrimSpace(t.ResNum) == "" {
+		return nil, fmt.Errorf("transaction of terminal %d must have a resNum", t.TerminalId)
+	}
+	if t.Amount <= 0 {
+		return nil, fmt.Errorf("transaction %q must have a positive amount", t.ResNum)
+	}
+	if err := ValidateURL(t.RedirectURL); err != nil {
+		return nil, fmt.Errorf("transaction %q: %w", t.ResNum, err)
+	}
+
+	tokenExpiry := ClampTokenExpiryMinute(t.TokenExpiryInMin)
+	model := &BankSepTransaction{
+		TerminalId:       t.TerminalId,
+		Amount:           t.Amount,
+		ResNum:           t.ResNum,
+		RedirectURL:      t.RedirectURL,
+		CellNumber:       t.CellNumber,
+		TokenExpiryInMin: tokenExpiry,
+		Token:            t.Token,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(time.Duration(tokenExpiry) * time.Minute),
+		ReceiptExpiresAt: now.Add(getReceiptExpiry()),
+	}
+	switch t.State {
+	case "", PaymentReceiptStateInProgress:
+		model.Status = PaymentReceiptStatusInProgress
+	case PaymentReceiptStateCanceledByUser:
+		model.Status = PaymentReceiptStatusCanceledByUser
+		model.CancelledAt = &now
+	case PaymentReceiptStateFailed:
+		model.Status = PaymentReceiptStatusFailed
+		model.FailedAt = &now
+	case PaymentReceiptStateOK:
+		if t.CardNumber == "" {
+			return nil, fmt.Errorf("paid transaction %q must have a cardNumber", t.ResNum)
+		}
+		cardHashBinary := sha256.Sum256([]byte(t.CardNumber))
+		hashedCardNumber := hex.EncodeToString(cardHashBinary[:])
+		verifyDeadline := now.Add(getVerifyWindow())
+		reverseDeadline := now.Add(getReverseWindow())
+
+		model.Status = PaymentReceiptStatusOK
+		model.SubmittedAt = &now
+		model.PaidCardNumber = &t.CardNumber
+		model.HashedCardNumber = &hashedCardNumber
+		model.RefNum = &t.RefNum
+		model.Rrn = &t.Rrn
+		model.TraceNo = &t.TraceNo
+		model.TraceDate = &now
+		model.VerifyDeadline = &verifyDeadline
+		model.ReverseDeadline = &reverseDeadline
+		if t.Verified || t.Reversed {
+			model.VerifiedAt = &now
+		}
+		if t.Reversed {
+			model.ReversedAt = &now
+		}
+	default:
+		return nil, fmt.Errorf("transaction %q has unknown state %q", t.ResNum, t.State)
+	}
+	return model, nil
+}
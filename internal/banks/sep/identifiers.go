@@ -0,0 +1,385 @@
+package sep
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/abramad-labs/irbankmock/internal/banks/sep/managementerrors"
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/idgen"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const identifierKindToken = "token"
+const identifierKindPayment = "payment"
+
+const maxPreloadedIdentifiers = 1000
+
+// terminalGenerator returns the generator of the next identifiers of kind. A seeded
+// terminal counts them, so every token or payment continues the sequence of the seed
+// instead of repeating it. The count is never reset, not even when the seed changes,
+// so a seed used again doesn't hand out the identifiers of its earlier transactions.
+func terminalGenerator(tx *gorm.DB, terminalId int64, kind string) (idgen.Generator, error) {
+	column := kind + "_count"
+	query := tx.Where("id = ?", terminalId)
+	if conf.GetIdSeed() == "" {
+		// the terminals following the random identifiers of the server aren't counted,
+		// the seed is read first so they aren't written on every token and payment
+		var seeds []string
+		err := tx.Model(&BankSepTerminal{}).Where("id = ?", terminalId).Pluck("id_seed", &seeds).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(seeds) == 0 || seeds[0] == "" {
+			return idgen.Random, nil
+		}
+		query = query.Where("id_seed <> ''")
+	}
+	terminal := new(BankSepTerminal)
+	res := query.Model(terminal).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id_seed"}, {Name: column}}}).
+		UpdateColumn(column, gorm.Expr(column+" + 1"))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return idgen.Random, nil
+	}
+	if !dbutils.SupportsReturning(tx) {
+		err := tx.Select("id_seed", column).Where("id = ?", terminalId).Take(terminal).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	seed, count := terminal.IdSeed, terminal.TokenCount
+	if kind == identifierKindPayment {
+		count = terminal.PaymentCount
+	}
+	if seed == "" {
+		seed = conf.GetIdSeed()
+	}
+	return idgen.Seeded(seed, fmt.Sprintf("%d/%s/%d", terminalId, kind, count)), nil
+}
+
+// popPreloaded removes and returns the first preloaded identifier of kind, nil if
+// there is none.
+func popPreloaded(tx *gorm.DB, terminalId int64, kind string) (*BankSepPreloadedIdentifier, error) {
+	for {
+		var found []*BankSepPreloadedIdentifier
+		err := tx.Where("terminal_id = ? AND kind = ?", terminalId, kind).Order("id").Limit(1).Find(&found).Error
+		if err != nil || len(found) == 0 {
+			return nil, err
+		}
+		deleted := tx.Delete(found[0])
+		if deleted.Error != nil {
+			return nil, deleted.Error
+		}
+		// taken by a concurrent request otherwise
+		if deleted.RowsAffected > 0 {
+			return found[0], nil
+		}
+	}
+}
+
+func generateToken(tx *gorm.DB, terminalId int64) (string, error) {
+	gen, err := terminalGenerator(tx, terminalId, identifierKindToken)
+	if err != nil {
+		return "", err
+	}
+	return gen.UUID(), nil
+}
+
+func generatePaymentIdentifiers(tx *gorm.DB, terminalId int64) (*BankSepPaymentIdentifiers, error) {
+	gen, err := terminalGenerator(tx, terminalId, identifierKindPayment)
+	if err != nil {
+		return nil, err
+	}
+	return &BankSepPaymentIdentifiers{
+		Rrn:     gen.Int63(),
+		TraceNo: gen.Int63(),
+		RefNum:  gen.NanoID(),
+	}, nil
+}
+
+// nextToken returns the token of a new transaction of the terminal.
+func nextToken(tx *gorm.DB, terminalId int64) (string, error) {
+	preloaded, err := popPreloaded(tx, terminalId, identifierKindToken)
+	if err != nil {
+		return "", err
+	}
+	if preloaded != nil {
+		return preloaded.Token, nil
+	}
+	return generateToken(tx, terminalId)
+}
+
+// nextPaymentIdentifiers returns the rrn, trace number and reference number of a
+// payment to the terminal.
+func nextPaymentIdentifiers(tx *gorm.DB, terminalId int64) (*BankSepPaymentIdentifiers, error) {
+	preloaded, err := popPreloaded(tx, terminalId, identifierKindPayment)
+	if err != nil {
+		return nil, err
+	}
+	if preloaded != nil {
+		return &BankSepPaymentIdentifiers{
+			RefNum:  preloaded.RefNum,
+			Rrn:     preloaded.Rrn,
+			TraceNo: preloaded.TraceNo,
+		}, nil
+	}
+	return generatePaymentIdentifiers(tx, terminalId)
+}
+
+func identifiersUserError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return usererror.NewWithStatus(managementerrors.ErrTerminalNotFound, fiber.StatusNotFound)
+	case errors.Is(err, managementerrors.ErrInvalidIdentifierCount), errors.Is(err, managementerrors.ErrEmptyIdentifier),
+		errors.Is(err, managementerrors.ErrTooManyPreloadedIdentifiers):
+		return usererror.NewBadRequest(err)
+	case errors.Is(err, managementerrors.ErrDuplicateIdentifier):
+		return usererror.NewWithStatus(err, fiber.StatusConflict)
+	}
+	return err
+}
+
+// findRequestTerminal returns the terminal of the id path parameter in the namespace of
+// the request.
+func findRequestTerminal(c *fiber.Ctx, db *gorm.DB) (*BankSepTerminal, error) {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	terminal := new(BankSepTerminal)
+	err = db.Scopes(namespace.Scope(c)).Take(terminal, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return terminal, nil
+}
+
+func getIdentifiers(db *gorm.DB, terminal *BankSepTerminal) (*BankSepIdentifiersResponse, error) {
+	var preloaded []*BankSepPreloadedIdentifier
+	err := db.Where("terminal_id = ?", terminal.ID).Order("id").Find(&preloaded).Error
+	if err != nil {
+		return nil, err
+	}
+	resp := &BankSepIdentifiersResponse{
+		TerminalId: terminal.ID,
+		Seed:       terminal.IdSeed,
+		Seeded:     terminal.IdSeed != "" || conf.GetIdSeed() != "",
+		Tokens:     []string{},
+		Payments:   []BankSepPaymentIdentifiers{},
+	}
+	for _, p := range preloaded {
+		switch p.Kind {
+		case identifierKindToken:
+			resp.Tokens = append(resp.Tokens, p.Token)
+		case identifierKindPayment:
+			resp.Payments = append(resp.Payments, BankSepPaymentIdentifiers{RefNum: p.RefNum, Rrn: p.Rrn, TraceNo: p.TraceNo})
+		}
+	}
+	return resp, nil
+}
+
+func getTerminalIdentifiers(c *fiber.Ctx) (*BankSepIdentifiersResponse, error) {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return nil, err
+	}
+	terminal, err := findRequestTerminal(c, db)
+	if err != nil {
+		return nil, identifiersUserError(err)
+	}
+	return getIdentifiers(db, terminal)
+}
+
+// setIdentifierSeed changes the seed of the terminal. The preloaded identifiers are
+// dropped, they belong to the previous seed.
+func setIdentifierSeed(c *fiber.Ctx, req *BankSepSetIdentifierSeedRequest) (*BankSepIdentifiersResponse, error) {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return nil, err
+	}
+	var resp *BankSepIdentifiersResponse
+	err = db.Transaction(func(tx *gorm.DB) error {
+		terminal, err := findRequestTerminal(c, tx)
+		if err != nil {
+			return identifiersUserError(err)
+		}
+		terminal.IdSeed = strings.TrimSpace(req.Seed)
+		err = tx.Model(&BankSepTerminal{}).Where("id = ?", terminal.ID).Update("id_seed", terminal.IdSeed).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("terminal_id = ?", terminal.ID).Delete(&BankSepPreloadedIdentifier{}).Error
+		if err != nil {
+			return err
+		}
+		resp, err = getIdentifiers(tx, terminal)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// preloadIdentifiers queues the given identifiers of the terminal, followed by the
+// next count generated ones, so tests know them before the merchant receives them.
+func preloadIdentifiers(c *fiber.Ctx, req *BankSepPreloadIdentifiersRequest) (*BankSepIdentifiersResponse, error) {
+	if req.Count < 0 || req.Count+len(req.Tokens) > maxPreloadedIdentifiers ||
+		req.Count+len(req.Payments) > maxPreloadedIdentifiers {
+		return nil, identifiersUserError(managementerrors.ErrInvalidIdentifierCount)
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return nil, err
+	}
+	var resp *BankSepIdentifiersResponse
+	err = db.Transaction(func(tx *gorm.DB) error {
+		terminal, err := findRequestTerminal(c, tx)
+		if err != nil {
+			return identifiersUserError(err)
+		}
+		terminalId := int64(terminal.ID)
+
+		// the limit is of the queue, not of a single request
+		var queued []struct {
+			Kind  string
+			Count int
+		}
+		err = tx.Model(&BankSepPreloadedIdentifier{}).Select("kind, count(*) AS count").
+			Where("terminal_id = ?", terminalId).Group("kind").Scan(&queued).Error
+		if err != nil {
+			return err
+		}
+		queuedTokens, queuedPayments := req.Count+len(req.Tokens), req.Count+len(req.Payments)
+		for _, q := range queued {
+			switch q.Kind {
+			case identifierKindToken:
+				queuedTokens += q.Count
+			case identifierKindPayment:
+				queuedPayments += q.Count
+			}
+		}
+		if queuedTokens > maxPreloadedIdentifiers || queuedPayments > maxPreloadedIdentifiers {
+			return identifiersUserError(managementerrors.ErrTooManyPreloadedIdentifiers)
+		}
+
+		var preloaded []*BankSepPreloadedIdentifier
+		for _, token := range req.Tokens {
+			if strings.TrimSpace(token) == "" {
+				return identifiersUserError(managementerrors.ErrEmptyIdentifier)
+			}
+			preloaded = append(preloaded, &BankSepPreloadedIdentifier{
+				TerminalId: terminalId, Kind: identifierKindToken, Token: token,
+			})
+		}
+		for _, p := range req.Payments {
+			if strings.TrimSpace(p.RefNum) == "" {
+				return identifiersUserError(managementerrors.ErrEmptyIdentifier)
+			}
+			preloaded = append(preloaded, &BankSepPreloadedIdentifier{
+				TerminalId: terminalId, Kind: identifierKindPayment, RefNum: p.RefNum, Rrn: p.Rrn, TraceNo: p.TraceNo,
+			})
+		}
+		for range req.Count {
+			token, err := generateToken(tx, terminalId)
+			if err != nil {
+				return err
+			}
+			ids, err := generatePaymentIdentifiers(tx, terminalId)
+			if err != nil {
+				return err
+			}
+			preloaded = append(preloaded,
+				&BankSepPreloadedIdentifier{TerminalId: terminalId, Kind: identifierKindToken, Token: token},
+				&BankSepPreloadedIdentifier{
+					TerminalId: terminalId, Kind: identifierKindPayment, RefNum: ids.RefNum, Rrn: ids.Rrn, TraceNo: ids.TraceNo,
+				})
+		}
+		err = checkPreloadedUnique(tx, terminalId, preloaded)
+		if err != nil {
+			return identifiersUserError(err)
+		}
+		if len(preloaded) > 0 {
+			err = tx.Create(preloaded).Error
+			if err != nil {
+				return err
+			}
+		}
+		resp, err = getIdentifiers(tx, terminal)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// checkPreloadedUnique reports the first of the identifiers to preload that was
+// already handed out, is already preloaded or is given twice. Tokens are unique
+// across the terminals, reference numbers per terminal.
+func checkPreloadedUnique(tx *gorm.DB, terminalId int64, preloaded []*BankSepPreloadedIdentifier) error {
+	var tokens, refNums []string
+	seenTokens := map[string]bool{}
+	seenRefNums := map[string]bool{}
+	for _, p := range preloaded {
+		switch p.Kind {
+		case identifierKindToken:
+			if seenTokens[p.Token] {
+				return fmt.Errorf("%w: %s", managementerrors.ErrDuplicateIdentifier, p.Token)
+			}
+			seenTokens[p.Token] = true
+			tokens = append(tokens, p.Token)
+		case identifierKindPayment:
+			if seenRefNums[p.RefNum] {
+				return fmt.Errorf("%w: %s", managementerrors.ErrDuplicateIdentifier, p.RefNum)
+			}
+			seenRefNums[p.RefNum] = true
+			refNums = append(refNums, p.RefNum)
+		}
+	}
+
+	var taken []string
+	if len(tokens) > 0 {
+		err := tx.Model(&BankSepTransaction{}).Where("token IN ?", tokens).Limit(1).Pluck("token", &taken).Error
+		if err != nil {
+			return err
+		}
+		if len(taken) == 0 {
+			err = tx.Model(&BankSepPreloadedIdentifier{}).
+				Where("kind = ? AND token IN ?", identifierKindToken, tokens).Limit(1).Pluck("token", &taken).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(taken) == 0 && len(refNums) > 0 {
+		err := tx.Model(&BankSepTransaction{}).
+			Where("terminal_id = ? AND ref_num IN ?", terminalId, refNums).Limit(1).Pluck("ref_num", &taken).Error
+		if err != nil {
+			return err
+		}
+		if len(taken) == 0 {
+			err = tx.Model(&BankSepPreloadedIdentifier{}).
+				Where("terminal_id = ? AND kind = ? AND ref_num IN ?", terminalId, identifierKindPayment, refNums).
+				Limit(1).Pluck("ref_num", &taken).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(taken) > 0 {
+		return fmt.Errorf("%w: %s", managementerrors.ErrDuplicateIdentifier, taken[0])
+	}
+	return nil
+}
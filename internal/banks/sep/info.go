@@ -0,0 +1,33 @@
+package sep
+
+import (
+	"github.com/abramad-labs/irbankmock/internal/banks/registry"
+	"github.com/gofiber/fiber/v2"
+)
+
+// endpoint names match the fields of BankSepGetTerminalsResponseEndpoints
+var bankSepInfo = &registry.BankInfo{
+	Name:             BankSepName,
+	DisplayName:      "Saman",
+	PersianName:      "پرداخت الکترونیک سامان",
+	Logo:             "/logos/saman.svg",
+	ProtocolVersions: []string{"OnlinePG", "ipg/v2"},
+	DocumentationURL: "https://github.com/abramad-labs/irbankmock/blob/main/docs/SEP_OnlinePG_Merchant%20Document_Minimal_Current.pdf",
+	ManagementPage:   "/banks/saman/management",
+	Endpoints: []registry.Endpoint{
+		{Name: "paymentGateway", Method: fiber.MethodPost, Path: BankSepPathOnlinePaymentGateway,
+			Description: "request a token, or redirect the customer to the payment page with the Token form field"},
+		{Name: "paymentToken", Method: fiber.MethodGet, Path: BankSepPathOnlinePaymenyTokenRedirect,
+			Description: "payment page of a token, served by the web app"},
+		{Name: "receipt", Method: fiber.MethodPost, Path: BankSepPathGetReceipt},
+		{Name: "verifyTransaction", Method: fiber.MethodPost, Path: BankSepPathVerifyTransaction},
+		{Name: "reverseTransaction", Method: fiber.MethodPost, Path: BankSepPathReverseTransaction},
+	},
+	Capabilities: []registry.Capability{
+		registry.CapabilityTerminals,
+		registry.CapabilityPaymentPage,
+		registry.CapabilityTokenActions,
+		registry.CapabilityCommands,
+		registry.CapabilityFixtures,
+	},
+}
@@ -0,0 +1,50 @@
+package sep
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/clock"
+	"github.com/abramad-labs/irbankmock/internal/scheduler"
+	"gorm.io/gorm"
+)
+
+// expires the unpaid tokens as soon as they are due, so the subscribers are notified
+// even if nobody looks the token up again
+const expireTokenJobName = BankSepName + ".expireToken"
+
+// tokens kept alive by a frozen or rewound clock are checked again at this interval at
+// most, clock changes expire the due tokens right away anyway
+const expiryRecheckInterval = time.Minute
+
+type expireTokenPayload struct {
+	TransactionId uint64 `json:"transactionId"`
+}
+
+func registerJobs() {
+	scheduler.Register(&scheduler.Definition{
+		Name: expireTokenJobName,
+		Run: func(ctx context.Context, db *gorm.DB, payload []byte) error {
+			var p expireTokenPayload
+			err := json.Unmarshal(payload, &p)
+			if err != nil {
+				return err
+			}
+			// run now expires the token regardless of its time
+			remaining, err := expireTransaction(db, p.TransactionId, scheduler.IsRunNow(ctx))
+			if err != nil || remaining == nil {
+				return err
+			}
+			return scheduler.Schedule(db, expireTokenJobName, time.Now().Add(min(*remaining, expiryRecheckInterval)), &p)
+		},
+	})
+	clock.OnChange(expireDueTokens)
+}
+
+// scheduleExpiry schedules the expiry job of the token. now is the time of the clock
+// of the terminal, the job runs once the same duration has passed in real time.
+func scheduleExpiry(tx *gorm.DB, btrx *BankSepTransaction, now time.Time) error {
+	runAt := time.Now().Add(btrx.ExpiresAt.Sub(now))
+	return scheduler.Schedule(tx, expireTokenJobName, runAt, &expireTokenPayload{TransactionId: btrx.ID})
+}
@@ -10,3 +10,9 @@ var ErrTokenExpired = errors.New("token expired")
 var ErrTokenNoLongerAvailable = errors.New("token no longer available")
 
 var ErrTransactionNotFound = errors.New("transaction not found")
+
+var ErrTerminalNotFound = errors.New("terminal not found")
+var ErrInvalidIdentifierCount = errors.New("count must be between 0 and 1000")
+var ErrTooManyPreloadedIdentifiers = errors.New("at most 1000 tokens and 1000 payments can be preloaded per terminal")
+var ErrEmptyIdentifier = errors.New("preloaded tokens and refNums can't be empty")
+var ErrDuplicateIdentifier = errors.New("identifier was already handed out or preloaded")
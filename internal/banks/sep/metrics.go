@@ -0,0 +1,76 @@
+package sep
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/abramad-labs/irbankmock/internal/banks/sep/seperrors"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+var tokensIssued = metrics.NewCounterVec("irbankmock_saman_tokens_total",
+	"Token requests of merchants by terminal, result is issued or rejected.", "terminal", "result")
+var paymentOutcomes = metrics.NewCounterVec("irbankmock_saman_payments_total",
+	"Finished payments by terminal and outcome, the state reported to the merchant.", "terminal", "outcome")
+var verifyResults = metrics.NewCounterVec("irbankmock_saman_verify_total",
+	"Verify requests by terminal and result code.", "terminal", "result_code")
+var reverseResults = metrics.NewCounterVec("irbankmock_saman_reverse_total",
+	"Reverse requests by terminal and result code.", "terminal", "result_code")
+
+// counter returns the counter of the server handling the request, nil if the request
+// has no database.
+func counter(c *fiber.Ctx, v *metrics.CounterVec) *prometheus.CounterVec {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return nil
+	}
+	return v.With(db)
+}
+
+func countToken(c *fiber.Ctx, terminalId int64, err error) {
+	terminal := strconv.FormatInt(terminalId, 10)
+	if errors.Is(err, seperrors.ErrTerminalNotFound) {
+		// any number the merchant sends would be a new series
+		terminal = "unknown"
+	}
+	result := "issued"
+	if err != nil {
+		result = "rejected"
+	}
+	if tokens := counter(c, tokensIssued); tokens != nil {
+		tokens.WithLabelValues(terminal, result).Inc()
+	}
+}
+
+func countPayment(c *fiber.Ctx, resp *BankSepTokenFinalizeResponse) {
+	if resp == nil || resp.CallbackData == nil {
+		return
+	}
+	if payments := counter(c, paymentOutcomes); payments != nil {
+		payments.WithLabelValues(resp.CallbackData.TerminalId, resp.CallbackData.State).Inc()
+	}
+}
+
+// countExpiry is separate from countPayment since expiry has no merchant response.
+func countExpiry(db *gorm.DB, terminalId int64) {
+	paymentOutcomes.With(db).WithLabelValues(strconv.FormatInt(terminalId, 10), string(PaymentReceiptStateExpired)).Inc()
+}
+
+// resultTerminalNotFound is the result code of verify and reverse for terminals that
+// don't exist.
+const resultTerminalNotFound = -105
+
+func countResult(c *fiber.Ctx, v *metrics.CounterVec, terminalId int64, resultCode int32) {
+	terminal := strconv.FormatInt(terminalId, 10)
+	if resultCode == resultTerminalNotFound {
+		// like the rejected tokens, any number the merchant sends would be a new series
+		terminal = "unknown"
+	}
+	if results := counter(c, v); results != nil {
+		results.WithLabelValues(terminal, strconv.FormatInt(int64(resultCode), 10)).Inc()
+	}
+}
@@ -0,0 +1,239 @@
+package sep
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"gorm.io/gorm"
+)
+
+// the models as of their migrations, so the schema the migrations create doesn't change
+// along with the models
+
+type bankSepTerminal2025060201 struct {
+	ID        uint64 `gorm:"primarykey"`
+	Name      string
+	Username  string
+	Password  string
+	Namespace string `gorm:"size:64;not null;default:default;index"`
+}
+
+func (bankSepTerminal2025060201) TableName() string {
+	return "bank_sep_terminals"
+}
+
+type bankSepTransaction2025060201 struct {
+	ID                  uint64                    `gorm:"primarykey"`
+	TerminalId          int64                     `gorm:"index:,unique,composite:terminal_resnum_idx"`
+	Terminal            bankSepTerminal2025060201 `gorm:"foreignKey:TerminalId"`
+	Amount              int64
+	ResNum              string  `gorm:"size:50;index:,unique,composite:terminal_resnum_idx"`
+	ResNum1             *string `gorm:"size:50"`
+	ResNum2             *string `gorm:"size:50"`
+	ResNum3             *string `gorm:"size:50"`
+	ResNum4             *string `gorm:"size:50"`
+	RedirectURL         string  `gorm:"size:2083"`
+	Wage                *int64
+	AffectiveAmount     *int64
+	CellNumber          *string
+	TokenExpiryInMin    int `gorm:"check:token_expiry_in_min >= 20 AND token_expiry_in_min <= 3600"`
+	HashedCardNumber    *string
+	PaidCardNumber      *string
+	TxnRandomSessionKey *int64
+	Token               string
+	TraceNo             *int64
+	TraceDate           *time.Time
+	RefNum              *string
+	Rrn                 *int64
+	CancelledAt         *time.Time
+	FailedAt            *time.Time
+	SubmittedAt         *time.Time
+	VerifiedAt          *time.Time
+	ReversedAt          *time.Time
+	ExpiredAt           *time.Time
+	VerifyDeadline      *time.Time
+	ReverseDeadline     *time.Time
+	Status              int
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+	ReceiptExpiresAt    time.Time
+}
+
+func (bankSepTransaction2025060201) TableName() string {
+	return "bank_sep_transactions"
+}
+
+type bankSepTerminal2025060701 struct {
+	ID           uint64 `gorm:"primarykey"`
+	IdSeed       string `gorm:"size:128"`
+	TokenCount   uint64 `gorm:"not null;default:0"`
+	PaymentCount uint64 `gorm:"not null;default:0"`
+}
+
+func (bankSepTerminal2025060701) TableName() string {
+	return "bank_sep_terminals"
+}
+
+type bankSepPreloadedIdentifier2025060701 struct {
+	ID         uint64 `gorm:"primarykey"`
+	TerminalId int64  `gorm:"index"`
+	Kind       string `gorm:"size:16"`
+	Token      string
+	RefNum     string
+	Rrn        int64
+	TraceNo    int64
+}
+
+func (bankSepPreloadedIdentifier2025060701) TableName() string {
+	return "bank_sep_preloaded_identifiers"
+}
+
+type bankSepTransaction2025061101 struct {
+	ID         uint64  `gorm:"primarykey"`
+	TerminalId int64   `gorm:"index:,unique,composite:terminal_refnum_idx"`
+	Token      string  `gorm:"size:255;index:,unique"`
+	RefNum     *string `gorm:"size:255;index:,unique,composite:terminal_refnum_idx"`
+}
+
+func (bankSepTransaction2025061101) TableName() string {
+	return "bank_sep_transactions"
+}
+
+var transactionIdentifierIndexes = []string{
+	"idx_bank_sep_transactions_token",
+	"idx_bank_sep_transactions_terminal_refnum_idx",
+}
+
+var errDuplicateIdentifiers = errors.New("transactions share identifiers, remove the duplicates before migrating")
+
+// checkDuplicateIdentifiers names the tokens and reference numbers handed out twice,
+// the unique indexes on them can't be created otherwise.
+func checkDuplicateIdentifiers(tx *gorm.DB) error {
+	var tokens []string
+	err := tx.Model(&bankSepTransaction2025061101{}).Select("token").
+		Group("token").Having("COUNT(*) > 1").Order("token").Limit(10).Scan(&tokens).Error
+	if err != nil {
+		return err
+	}
+	var refNums []struct {
+		TerminalId int64
+		RefNum     string
+	}
+	err = tx.Model(&bankSepTransaction2025061101{}).Select("terminal_id, ref_num").Where("ref_num IS NOT NULL").
+		Group("terminal_id, ref_num").Having("COUNT(*) > 1").Order("terminal_id, ref_num").Limit(10).
+		Scan(&refNums).Error
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 && len(refNums) == 0 {
+		return nil
+	}
+	var duplicates []string
+	for _, t := range tokens {
+		duplicates = append(duplicates, "token "+t)
+	}
+	for _, r := range refNums {
+		duplicates = append(duplicates, fmt.Sprintf("refNum %s of terminal %d", r.RefNum, r.TerminalId))
+	}
+	return fmt.Errorf("%w: %s", errDuplicateIdentifiers, strings.Join(duplicates, ", "))
+}
+
+func registerMigrations() {
+	// databases of the releases before versioned migrations already have these tables,
+	// auto migrate only adds the missing columns there
+	migration.Register(&migration.Migration{
+		Version: 2025060201,
+		Name:    "create_samanbank_models",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(bankSepTerminal2025060201{}, bankSepTransaction2025060201{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(bankSepTransaction2025060201{}, bankSepTerminal2025060201{})
+		},
+	})
+
+	// tokens that expired before expired_at existed would otherwise notify the
+	// subscribers as soon as they are looked up after the upgrade
+	migration.Register(&migration.Migration{
+		Version: 2025060202,
+		Name:    "backfill_samanbank_expired_at",
+		Up: func(tx *gorm.DB) error {
+			return tx.Model(&bankSepTransaction2025060201{}).
+				Where("expired_at IS NULL AND status = ? AND expires_at < ?", PaymentReceiptStatusInProgress, time.Now()).
+				Update("expired_at", gorm.Expr("expires_at")).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	})
+
+	migration.Register(&migration.Migration{
+		Version: 2025060701,
+		Name:    "add_samanbank_identifiers",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(bankSepTerminal2025060701{}, bankSepPreloadedIdentifier2025060701{})
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropTable(bankSepPreloadedIdentifier2025060701{})
+			if err != nil {
+				return err
+			}
+			for _, column := range []string{"IdSeed", "TokenCount", "PaymentCount"} {
+				err = tx.Migrator().DropColumn(&bankSepTerminal2025060701{}, column)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+
+	// fails if a seed handed out an identifier twice before the sequences stopped
+	// starting over, such transactions have to be removed first. Mysql commits every
+	// schema change right away, so the steps are skipped once done and the migration
+	// can be retried.
+	migration.Register(&migration.Migration{
+		Version: 2025061101,
+		Name:    "add_samanbank_identifier_indexes",
+		Up: func(tx *gorm.DB) error {
+			err := checkDuplicateIdentifiers(tx)
+			if err != nil {
+				return err
+			}
+			// mysql can only index strings of a limited size
+			if tx.Dialector.Name() == "mysql" {
+				for _, column := range []string{"Token", "RefNum"} {
+					err := tx.Migrator().AlterColumn(&bankSepTransaction2025061101{}, column)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			for _, index := range transactionIdentifierIndexes {
+				if tx.Migrator().HasIndex(&bankSepTransaction2025061101{}, index) {
+					continue
+				}
+				err := tx.Migrator().CreateIndex(&bankSepTransaction2025061101{}, index)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, index := range transactionIdentifierIndexes {
+				if !tx.Migrator().HasIndex(&bankSepTransaction2025061101{}, index) {
+					continue
+				}
+				err := tx.Migrator().DropIndex(&bankSepTransaction2025061101{}, index)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"math/rand"
 	"net/url"
 	"strings"
 	"time"
@@ -15,22 +14,27 @@ import (
 	"github.com/abramad-labs/irbankmock/internal/banks/registry"
 	"github.com/abramad-labs/irbankmock/internal/banks/sep/managementerrors"
 	"github.com/abramad-labs/irbankmock/internal/banks/sep/seperrors"
-	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/clock"
 	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/eventbus"
+	"github.com/abramad-labs/irbankmock/internal/inspector"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
 	"github.com/abramad-labs/irbankmock/internal/pointers"
 	"github.com/abramad-labs/irbankmock/internal/security"
 	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/abramad-labs/irbankmock/internal/webhook"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	gonanoid "github.com/matoous/go-nanoid/v2"
 	"gorm.io/gorm"
 )
 
 func getTerminalEndpoints(ctx *fiber.Ctx) *BankSepGetTerminalsResponseEndpoints {
-	routerPrefix := registry.GetRouterPrefix(ctx)
-	fullPrefix := conf.GetPublicHostname() + routerPrefix
+	fullPrefix := registry.AbsoluteURL(ctx, registry.GetRouterPrefix(ctx))
 	return &BankSepGetTerminalsResponseEndpoints{
-		PaymentGateway:     fullPrefix + BankSepPathOnlinePaymentGateway,
+		PaymentGateway: fullPrefix + BankSepPathOnlinePaymentGateway,
+		// the namespaced path redirects to the payment page, which is only served
+		// outside the namespace prefix
 		PaymentToken:       fullPrefix + BankSepPathOnlinePaymenyTokenRedirect,
 		Receipt:            fullPrefix + BankSepPathGetReceipt,
 		VerifyTransaction:  fullPrefix + BankSepPathVerifyTransaction,
@@ -46,19 +50,14 @@ func getTerminals(ctx *fiber.Ctx) (*BankSepGetTerminalsResponse, error) {
 
 	var terminals []BankSepTerminal
 
-	err = db.Find(&terminals).Error
+	err = db.Scopes(namespace.Scope(ctx)).Find(&terminals).Error
 	if err != nil {
 		return nil, errors.New("failed to fetch terminals")
 	}
 
 	terminalResponse := make([]*BankSepTerminalResponse, len(terminals))
 	for i, t := range terminals {
-		terminalResponse[i] = &BankSepTerminalResponse{
-			ID:       t.ID,
-			Name:     t.Name,
-			Username: t.Username,
-			Password: t.Password,
-		}
+		terminalResponse[i] = newTerminalResponse(&t)
 	}
 
 	resp := &BankSepGetTerminalsResponse{
@@ -74,11 +73,15 @@ func createTerminal(ctx *fiber.Ctx, req *BankSepCreateTerminalRequest) (*BankSep
 		return nil, err
 	}
 
-	if strings.TrimSpace(req.Name) == "" {
+	return insertTerminal(db, namespace.Get(ctx), req.Name)
+}
+
+func insertTerminal(db *gorm.DB, ns string, name string) (*BankSepTerminalResponse, error) {
+	if strings.TrimSpace(name) == "" {
 		return nil, usererror.NewBadRequest(managementerrors.ErrEmptyName)
 	}
 
-	if security.StringHasInsecureCharacters(req.Name) {
+	if security.StringHasInsecureCharacters(name) {
 		return nil, usererror.NewBadRequest(managementerrors.ErrInvalidName)
 	}
 
@@ -86,21 +89,27 @@ func createTerminal(ctx *fiber.Ctx, req *BankSepCreateTerminalRequest) (*BankSep
 	password := uuid.NewString()
 
 	model := &BankSepTerminal{
-		Name:     req.Name,
-		Username: username,
-		Password: password,
+		Name:      name,
+		Username:  username,
+		Password:  password,
+		Namespace: ns,
 	}
 
-	err = db.Create(&model).Error
+	err := db.Create(&model).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed creating terminal: %w", err)
 	}
+	return newTerminalResponse(model), nil
+}
+
+func newTerminalResponse(t *BankSepTerminal) *BankSepTerminalResponse {
 	return &BankSepTerminalResponse{
-		ID:       model.ID,
-		Name:     model.Name,
-		Username: model.Username,
-		Password: model.Password,
-	}, nil
+		ID:        t.ID,
+		Name:      t.Name,
+		Username:  t.Username,
+		Password:  t.Password,
+		Namespace: t.Namespace,
+	}
 }
 
 func processTransactionRequest(ctx *fiber.Ctx, req *BankSepTransactionRequest) (*BankSepTransactionResponse, error) {
@@ -135,18 +144,18 @@ func processTransactionRequest(ctx *fiber.Ctx, req *BankSepTransactionRequest) (
 	}
 	req.TokenExpiryInMin = ClampTokenExpiryMinute(req.TokenExpiryInMin)
 
-	now := time.Now()
-
-	token := uuid.NewString()
+	now := clock.ForRequest(ctx).Now()
 
 	terminalId, err := req.TerminalId.Int64()
 	if err != nil {
 		return nil, seperrors.ErrTerminalNotFound
 	}
+	inspector.Link(ctx, terminalId, nil)
 
 	// TODO: do it in a transaction
 	var exists bool
 	err = db.Model(&BankSepTerminal{}).
+		Scopes(namespace.Scope(ctx)).
 		Select("count(*) > 0").
 		Where("id = ?", terminalId).
 		Find(&exists).
@@ -173,21 +182,45 @@ func processTransactionRequest(ctx *fiber.Ctx, req *BankSepTransactionRequest) (
 		TxnRandomSessionKey: req.TxnRandomSessionKey,
 		CreatedAt:           now,
 		ExpiresAt:           now.Add(time.Duration(req.TokenExpiryInMin) * time.Minute),
-		Token:               token,
-		ReceiptExpiresAt:    now.Add(time.Hour),
+		ReceiptExpiresAt:    now.Add(getReceiptExpiry()),
 	}
 
-	err = db.Create(&trxModel).Error
+	err = db.Transaction(func(tx *gorm.DB) error {
+		token, txErr := nextToken(tx, terminalId)
+		if txErr != nil {
+			return txErr
+		}
+		trxModel.Token = token
+		txErr = tx.Create(&trxModel).Error
+		if txErr != nil {
+			return txErr
+		}
+		publishTransactionEvent(tx, webhook.EventTokenCreated, trxModel.ID)
+		return scheduleExpiry(tx, trxModel, now)
+	})
 	if err != nil {
 		return nil, err
 	}
+	webhook.Wake()
+	inspector.Link(ctx, terminalId, &trxModel.ID)
 
 	return &BankSepTransactionResponse{
 		Status: 1,
-		Token:  token,
+		Token:  trxModel.Token,
 	}, nil
 }
 
+// transactionScope limits a query of transactions to the ones of the terminals of the
+// request namespace, so tokens of other namespaces can't be looked up or finished.
+func transactionScope(c *fiber.Ctx) func(db *gorm.DB) *gorm.DB {
+	ns := namespace.Get(c)
+	return func(db *gorm.DB) *gorm.DB {
+		terminals := db.Session(&gorm.Session{NewDB: true}).Model(&BankSepTerminal{}).
+			Select("id").Where("namespace = ?", ns)
+		return db.Where("terminal_id IN (?)", terminals)
+	}
+}
+
 func getPublicTokenInfo(c *fiber.Ctx, token string) (*BankSepPublicTokenInfoResponse, error) {
 	db, err := dbutils.GetDb(c)
 	if err != nil {
@@ -195,7 +228,7 @@ func getPublicTokenInfo(c *fiber.Ctx, token string) (*BankSepPublicTokenInfoResp
 	}
 	var tokenInfo BankSepTransaction
 	err = db.Model(&BankSepTransaction{}).Preload("Terminal").
-		Where("token = ?", token).Take(&tokenInfo).Error
+		Scopes(transactionScope(c)).Where("token = ?", token).Take(&tokenInfo).Error
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -204,7 +237,13 @@ func getPublicTokenInfo(c *fiber.Ctx, token string) (*BankSepPublicTokenInfoResp
 		return nil, err
 	}
 
-	if tokenInfo.ExpiresAt.Before(time.Now()) {
+	if tokenInfo.ExpiresAt.Before(clock.For(db, tokenInfo.Terminal.Namespace).Now()) {
+		if tokenInfo.Status == PaymentReceiptStatusInProgress && tokenInfo.ExpiredAt == nil {
+			_, err = expireTransaction(db, tokenInfo.ID, false)
+			if err != nil {
+				return nil, err
+			}
+		}
 		return nil, usererror.New(managementerrors.ErrTokenExpired)
 	}
 
@@ -229,7 +268,11 @@ func cancelToken(c *fiber.Ctx, req *BankSepCancelOrFailTokenRequest) (*BankSepTo
 
 	var btrx BankSepTransaction
 	err = db.Transaction(func(tx *gorm.DB) error {
-		txErr := tx.Model(&BankSepTransaction{}).Where("token = ?", req.Token).Take(&btrx).Error
+		txErr := tx.Model(&BankSepTransaction{}).Preload("Terminal").Scopes(transactionScope(c)).
+			Where("token = ?", req.Token).Take(&btrx).Error
+		if errors.Is(txErr, gorm.ErrRecordNotFound) {
+			return usererror.New(managementerrors.ErrTokenNotFound)
+		}
 		if txErr != nil {
 			return txErr
 		}
@@ -238,18 +281,20 @@ func cancelToken(c *fiber.Ctx, req *BankSepCancelOrFailTokenRequest) (*BankSepTo
 			return usererror.New(managementerrors.ErrTransactionNotFound)
 		}
 
-		txErr = tx.Model(btrx).Updates(map[string]any{
-			"cancelled_at": time.Now(),
-			"status":       PaymentReceiptStateCanceledByUser,
+		txErr = tx.Model(&BankSepTransaction{}).Where("id = ?", btrx.ID).Updates(map[string]any{
+			"cancelled_at": clock.For(tx, btrx.Terminal.Namespace).Now(),
+			"status":       PaymentReceiptStatusCanceledByUser,
 		}).Error
 		if txErr != nil {
 			return txErr
 		}
+		publishTransactionEvent(tx, webhook.EventPaymentCancelled, btrx.ID)
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	webhook.Wake()
 	url, err := url.Parse(btrx.RedirectURL)
 	if err != nil {
 		return nil, err
@@ -258,7 +303,7 @@ func cancelToken(c *fiber.Ctx, req *BankSepCancelOrFailTokenRequest) (*BankSepTo
 	query.Set("Token", req.Token)
 	url.RawQuery = query.Encode()
 
-	return &BankSepTokenFinalizeResponse{
+	resp := &BankSepTokenFinalizeResponse{
 		RedirectURL: url.String(),
 		CallbackData: &BankSepTokenFinalizeResponseCallbackData{
 			MID:        fmt.Sprint(btrx.TerminalId),
@@ -267,7 +312,9 @@ func cancelToken(c *fiber.Ctx, req *BankSepCancelOrFailTokenRequest) (*BankSepTo
 			State:      string(PaymentReceiptStateCanceledByUser),
 			Status:     fmt.Sprint(PaymentReceiptStatusCanceledByUser),
 		},
-	}, nil
+	}
+	publishFeedEvent(c, eventbus.TypePaymentFinalized, btrx.Terminal.Namespace, btrx.TerminalId, resp.CallbackData)
+	return resp, nil
 }
 
 func failToken(c *fiber.Ctx, req *BankSepCancelOrFailTokenRequest) (*BankSepTokenFinalizeResponse, error) {
@@ -278,7 +325,11 @@ func failToken(c *fiber.Ctx, req *BankSepCancelOrFailTokenRequest) (*BankSepToke
 
 	var btrx BankSepTransaction
 	err = db.Transaction(func(tx *gorm.DB) error {
-		txErr := tx.Model(&BankSepTransaction{}).Where("token = ?", req.Token).Take(&btrx).Error
+		txErr := tx.Model(&BankSepTransaction{}).Preload("Terminal").Scopes(transactionScope(c)).
+			Where("token = ?", req.Token).Take(&btrx).Error
+		if errors.Is(txErr, gorm.ErrRecordNotFound) {
+			return usererror.New(managementerrors.ErrTokenNotFound)
+		}
 		if txErr != nil {
 			return txErr
 		}
@@ -287,18 +338,20 @@ func failToken(c *fiber.Ctx, req *BankSepCancelOrFailTokenRequest) (*BankSepToke
 			return usererror.New(managementerrors.ErrTransactionNotFound)
 		}
 
-		txErr = tx.Model(btrx).Updates(map[string]any{
-			"failed_at": time.Now(),
+		txErr = tx.Model(&BankSepTransaction{}).Where("id = ?", btrx.ID).Updates(map[string]any{
+			"failed_at": clock.For(tx, btrx.Terminal.Namespace).Now(),
 			"status":    PaymentReceiptStatusFailed,
 		}).Error
 		if txErr != nil {
 			return txErr
 		}
+		publishTransactionEvent(tx, webhook.EventPaymentFailed, btrx.ID)
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	webhook.Wake()
 	url, err := url.Parse(btrx.RedirectURL)
 	if err != nil {
 		return nil, err
@@ -307,7 +360,7 @@ func failToken(c *fiber.Ctx, req *BankSepCancelOrFailTokenRequest) (*BankSepToke
 	query.Set("Token", req.Token)
 	url.RawQuery = query.Encode()
 
-	return &BankSepTokenFinalizeResponse{
+	resp := &BankSepTokenFinalizeResponse{
 		RedirectURL: url.String(),
 		CallbackData: &BankSepTokenFinalizeResponseCallbackData{
 			MID:        fmt.Sprint(btrx.TerminalId),
@@ -316,7 +369,9 @@ func failToken(c *fiber.Ctx, req *BankSepCancelOrFailTokenRequest) (*BankSepToke
 			State:      string(PaymentReceiptStateFailed),
 			Status:     fmt.Sprint(PaymentReceiptStatusFailed),
 		},
-	}, nil
+	}
+	publishFeedEvent(c, eventbus.TypePaymentFinalized, btrx.Terminal.Namespace, btrx.TerminalId, resp.CallbackData)
+	return resp, nil
 }
 
 func submitToken(c *fiber.Ctx, req *BankSepSubmitTokenRequest) (*BankSepTokenFinalizeResponse, error) {
@@ -326,17 +381,16 @@ func submitToken(c *fiber.Ctx, req *BankSepSubmitTokenRequest) (*BankSepTokenFin
 	}
 
 	var btrx BankSepTransaction
-	rrn := rand.Int63()
-	traceNo := rand.Int63()
-	refNum, err := gonanoid.New()
-	if err != nil {
-		return nil, err
-	}
+	var ids *BankSepPaymentIdentifiers
 	cardHashBinary := sha256.Sum256([]byte(req.CardNumber))
 	hashedCardNumber := hex.EncodeToString(cardHashBinary[:])
 
 	err = db.Transaction(func(tx *gorm.DB) error {
-		txErr := tx.Model(&BankSepTransaction{}).Where("token = ?", req.Token).Take(&btrx).Error
+		txErr := tx.Model(&BankSepTransaction{}).Preload("Terminal").Scopes(transactionScope(c)).
+			Where("token = ?", req.Token).Take(&btrx).Error
+		if errors.Is(txErr, gorm.ErrRecordNotFound) {
+			return usererror.New(managementerrors.ErrTokenNotFound)
+		}
 		if txErr != nil {
 			return txErr
 		}
@@ -345,20 +399,24 @@ func submitToken(c *fiber.Ctx, req *BankSepSubmitTokenRequest) (*BankSepTokenFin
 			return usererror.New(managementerrors.ErrTransactionNotFound)
 		}
 
-		now := time.Now()
+		now := clock.For(tx, btrx.Terminal.Namespace).Now()
+		ids, txErr = nextPaymentIdentifiers(tx, btrx.TerminalId)
+		if txErr != nil {
+			return txErr
+		}
 
 		update := tx.Model(&BankSepTransaction{}).
 			Where("id = ?", btrx.ID).
 			Updates(map[string]any{
 				"status":             PaymentReceiptStatusOK,
-				"rrn":                rrn,
-				"ref_num":            refNum,
+				"rrn":                ids.Rrn,
+				"ref_num":            ids.RefNum,
 				"submitted_at":       now,
-				"verify_deadline":    now.Add(30 * time.Minute),
-				"reverse_deadline":   now.Add(50 * time.Minute),
+				"verify_deadline":    now.Add(getVerifyWindow()),
+				"reverse_deadline":   now.Add(getReverseWindow()),
 				"paid_card_number":   req.CardNumber,
 				"hashed_card_number": hashedCardNumber,
-				"trace_no":           traceNo,
+				"trace_no":           ids.TraceNo,
 				"trace_date":         now,
 			})
 		if update.Error != nil {
@@ -367,29 +425,32 @@ func submitToken(c *fiber.Ctx, req *BankSepSubmitTokenRequest) (*BankSepTokenFin
 		if update.RowsAffected == 0 {
 			return usererror.New(managementerrors.ErrTransactionNotFound)
 		}
+		publishTransactionEvent(tx, webhook.EventPaymentPaid, btrx.ID)
 
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	webhook.Wake()
 	url, err := url.Parse(btrx.RedirectURL)
 	if err != nil {
 		return nil, err
 	}
 	query := url.Query()
 	query.Set("Token", req.Token)
-	query.Set("RefNum", refNum)
+	query.Set("RefNum", ids.RefNum)
 	url.RawQuery = query.Encode()
 
-	return &BankSepTokenFinalizeResponse{
+	resp := &BankSepTokenFinalizeResponse{
 		RedirectURL: url.String(),
 		CallbackData: &BankSepTokenFinalizeResponseCallbackData{
 			MID:              fmt.Sprint(btrx.TerminalId),
 			TerminalId:       fmt.Sprint(btrx.TerminalId),
 			Token:            req.Token,
-			RefNum:           refNum,
-			Rrn:              fmt.Sprint(rrn),
+			RefNum:           ids.RefNum,
+			Rrn:              fmt.Sprint(ids.Rrn),
+			TraceNo:          fmt.Sprint(ids.TraceNo),
 			State:            string(PaymentReceiptStateOK),
 			Status:           fmt.Sprint(PaymentReceiptStatusOK),
 			ResNum:           btrx.ResNum,
@@ -397,7 +458,9 @@ func submitToken(c *fiber.Ctx, req *BankSepSubmitTokenRequest) (*BankSepTokenFin
 			HashedCardNumber: hashedCardNumber,
 			SecurePan:        maskThirdQuarter(req.CardNumber),
 		},
-	}, nil
+	}
+	publishFeedEvent(c, eventbus.TypePaymentFinalized, btrx.Terminal.Namespace, btrx.TerminalId, resp.CallbackData)
+	return resp, nil
 }
 
 func getReceipt(c *fiber.Ctx, terminalId int64, refNum *string, token *string, rndSessionKey *int64, rrn *int64) (*BankSepGetReceiptResponse, error) {
@@ -405,9 +468,10 @@ func getReceipt(c *fiber.Ctx, terminalId int64, refNum *string, token *string, r
 	if err != nil {
 		return nil, err
 	}
+	inspector.Link(c, terminalId, nil)
 
 	var terminal BankSepTerminal
-	err = db.Model(&BankSepTerminal{}).Where("id = ?", terminalId).Take(&terminal).Error
+	err = db.Model(&BankSepTerminal{}).Scopes(namespace.Scope(c)).Where("id = ?", terminalId).Take(&terminal).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return &BankSepGetReceiptResponse{
@@ -457,7 +521,8 @@ func getReceipt(c *fiber.Ctx, terminalId int64, refNum *string, token *string, r
 			ErrorMessage: err.Error(),
 		}, nil
 	}
-	if tx.ReceiptExpiresAt.Before(time.Now()) {
+	inspector.Link(c, terminalId, &tx.ID)
+	if tx.ReceiptExpiresAt.Before(clock.ForRequest(c).Now()) {
 		return &BankSepGetReceiptResponse{
 			HasError:     true,
 			ErrorCode:    404,
@@ -487,14 +552,20 @@ func getReceipt(c *fiber.Ctx, terminalId int64, refNum *string, token *string, r
 	}, nil
 }
 
+// errConcurrentUpdate rolls back the verify or reverse that a concurrent request of
+// the same transaction already made.
+var errConcurrentUpdate = errors.New("transaction was updated concurrently")
+
 func verifyTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSepVerificationResponse, error) {
 	db, err := dbutils.GetDb(c)
 	if err != nil {
 		return nil, err
 	}
+	inspector.Link(c, terminalId, nil)
 
 	var terminalExists bool
 	err = db.Model(&BankSepTerminal{}).
+		Scopes(namespace.Scope(c)).
 		Select("count(*) > 0").
 		Where("id = ?", terminalId).
 		Find(&terminalExists).
@@ -511,7 +582,7 @@ func verifyTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSepV
 	if !terminalExists {
 		return &BankSepVerificationResponse{
 			Success:           false,
-			ResultCode:        -105,
+			ResultCode:        resultTerminalNotFound,
 			ResultDescription: "ترمینال ارسالی در سیستم موجود نمی باشد.",
 		}, nil
 	}
@@ -533,6 +604,8 @@ func verifyTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSepV
 		}, nil
 	}
 
+	inspector.Link(c, terminalId, &btx.ID)
+
 	if btx.Status != PaymentReceiptStatusOK {
 		return &BankSepVerificationResponse{
 			Success:           false,
@@ -541,7 +614,8 @@ func verifyTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSepV
 		}, nil
 	}
 
-	if btx.VerifyDeadline.Before(time.Now()) {
+	now := clock.ForRequest(c).Now()
+	if btx.VerifyDeadline.Before(now) {
 		return &BankSepVerificationResponse{
 			Success:           false,
 			ResultCode:        -6,
@@ -565,30 +639,40 @@ func verifyTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSepV
 		}, nil
 	}
 
-	now := time.Now()
-
-	update := db.Model(&BankSepTransaction{}).Where("id = ?", btx.ID).Update("verified_at", now)
-
-	if update.Error != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// a concurrent verify of the same transaction updates nothing, so the subscribers
+		// are notified once
+		update := tx.Model(&BankSepTransaction{}).Where("id = ? AND verified_at IS NULL", btx.ID).Update("verified_at", now)
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errConcurrentUpdate
+		}
+		publishTransactionEvent(tx, webhook.EventPaymentVerified, btx.ID)
+		return nil
+	})
+	if errors.Is(err, errConcurrentUpdate) {
 		return &BankSepVerificationResponse{
 			Success:           false,
-			ResultCode:        -1,
-			ResultDescription: update.Error.Error(),
+			ResultCode:        2,
+			ResultDescription: "درخواست تکراری می باشد.",
 		}, nil
 	}
-	if update.RowsAffected == 0 {
+	if err != nil {
 		return &BankSepVerificationResponse{
 			Success:           false,
-			ResultCode:        -2,
-			ResultDescription: "تراکنش یافت نشد",
+			ResultCode:        -1,
+			ResultDescription: err.Error(),
 		}, nil
 	}
+	webhook.Wake()
 
 	return &BankSepVerificationResponse{
 		Success:           true,
 		ResultDescription: "عملیات با موفقیت انجام شد.",
 		TransactionDetail: &BankSepTransactionDetailResponse{
-			RRN:            fmt.Sprint(btx.Rrn),
+			RRN:            fmt.Sprint(pointers.DerefZero(btx.Rrn)),
 			RefNum:         pointers.DerefZero(btx.RefNum),
 			MaskedPan:      maskThirdQuarter(*btx.PaidCardNumber),
 			HashedPan:      pointers.DerefZero(btx.HashedCardNumber),
@@ -612,9 +696,11 @@ func reverseTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSep
 	if err != nil {
 		return nil, err
 	}
+	inspector.Link(c, terminalId, nil)
 
 	var terminalExists bool
 	err = db.Model(&BankSepTerminal{}).
+		Scopes(namespace.Scope(c)).
 		Select("count(*) > 0").
 		Where("id = ?", terminalId).
 		Find(&terminalExists).
@@ -631,7 +717,7 @@ func reverseTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSep
 	if !terminalExists {
 		return &BankSepReverseResponse{
 			Success:           false,
-			ResultCode:        -105,
+			ResultCode:        resultTerminalNotFound,
 			ResultDescription: "ترمینال ارسالی در سیستم موجود نمی باشد.",
 		}, nil
 	}
@@ -653,6 +739,8 @@ func reverseTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSep
 		}, nil
 	}
 
+	inspector.Link(c, terminalId, &btx.ID)
+
 	if btx.Status != PaymentReceiptStatusOK {
 		return &BankSepReverseResponse{
 			Success:           false,
@@ -661,7 +749,8 @@ func reverseTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSep
 		}, nil
 	}
 
-	if btx.ReverseDeadline.Before(time.Now()) {
+	now := clock.ForRequest(c).Now()
+	if btx.ReverseDeadline.Before(now) {
 		return &BankSepReverseResponse{
 			Success:           false,
 			ResultCode:        -6,
@@ -685,30 +774,39 @@ func reverseTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSep
 		}, nil
 	}
 
-	now := time.Now()
-
-	update := db.Model(&BankSepTransaction{}).Where("id = ?", btx.ID).Update("reversed_at", now)
-
-	if update.Error != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		update := tx.Model(&BankSepTransaction{}).Where("id = ? AND reversed_at IS NULL", btx.ID).Update("reversed_at", now)
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errConcurrentUpdate
+		}
+		publishTransactionEvent(tx, webhook.EventPaymentReversed, btx.ID)
+		return nil
+	})
+	if errors.Is(err, errConcurrentUpdate) {
+		// reversed by a concurrent request
 		return &BankSepReverseResponse{
 			Success:           false,
-			ResultCode:        -1,
-			ResultDescription: update.Error.Error(),
+			ResultCode:        5,
+			ResultDescription: "تراکنش برگشت خورده می باشد.",
 		}, nil
 	}
-	if update.RowsAffected == 0 {
+	if err != nil {
 		return &BankSepReverseResponse{
 			Success:           false,
-			ResultCode:        -2,
-			ResultDescription: "تراکنش یافت نشد",
+			ResultCode:        -1,
+			ResultDescription: err.Error(),
 		}, nil
 	}
+	webhook.Wake()
 
 	return &BankSepReverseResponse{
 		Success:           true,
 		ResultDescription: "عملیات با موفقیت انجام شد.",
 		TransactionDetail: &BankSepTransactionDetailResponse{
-			RRN:            fmt.Sprint(btx.Rrn),
+			RRN:            fmt.Sprint(pointers.DerefZero(btx.Rrn)),
 			RefNum:         pointers.DerefZero(btx.RefNum),
 			MaskedPan:      maskThirdQuarter(*btx.PaidCardNumber),
 			HashedPan:      pointers.DerefZero(btx.HashedCardNumber),
@@ -726,3 +824,118 @@ func reverseTransaction(c *fiber.Ctx, terminalId int64, refNum string) (*BankSep
 		},
 	}, nil
 }
+
+func resetData(tx *gorm.DB, opts snapshot.ResetOptions) error {
+	err := tx.Where("1 = 1").Delete(&BankSepTransaction{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("1 = 1").Delete(&BankSepPreloadedIdentifier{}).Error
+	if err != nil {
+		return err
+	}
+	if opts.KeepTerminals {
+		// the kept terminals go on with their seeded identifiers, the merchants may
+		// still hold the ones handed out before the reset
+		return nil
+	}
+	return tx.Where("1 = 1").Delete(&BankSepTerminal{}).Error
+}
+
+func destroyNamespace(tx *gorm.DB, ns string) error {
+	terminals := tx.Model(&BankSepTerminal{}).Select("id").Where("namespace = ?", ns)
+	err := tx.Where("terminal_id IN (?)", terminals).Delete(&BankSepTransaction{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("terminal_id IN (?)", terminals).Delete(&BankSepPreloadedIdentifier{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("namespace = ?", ns).Delete(&BankSepTerminal{}).Error
+}
+
+// expireTransaction records the expiry of an unpaid token, only the first call
+// notifies the subscribers. It reports when the token is still pending and when it's
+// due by the clock of its namespace, so the caller can check it again later.
+func expireTransaction(db *gorm.DB, transactionId uint64, force bool) (*time.Duration, error) {
+	var terminalId int64
+	var remaining *time.Duration
+	expired := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var btrx BankSepTransaction
+		txErr := tx.Preload("Terminal").Take(&btrx, transactionId).Error
+		if errors.Is(txErr, gorm.ErrRecordNotFound) {
+			// removed by a reset or along with its namespace
+			return nil
+		}
+		if txErr != nil {
+			return txErr
+		}
+		if btrx.Status != PaymentReceiptStatusInProgress || btrx.ExpiredAt != nil {
+			return nil
+		}
+		now := clock.For(tx, btrx.Terminal.Namespace).Now()
+		expiry := map[string]any{"expired_at": now}
+		if btrx.ExpiresAt.After(now) {
+			if !force {
+				left := btrx.ExpiresAt.Sub(now)
+				remaining = &left
+				return nil
+			}
+			expiry["expires_at"] = now
+		}
+
+		update := tx.Model(&BankSepTransaction{}).
+			Where("id = ? AND expired_at IS NULL AND status = ?", transactionId, PaymentReceiptStatusInProgress).
+			Updates(expiry)
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return nil
+		}
+		terminalId = btrx.TerminalId
+		expired = true
+		publishTransactionEvent(tx, webhook.EventPaymentExpired, transactionId)
+		return nil
+	})
+	if err == nil && expired {
+		countExpiry(db, terminalId)
+		// too early if a clock change expired the token, it wakes the dispatcher
+		// again once it committed
+		webhook.Wake()
+	}
+	return remaining, err
+}
+
+// expireDueTokens expires the unpaid tokens that became due by a change of the clock
+// of scope, without waiting for their expiry jobs.
+func expireDueTokens(tx *gorm.DB, scope string) error {
+	query := tx.Model(&BankSepTransaction{}).Preload("Terminal").
+		Where("expired_at IS NULL AND status = ?", PaymentReceiptStatusInProgress)
+	if scope != clock.Global {
+		terminals := tx.Model(&BankSepTerminal{}).Select("id").Where("namespace = ?", scope)
+		query = query.Where("terminal_id IN (?)", terminals)
+	}
+	var pending []*BankSepTransaction
+	err := query.Find(&pending).Error
+	if err != nil {
+		return err
+	}
+	clocks := map[string]clock.Clock{}
+	for _, btrx := range pending {
+		ns := btrx.Terminal.Namespace
+		if _, ok := clocks[ns]; !ok {
+			clocks[ns] = clock.For(tx, ns)
+		}
+		if btrx.ExpiresAt.After(clocks[ns].Now()) {
+			continue
+		}
+		_, err = expireTransaction(tx, btrx.ID, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
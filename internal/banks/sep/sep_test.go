@@ -0,0 +1,844 @@
+package sep_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/banks/sep"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/dbtest"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/fixtures"
+	"github.com/abramad-labs/irbankmock/internal/inspector"
+	"github.com/abramad-labs/irbankmock/internal/management"
+	"github.com/abramad-labs/irbankmock/internal/scheduler"
+	"github.com/abramad-labs/irbankmock/internal/server"
+	"github.com/abramad-labs/irbankmock/internal/webhook"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const prefix = "/banks/" + sep.BankSepName
+
+func newApp(t *testing.T) *fiber.App {
+	t.Helper()
+	app, _ := openApp(t)
+	return app
+}
+
+// openApp returns the app along with its database, for the tests that look at the
+// state the api doesn't show.
+func openApp(t *testing.T) (*fiber.App, *gorm.DB) {
+	t.Helper()
+	db := dbtest.Open(t)
+	_, err := migration.Up(db, migration.UpOptions{})
+	if err != nil {
+		t.Fatalf("migrations failed: %v", err)
+	}
+	return server.NewApp(db, server.Options{DisableStartupMessage: true}), db
+}
+
+// send sends body as json, decodes the response into resp unless it's nil and returns
+// the status.
+func send(t *testing.T, app *fiber.App, method string, path string, body any, resp any) int {
+	t.Helper()
+	content, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(content))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer res.Body.Close()
+	if resp != nil {
+		err = json.NewDecoder(res.Body).Decode(resp)
+		if err != nil {
+			t.Fatalf("%s %s responded with invalid json: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// post sends body as json and decodes the response into resp, failing the test unless
+// the status is 200.
+func post(t *testing.T, app *fiber.App, path string, body any, resp any) {
+	t.Helper()
+	status := send(t, app, http.MethodPost, path, body, resp)
+	if status != http.StatusOK {
+		t.Fatalf("POST %s responded with %d", path, status)
+	}
+}
+
+func TestTokenSubmitVerifyReverse(t *testing.T) {
+	app := newApp(t)
+
+	terminal := new(sep.BankSepTerminalResponse)
+	post(t, app, prefix+"/management/terminal", &sep.BankSepCreateTerminalRequest{Name: "shop"}, terminal)
+	terminalNumber := json.Number(strconv.FormatUint(terminal.ID, 10))
+
+	token := new(sep.BankSepTransactionResponse)
+	post(t, app, prefix+sep.BankSepPathOnlinePaymentGateway, &sep.BankSepTransactionRequest{
+		Action:      "token",
+		TerminalId:  terminalNumber,
+		Amount:      120000,
+		ResNum:      "order-1",
+		RedirectURL: "http://shop.test/callback",
+	}, token)
+	if token.Status != 1 || token.Token == "" {
+		t.Fatalf("token request failed with %s: %s", token.ErrorCode, token.ErrorDesc)
+	}
+
+	payment := new(sep.BankSepTokenFinalizeResponse)
+	post(t, app, prefix+"/management/token/submit", &sep.BankSepSubmitTokenRequest{
+		Token:        token.Token,
+		CardNumber:   "6037990000000006",
+		Cvv:          123,
+		ExpiryMonth:  12,
+		ExpiryYear:   9,
+		CardPassword: "12345",
+	}, payment)
+	callback := payment.CallbackData
+	if callback == nil {
+		t.Fatal("submit returned no callback data")
+	}
+	if callback.ResNum != "order-1" || callback.RefNum == "" || callback.Rrn == "" || callback.TraceNo == "" {
+		t.Fatalf("callback data is incomplete: %+v", callback)
+	}
+
+	verification := new(sep.BankSepVerificationResponse)
+	post(t, app, prefix+sep.BankSepPathVerifyTransaction, &sep.BankSepVerificationRequest{
+		RefNum:         callback.RefNum,
+		TerminalNumber: terminalNumber,
+	}, verification)
+	if !verification.Success || verification.TransactionDetail == nil {
+		t.Fatalf("verify failed with %d: %s", verification.ResultCode, verification.ResultDescription)
+	}
+	detail := verification.TransactionDetail
+	if detail.RefNum != callback.RefNum || detail.RRN != callback.Rrn || detail.OrginalAmount != 120000 {
+		t.Errorf("verified transaction %+v doesn't match the callback %+v", detail, callback)
+	}
+
+	reverse := new(sep.BankSepReverseResponse)
+	post(t, app, prefix+sep.BankSepPathReverseTransaction, &sep.BankSepReverseRequest{
+		RefNum:         callback.RefNum,
+		TerminalNumber: terminalNumber,
+	}, reverse)
+	if !reverse.Success {
+		t.Fatalf("reverse failed with %d: %s", reverse.ResultCode, reverse.ResultDescription)
+	}
+
+	again := new(sep.BankSepReverseResponse)
+	post(t, app, prefix+sep.BankSepPathReverseTransaction, &sep.BankSepReverseRequest{
+		RefNum:         callback.RefNum,
+		TerminalNumber: terminalNumber,
+	}, again)
+	if again.Success {
+		t.Error("a reversed transaction was reversed again")
+	}
+}
+
+func TestIdentifierIndexesNameDuplicates(t *testing.T) {
+	db := dbtest.Open(t)
+	_, err := migration.Up(db, migration.UpOptions{Target: 2025060701})
+	if err != nil {
+		t.Fatalf("migrations failed: %v", err)
+	}
+	err = db.Exec("INSERT INTO bank_sep_terminals (id, name) VALUES (1, 'shop')").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, resNum := range []string{"order-1", "order-2"} {
+		err = db.Exec("INSERT INTO bank_sep_transactions (id, terminal_id, res_num, token, ref_num, token_expiry_in_min) VALUES (?, 1, ?, 'same-token', 'same-ref', 20)",
+			i+1, resNum).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = migration.Up(db, migration.UpOptions{})
+	if err == nil || !strings.Contains(err.Error(), "token same-token") || !strings.Contains(err.Error(), "refNum same-ref of terminal 1") {
+		t.Fatalf("up didn't name the duplicates: %v", err)
+	}
+
+	err = db.Exec("DELETE FROM bank_sep_transactions WHERE id = 2").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migration.Up(db, migration.UpOptions{})
+	if err != nil {
+		t.Fatalf("up failed once the duplicates were removed: %v", err)
+	}
+}
+
+// nsPrefix is the prefix of the bank routes in the namespace.
+func nsPrefix(ns string) string {
+	return "/ns/" + ns + prefix
+}
+
+// createTerminal creates a terminal under the bank prefix base and returns its id as
+// sent by merchants.
+func createTerminal(t *testing.T, app *fiber.App, base string) (uint64, json.Number) {
+	t.Helper()
+	terminal := new(sep.BankSepTerminalResponse)
+	post(t, app, base+"/management/terminal", &sep.BankSepCreateTerminalRequest{Name: "shop"}, terminal)
+	return terminal.ID, json.Number(strconv.FormatUint(terminal.ID, 10))
+}
+
+func requestToken(t *testing.T, app *fiber.App, base string, terminalNumber json.Number, resNum string) string {
+	t.Helper()
+	token := new(sep.BankSepTransactionResponse)
+	post(t, app, base+sep.BankSepPathOnlinePaymentGateway, &sep.BankSepTransactionRequest{
+		Action:      "token",
+		TerminalId:  terminalNumber,
+		Amount:      120000,
+		ResNum:      resNum,
+		RedirectURL: "http://shop.test/callback",
+	}, token)
+	if token.Status != 1 {
+		t.Fatalf("token request failed with %s: %s", token.ErrorCode, token.ErrorDesc)
+	}
+	return token.Token
+}
+
+func pay(t *testing.T, app *fiber.App, base string, token string) *sep.BankSepTokenFinalizeResponseCallbackData {
+	t.Helper()
+	payment := new(sep.BankSepTokenFinalizeResponse)
+	post(t, app, base+"/management/token/submit", &sep.BankSepSubmitTokenRequest{
+		Token:        token,
+		CardNumber:   "6037990000000006",
+		Cvv:          123,
+		ExpiryMonth:  12,
+		ExpiryYear:   9,
+		CardPassword: "12345",
+	}, payment)
+	if payment.CallbackData == nil {
+		t.Fatal("submit returned no callback data")
+	}
+	return payment.CallbackData
+}
+
+func setSeed(t *testing.T, app *fiber.App, terminalId uint64, seed string) {
+	t.Helper()
+	path := prefix + "/management/terminal/" + strconv.FormatUint(terminalId, 10) + "/identifiers"
+	status := send(t, app, http.MethodPut, path, &sep.BankSepSetIdentifierSeedRequest{Seed: seed}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("setting the seed responded with %d", status)
+	}
+}
+
+func TestSeededIdentifiers(t *testing.T) {
+	app := newApp(t)
+	terminalId, terminalNumber := createTerminal(t, app, prefix)
+	setSeed(t, app, terminalId, "checkout-test")
+
+	// the values are part of the contract, tests of merchants assert them
+	token := requestToken(t, app, prefix, terminalNumber, "order-1")
+	if token != "3cfbe73d-c6ac-44a1-9fec-5f8fe02a1b2e" {
+		t.Errorf("the seeded token is %s", token)
+	}
+	callback := pay(t, app, prefix, token)
+	if callback.RefNum != "hcZ6tcqd2nM33Bg66TXyh" || callback.Rrn != "5861305912890857110" || callback.TraceNo != "8424362548929789159" {
+		t.Errorf("the seeded payment identifiers are %s, %s and %s", callback.RefNum, callback.Rrn, callback.TraceNo)
+	}
+
+	// the sequence goes on when the same seed is set again, the identifiers of the
+	// transactions already made aren't handed out twice
+	setSeed(t, app, terminalId, "checkout-test")
+	next := requestToken(t, app, prefix, terminalNumber, "order-2")
+	if next == token {
+		t.Errorf("the token %s was handed out again", token)
+	}
+	if next != "c753d7b1-560b-49e6-ac7e-d5243c7ad348" {
+		t.Errorf("the second seeded token is %s", next)
+	}
+	if callback := pay(t, app, prefix, next); callback.RefNum == "hcZ6tcqd2nM33Bg66TXyh" {
+		t.Errorf("the reference number %s was handed out again", callback.RefNum)
+	}
+}
+
+func TestPreloadedIdentifiers(t *testing.T) {
+	app := newApp(t)
+	terminalId, terminalNumber := createTerminal(t, app, prefix)
+	setSeed(t, app, terminalId, "checkout-test")
+	path := prefix + "/management/terminal/" + strconv.FormatUint(terminalId, 10) + "/identifiers"
+
+	preloaded := new(sep.BankSepIdentifiersResponse)
+	post(t, app, path, &sep.BankSepPreloadIdentifiersRequest{
+		Count:    1,
+		Tokens:   []string{"token-a", "token-b"},
+		Payments: []sep.BankSepPaymentIdentifiers{{RefNum: "ref-a", Rrn: 1, TraceNo: 2}},
+	}, preloaded)
+	if len(preloaded.Tokens) != 3 || len(preloaded.Payments) != 2 {
+		t.Fatalf("preloaded %d tokens and %d payments, want 3 and 2", len(preloaded.Tokens), len(preloaded.Payments))
+	}
+	// the count generates the identifiers the seed would hand out next
+	if preloaded.Tokens[2] != "3cfbe73d-c6ac-44a1-9fec-5f8fe02a1b2e" {
+		t.Errorf("the generated token is %s", preloaded.Tokens[2])
+	}
+
+	for i, want := range preloaded.Tokens {
+		token := requestToken(t, app, prefix, terminalNumber, "order-"+strconv.Itoa(i))
+		if token != want {
+			t.Errorf("token %d is %s, want %s", i, token, want)
+		}
+		if i < len(preloaded.Payments) {
+			callback := pay(t, app, prefix, token)
+			if callback.RefNum != preloaded.Payments[i].RefNum {
+				t.Errorf("reference number %d is %s, want %s", i, callback.RefNum, preloaded.Payments[i].RefNum)
+			}
+		}
+	}
+
+	for _, req := range []*sep.BankSepPreloadIdentifiersRequest{
+		// handed out already
+		{Tokens: []string{"token-a"}},
+		{Payments: []sep.BankSepPaymentIdentifiers{{RefNum: "ref-a"}}},
+		// given twice
+		{Tokens: []string{"token-c", "token-c"}},
+		{Payments: []sep.BankSepPaymentIdentifiers{{RefNum: "ref-c"}, {RefNum: "ref-c"}}},
+	} {
+		status := send(t, app, http.MethodPost, path, req, nil)
+		if status != http.StatusConflict {
+			t.Errorf("preloading %+v responded with %d, want 409", req, status)
+		}
+	}
+	again := new(sep.BankSepIdentifiersResponse)
+	if send(t, app, http.MethodGet, path, nil, again) != http.StatusOK || len(again.Tokens)+len(again.Payments) != 0 {
+		t.Errorf("the rejected identifiers were preloaded: %+v", again)
+	}
+}
+
+// changeClock posts req to the clock action, e.g. freeze or advance, and returns the
+// changed clock.
+func changeClock(t *testing.T, app *fiber.App, action string, req *management.ClockRequest) *management.ClockResponse {
+	t.Helper()
+	resp := new(management.ClockResponse)
+	post(t, app, management.RouterPrefix+"/clock/"+action, req, resp)
+	return resp
+}
+
+func verify(t *testing.T, app *fiber.App, base string, terminalNumber json.Number, refNum string) *sep.BankSepVerificationResponse {
+	t.Helper()
+	verification := new(sep.BankSepVerificationResponse)
+	post(t, app, base+sep.BankSepPathVerifyTransaction, &sep.BankSepVerificationRequest{
+		RefNum:         refNum,
+		TerminalNumber: terminalNumber,
+	}, verification)
+	return verification
+}
+
+func TestVerifyAfterTheWindow(t *testing.T) {
+	app := newApp(t)
+	_, terminalNumber := createTerminal(t, app, prefix)
+	changeClock(t, app, "freeze", &management.ClockRequest{})
+
+	callback := pay(t, app, prefix, requestToken(t, app, prefix, terminalNumber, "order-1"))
+	changeClock(t, app, "advance", &management.ClockRequest{Duration: "31m"})
+
+	verification := verify(t, app, prefix, terminalNumber, callback.RefNum)
+	if verification.Success || verification.ResultCode != -6 {
+		t.Errorf("verify after 31 minutes responded with %d: %s, want -6", verification.ResultCode, verification.ResultDescription)
+	}
+}
+
+func TestAdvanceExpiresUnpaidTokens(t *testing.T) {
+	app, db := openApp(t)
+	_, terminalNumber := createTerminal(t, app, prefix)
+	changeClock(t, app, "freeze", &management.ClockRequest{})
+	token := requestToken(t, app, prefix, terminalNumber, "order-1")
+
+	expired := func() bool {
+		t.Helper()
+		var btrx sep.BankSepTransaction
+		err := db.Where("token = ?", token).Take(&btrx).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return btrx.ExpiredAt != nil
+	}
+	changeClock(t, app, "advance", &management.ClockRequest{Duration: "19m"})
+	if expired() {
+		t.Fatal("the token expired before its time")
+	}
+	// the default expiry of tokens is the minimum
+	changeClock(t, app, "advance", &management.ClockRequest{Duration: "2m"})
+	if !expired() {
+		t.Fatalf("the token didn't expire %d minutes after it was issued", sep.SepMinimimTokenExpiry+1)
+	}
+	status := send(t, app, http.MethodGet, prefix+"/public/token?token="+token, nil, nil)
+	if status == http.StatusOK {
+		t.Error("the payment page was handed an expired token")
+	}
+}
+
+func TestNamespaceClock(t *testing.T) {
+	app := newApp(t)
+	post(t, app, management.RouterPrefix+"/namespaces", &management.CreateNamespaceRequest{Name: "slow"}, new(management.NamespaceResponse))
+	global := changeClock(t, app, "freeze", &management.ClockRequest{})
+
+	// a namespace can go back in time, its clock is frozen like the global one it
+	// followed
+	earlier := global.Now.Add(-time.Hour)
+	own := changeClock(t, app, "set", &management.ClockRequest{Namespace: "slow", Time: &earlier})
+	if !own.Now.Equal(earlier) || !own.Frozen || own.Source != management.ClockSourceNamespace {
+		t.Fatalf("the clock of the namespace is %+v, want frozen at %s", own, earlier)
+	}
+
+	_, terminalNumber := createTerminal(t, app, prefix)
+	_, slowTerminalNumber := createTerminal(t, app, nsPrefix("slow"))
+	callback := pay(t, app, prefix, requestToken(t, app, prefix, terminalNumber, "order-1"))
+	slowCallback := pay(t, app, nsPrefix("slow"), requestToken(t, app, nsPrefix("slow"), slowTerminalNumber, "order-1"))
+
+	// only the namespaces following the global clock move with it
+	changeClock(t, app, "advance", &management.ClockRequest{Duration: "31m"})
+	if verification := verify(t, app, prefix, terminalNumber, callback.RefNum); verification.ResultCode != -6 {
+		t.Errorf("verify by the global clock responded with %d, want -6", verification.ResultCode)
+	}
+	if verification := verify(t, app, nsPrefix("slow"), slowTerminalNumber, slowCallback.RefNum); !verification.Success {
+		t.Errorf("verify by the clock of the namespace failed with %d: %s", verification.ResultCode, verification.ResultDescription)
+	}
+
+	clock := new(management.ClockResponse)
+	if send(t, app, http.MethodGet, management.RouterPrefix+"/clock?namespace=slow", nil, clock) != http.StatusOK || !clock.Now.Equal(earlier) {
+		t.Errorf("the clock of the namespace moved to %s, want %s", clock.Now, earlier)
+	}
+}
+
+// receiver is a webhook subscriber that fails the first failures deliveries with 500.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*receivedDelivery
+}
+
+type receivedDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, &receivedDelivery{header: req.Header, body: body})
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (r *receiver) received() []*receivedDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.requests)
+}
+
+func deliveries(t *testing.T, app *fiber.App) []*management.WebhookDeliveryResponse {
+	t.Helper()
+	var resp []*management.WebhookDeliveryResponse
+	if status := send(t, app, http.MethodGet, management.RouterPrefix+"/webhooks/deliveries", nil, &resp); status != http.StatusOK {
+		t.Fatalf("listing the deliveries responded with %d", status)
+	}
+	return resp
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	app, db := openApp(t)
+	ctx := context.Background()
+	subscriber := &receiver{failures: 1}
+	srv := httptest.NewServer(subscriber)
+	t.Cleanup(srv.Close)
+
+	post(t, app, management.RouterPrefix+"/webhooks", &webhook.SubscriptionRequest{
+		URL:    srv.URL,
+		Secret: "s3cret",
+		Events: []webhook.EventType{webhook.EventTokenCreated},
+	}, new(management.WebhookSubscriptionResponse))
+	_, terminalNumber := createTerminal(t, app, prefix)
+	requestToken(t, app, prefix, terminalNumber, "order-1")
+
+	scheduler.RunDue(ctx, db)
+	received := subscriber.received()
+	if len(received) != 1 {
+		t.Fatalf("the subscriber received %d deliveries, want 1", len(received))
+	}
+	first := received[0]
+	if signature := first.header.Get(webhook.SignatureHeader); signature != webhook.Sign("s3cret", first.body) {
+		t.Errorf("the delivery is signed %q, want %q", signature, webhook.Sign("s3cret", first.body))
+	}
+	if event := first.header.Get(webhook.EventHeader); event != string(webhook.EventTokenCreated) {
+		t.Errorf("the delivery is of event %s", event)
+	}
+	log := deliveries(t, app)
+	if len(log) != 1 {
+		t.Fatalf("the delivery log has %d entries, want 1", len(log))
+	}
+	failed := log[0]
+	if failed.Status != webhook.DeliveryStatusPending || failed.Attempts != 1 || failed.LastStatusCode == nil || *failed.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("the failed delivery is logged as %+v", failed)
+	}
+	if failed.LastAttemptAt == nil || failed.NextAttemptAt.Sub(*failed.LastAttemptAt) < 5*time.Second {
+		t.Errorf("the failed delivery is retried at %s, last attempted at %v", failed.NextAttemptAt, failed.LastAttemptAt)
+	}
+
+	// the retry is due once the backoff passed
+	err := db.Model(&webhook.Delivery{}).Where("id = ?", failed.ID).Update("next_attempt_at", time.Now()).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook.Wake()
+	scheduler.RunDue(ctx, db)
+	received = subscriber.received()
+	if len(received) != 2 || !bytes.Equal(received[1].body, first.body) || received[1].header.Get(webhook.DeliveryHeader) != first.header.Get(webhook.DeliveryHeader) {
+		t.Fatalf("the subscriber received %d deliveries, want the same one again", len(received))
+	}
+	delivered := deliveries(t, app)[0]
+	if delivered.Status != webhook.DeliveryStatusDelivered || delivered.Attempts != 2 || delivered.DeliveredAt == nil || delivered.LastError != nil {
+		t.Errorf("the retried delivery is logged as %+v", delivered)
+	}
+}
+
+func TestNamespacesAreIsolated(t *testing.T) {
+	app := newApp(t)
+	for _, ns := range []string{"a", "b"} {
+		post(t, app, management.RouterPrefix+"/namespaces", &management.CreateNamespaceRequest{Name: ns}, new(management.NamespaceResponse))
+	}
+	terminalA, terminalNumberA := createTerminal(t, app, nsPrefix("a"))
+	terminalB, terminalNumberB := createTerminal(t, app, nsPrefix("b"))
+
+	// the same order number is used by both test runs
+	tokenA := requestToken(t, app, nsPrefix("a"), terminalNumberA, "order-1")
+	requestToken(t, app, nsPrefix("b"), terminalNumberB, "order-1")
+
+	for ns, want := range map[string]uint64{"a": terminalA, "b": terminalB} {
+		terminals := new(sep.BankSepGetTerminalsResponse)
+		if send(t, app, http.MethodGet, nsPrefix(ns)+"/management/terminal", nil, terminals) != http.StatusOK {
+			t.Fatalf("listing the terminals of %s failed", ns)
+		}
+		if len(terminals.Terminals) != 1 || terminals.Terminals[0].ID != want {
+			t.Errorf("namespace %s lists %+v, want only terminal %d", ns, terminals.Terminals, want)
+		}
+	}
+
+	status := send(t, app, http.MethodPost, nsPrefix("b")+"/management/token/submit", &sep.BankSepSubmitTokenRequest{
+		Token:        tokenA,
+		CardNumber:   "6037990000000006",
+		Cvv:          123,
+		ExpiryMonth:  12,
+		ExpiryYear:   9,
+		CardPassword: "12345",
+	}, nil)
+	if status == http.StatusOK {
+		t.Error("a token of namespace a was paid through namespace b")
+	}
+	if callback := pay(t, app, nsPrefix("a"), tokenA); callback.ResNum != "order-1" {
+		t.Errorf("paying the token in its namespace returned %+v", callback)
+	}
+}
+
+func TestPaymentTokenEndpointOfNamespace(t *testing.T) {
+	app := newApp(t)
+	post(t, app, management.RouterPrefix+"/namespaces", &management.CreateNamespaceRequest{Name: "a"}, new(management.NamespaceResponse))
+	terminals := new(sep.BankSepGetTerminalsResponse)
+	send(t, app, http.MethodGet, nsPrefix("a")+"/management/terminal", nil, terminals)
+
+	// merchants add the token to the endpoint like outside of namespaces
+	endpoint, err := url.Parse(terminals.Endpoints.PaymentToken + "?token=some-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, endpoint.RequestURI(), nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	location, err := url.Parse(res.Header.Get(fiber.HeaderLocation))
+	if res.StatusCode != http.StatusFound || err != nil {
+		t.Fatalf("the payment token endpoint responded with %d", res.StatusCode)
+	}
+	query := location.Query()
+	if location.Path != prefix+sep.BankSepPathOnlinePaymenyTokenRedirect || query.Get("token") != "some-token" || query.Get("namespace") != "a" {
+		t.Errorf("the payment token endpoint redirected to %s", location)
+	}
+}
+
+const fixturesYaml = `
+banks:
+  saman:
+    terminals:
+      - id: 1001
+        name: %s
+    transactions:
+      - terminalId: 1001
+        amount: 120000
+        resNum: order-1
+        redirectURL: http://shop.test/callback
+`
+
+func TestFixturesAreIdempotent(t *testing.T) {
+	_, db := openApp(t)
+
+	err := fixtures.Apply(db, fmt.Appendf(nil, fixturesYaml, "shop"))
+	if err != nil {
+		t.Fatalf("applying the fixtures failed: %v", err)
+	}
+	var first sep.BankSepTerminal
+	if err = db.Take(&first, 1001).Error; err != nil {
+		t.Fatalf("the terminal wasn't seeded: %v", err)
+	}
+
+	// like a restart with a renamed terminal
+	err = fixtures.Apply(db, fmt.Appendf(nil, fixturesYaml, "renamed-shop"))
+	if err != nil {
+		t.Fatalf("applying the fixtures again failed: %v", err)
+	}
+	var terminals []*sep.BankSepTerminal
+	if err = db.Find(&terminals).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(terminals) != 1 {
+		t.Fatalf("there are %d terminals, want 1", len(terminals))
+	}
+	second := terminals[0]
+	if second.Name != "renamed-shop" {
+		t.Errorf("the terminal is named %s, want renamed-shop", second.Name)
+	}
+	if second.Username != first.Username || second.Password != first.Password {
+		t.Error("the generated credentials changed")
+	}
+
+	var transactions int64
+	if err = db.Model(&sep.BankSepTransaction{}).Count(&transactions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if transactions != 1 {
+		t.Errorf("there are %d transactions, want 1", transactions)
+	}
+	var expiries int64
+	if err = db.Model(&scheduler.Job{}).Where("periodic = ?", false).Count(&expiries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if expiries != 1 {
+		t.Errorf("%d expiries are scheduled, want 1", expiries)
+	}
+}
+
+func TestFixtureOfUnknownTerminal(t *testing.T) {
+	_, db := openApp(t)
+	err := fixtures.Apply(db, []byte(`
+banks:
+  saman:
+    transactions:
+      - terminalId: 1002
+        amount: 120000
+        resNum: order-1
+        redirectURL: http://shop.test/callback
+`))
+	if err == nil || !strings.Contains(err.Error(), `transaction "order-1" references unknown terminal 1002`) {
+		t.Errorf("applying a transaction of an unknown terminal returned %v", err)
+	}
+}
+
+const paidFixtureYaml = `
+banks:
+  saman:
+    terminals:
+      - id: 1001
+        name: shop
+    transactions:
+      - terminalId: 1001
+        amount: 120000
+        resNum: order-1
+        redirectURL: http://shop.test/callback
+        state: OK
+        cardNumber: "6037990000000006"
+`
+
+func TestPaidFixtureGetsIdentifiers(t *testing.T) {
+	app, db := openApp(t)
+	for range 2 {
+		if err := fixtures.Apply(db, []byte(paidFixtureYaml)); err != nil {
+			t.Fatalf("applying the fixtures failed: %v", err)
+		}
+	}
+
+	var transactions []*sep.BankSepTransaction
+	if err := db.Find(&transactions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 1 {
+		t.Fatalf("there are %d transactions, want 1", len(transactions))
+	}
+	btx := transactions[0]
+	if *btx.RefNum == "" || *btx.Rrn == 0 || *btx.TraceNo == 0 {
+		t.Fatalf("the paid fixture has refNum %q, rrn %d and traceNo %d", *btx.RefNum, *btx.Rrn, *btx.TraceNo)
+	}
+
+	verification := verify(t, app, prefix, "1001", *btx.RefNum)
+	if !verification.Success {
+		t.Fatalf("verify failed with %d: %s", verification.ResultCode, verification.ResultDescription)
+	}
+	detail := verification.TransactionDetail
+	if detail.RRN != strconv.FormatInt(*btx.Rrn, 10) || detail.StraceNo != strconv.FormatInt(*btx.TraceNo, 10) {
+		t.Errorf("verify returned rrn %s and traceNo %s", detail.RRN, detail.StraceNo)
+	}
+}
+
+func TestPreloadLimitIsOfTheQueue(t *testing.T) {
+	app := newApp(t)
+	terminalId, _ := createTerminal(t, app, prefix)
+	path := prefix + "/management/terminal/" + strconv.FormatUint(terminalId, 10) + "/identifiers"
+
+	post(t, app, path, &sep.BankSepPreloadIdentifiersRequest{Count: 600}, new(sep.BankSepIdentifiersResponse))
+	status := send(t, app, http.MethodPost, path, &sep.BankSepPreloadIdentifiersRequest{Count: 500}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("preloading past the limit responded with %d, want 400", status)
+	}
+	status = send(t, app, http.MethodPost, path, &sep.BankSepPreloadIdentifiersRequest{Tokens: []string{"one-too-many"}, Count: 400}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("preloading a token past the limit responded with %d, want 400", status)
+	}
+	post(t, app, path, &sep.BankSepPreloadIdentifiersRequest{Count: 400}, new(sep.BankSepIdentifiersResponse))
+}
+
+func TestRandomIdentifiersAreNotCounted(t *testing.T) {
+	app, db := openApp(t)
+	terminalId, terminalNumber := createTerminal(t, app, prefix)
+	pay(t, app, prefix, requestToken(t, app, prefix, terminalNumber, "order-1"))
+
+	var terminal sep.BankSepTerminal
+	if err := db.Take(&terminal, terminalId).Error; err != nil {
+		t.Fatal(err)
+	}
+	if terminal.TokenCount != 0 || terminal.PaymentCount != 0 {
+		t.Errorf("the terminal without a seed counted %d tokens and %d payments", terminal.TokenCount, terminal.PaymentCount)
+	}
+}
+
+func TestEndpointsBehindProxy(t *testing.T) {
+	// requests of app.Test come from 0.0.0.0
+	cases := []struct {
+		name           string
+		trustedProxies string
+		publicHostname string
+		want           string
+	}{
+		{"trusted proxy", "0.0.0.0", "", "https://pay.example.org"},
+		{"untrusted proxy", "10.0.0.0/8", "", "http://example.com"},
+		{"public hostname", "0.0.0.0", "https://bank.example.net", "https://bank.example.net"},
+		{"public hostname without scheme", "0.0.0.0", "bank.example.net", "https://bank.example.net"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("IRBANKMOCK_TRUSTED_PROXIES", tc.trustedProxies)
+			t.Setenv("IRBANKMOCK_PUBLIC_HOSTNAME", tc.publicHostname)
+			app := newApp(t)
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com"+prefix+"/management/terminal", nil)
+			req.Header.Set(fiber.HeaderXForwardedProto, "https")
+			req.Header.Set(fiber.HeaderXForwardedHost, "pay.example.org")
+			res, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			terminals := new(sep.BankSepGetTerminalsResponse)
+			if err = json.NewDecoder(res.Body).Decode(terminals); err != nil {
+				t.Fatal(err)
+			}
+			if want := tc.want + prefix + sep.BankSepPathVerifyTransaction; terminals.Endpoints.VerifyTransaction != want {
+				t.Errorf("the verify endpoint is %s, want %s", terminals.Endpoints.VerifyTransaction, want)
+			}
+		})
+	}
+}
+
+func TestInspectorRecordsMerchantExchanges(t *testing.T) {
+	app, db := openApp(t)
+	terminalId, terminalNumber := createTerminal(t, app, prefix)
+
+	// merchants may send anything, the sensitive fields are redacted before storage
+	status := send(t, app, http.MethodPost, prefix+sep.BankSepPathOnlinePaymentGateway, map[string]any{
+		"action":      "token",
+		"terminalId":  terminalNumber,
+		"amount":      120000,
+		"resNum":      "order-1",
+		"redirectUrl": "http://shop.test/callback",
+		"cardNumber":  "6037990000000006",
+		"cvv2":        "123",
+		"password":    "12345",
+	}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("token request responded with %d", status)
+	}
+	var token string
+	if err := db.Model(&sep.BankSepTransaction{}).Where("res_num = ?", "order-1").Pluck("token", &token).Error; err != nil {
+		t.Fatal(err)
+	}
+	callback := pay(t, app, prefix, token)
+	verify(t, app, prefix, terminalNumber, callback.RefNum)
+
+	var exchanges []*management.ExchangeResponse
+	send(t, app, http.MethodGet, management.RouterPrefix+"/exchanges", nil, &exchanges)
+	if len(exchanges) != 2 {
+		t.Fatalf("recorded %d exchanges, want the token request and the verify only", len(exchanges))
+	}
+	verifyExchange, tokenExchange := exchanges[0], exchanges[1]
+	if tokenExchange.Path != prefix+sep.BankSepPathOnlinePaymentGateway || verifyExchange.Path != prefix+sep.BankSepPathVerifyTransaction {
+		t.Errorf("recorded %s and %s", tokenExchange.Path, verifyExchange.Path)
+	}
+	for _, secret := range []string{"6037990000000006", `"123"`, "12345"} {
+		if strings.Contains(tokenExchange.RequestBody, secret) {
+			t.Errorf("the recorded request body contains %s: %s", secret, tokenExchange.RequestBody)
+		}
+	}
+	if !strings.Contains(tokenExchange.RequestBody, "order-1") {
+		t.Errorf("the recorded request body lost the resNum: %s", tokenExchange.RequestBody)
+	}
+
+	var transactionId uint64
+	if err := db.Model(&sep.BankSepTransaction{}).Where("token = ?", token).Pluck("id", &transactionId).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range exchanges {
+		if e.TerminalId == nil || *e.TerminalId != int64(terminalId) || e.TransactionId == nil || *e.TransactionId != transactionId {
+			t.Errorf("the exchange of %s is linked to terminal %v and transaction %v", e.Path, e.TerminalId, e.TransactionId)
+		}
+	}
+
+	// the recorded exchanges of the transaction can be looked up
+	var linked []*management.ExchangeResponse
+	send(t, app, http.MethodGet, management.RouterPrefix+"/exchanges?transactionId="+strconv.FormatUint(transactionId, 10), nil, &linked)
+	if len(linked) != 2 {
+		t.Errorf("found %d exchanges of the transaction", len(linked))
+	}
+
+	err := db.Model(&inspector.Exchange{}).Where("id = ?", tokenExchange.ID).Update("created_at", time.Now().Add(-25*time.Hour)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = inspector.RemoveExpired(db); err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint64
+	if err = db.Model(&inspector.Exchange{}).Pluck("id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []uint64{verifyExchange.ID}) {
+		t.Errorf("kept exchanges %v after removing the expired ones, want %d", ids, verifyExchange.ID)
+	}
+}
@@ -7,11 +7,17 @@ import (
 
 	"github.com/abramad-labs/irbankmock/internal/banks/registry"
 	"github.com/abramad-labs/irbankmock/internal/banks/sep/seperrors"
-	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/eventbus"
+	"github.com/abramad-labs/irbankmock/internal/fixtures"
+	"github.com/abramad-labs/irbankmock/internal/inspector"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/abramad-labs/irbankmock/internal/openapi"
 	"github.com/gofiber/fiber/v2"
-	"gorm.io/gorm"
 )
 
+const BankSepName = "saman"
+
 const BankSepPathOnlinePaymentGateway = "/OnlinePG/OnlinePG"
 const BankSepPathOnlinePaymenyTokenRedirect = "/OnlinePG/SendToken"
 
@@ -20,21 +26,94 @@ const BankSepPathVerifyTransaction = "/verifyTxnRandomSessionkey/ipg/VerifyTrans
 const BankSepPathReverseTransaction = "/verifyTxnRandomSessionkey/ipg/ReverseTransaction"
 
 func init() {
-	migration.RegisterMigration("samanbank_models", func(m gorm.Migrator) error {
-		return m.AutoMigrate(BankSepTerminal{}, BankSepTransaction{})
-	})
+	registerSettings()
+	registerMigrations()
+	registerJobs()
+	fixtures.RegisterLoader(BankSepName, applyFixtures)
+	snapshot.RegisterResetter(resetData)
+	namespace.RegisterDestroyer(destroyNamespace)
 
-	registry.RegisterBank("saman", func(g fiber.Router) {
-		g.Post("/management/terminal", CreateTerminal)
-		g.Get("/management/terminal", GetTerminals)
-		g.Get("/public/token", GetTokenInfo)
-		g.Post("/management/token/submit", SubmitToken)
-		g.Post("/management/token/fail", FailToken)
-		g.Post("/management/token/cancel", CancelToken)
-		g.Post(BankSepPathOnlinePaymentGateway, PaymentGwTransaction)
-		g.Post(BankSepPathGetReceipt, GetReceipt)
-		g.Post(BankSepPathVerifyTransaction, VerifyTransaction)
-		g.Post(BankSepPathReverseTransaction, ReverseTransaction)
+	registry.RegisterCommands(BankSepName, bankSepCommands{})
+	registry.RegisterBank(bankSepInfo, func(g fiber.Router) {
+		route := func(method string, path string, op *openapi.Operation, handlers ...fiber.Handler) {
+			registry.Route(g, BankSepName, method, path, op, handlers...)
+		}
+		route(fiber.MethodPost, "/management/terminal", &openapi.Operation{
+			Summary:  "Create a terminal",
+			Request:  BankSepCreateTerminalRequest{},
+			Response: BankSepTerminalResponse{},
+		}, CreateTerminal)
+		route(fiber.MethodGet, "/management/terminal", &openapi.Operation{
+			Summary:  "List the terminals and the endpoints merchants should call",
+			Response: BankSepGetTerminalsResponse{},
+		}, GetTerminals)
+		route(fiber.MethodGet, "/management/terminal/:id/identifiers", &openapi.Operation{
+			Summary:  "Show how the identifiers of a terminal are generated and the preloaded ones",
+			Response: BankSepIdentifiersResponse{},
+		}, GetIdentifiers)
+		route(fiber.MethodPut, "/management/terminal/:id/identifiers", &openapi.Operation{
+			Summary: "Set the seed of the tokens and payment identifiers of a terminal",
+			Description: "The preloaded identifiers are dropped, the sequence of the terminal goes on so no identifier is handed out twice. " +
+				"An empty seed follows IRBANKMOCK_ID_SEED, identifiers are random if that is empty too.",
+			Request:  BankSepSetIdentifierSeedRequest{},
+			Response: BankSepIdentifiersResponse{},
+		}, SetIdentifierSeed)
+		route(fiber.MethodPost, "/management/terminal/:id/identifiers", &openapi.Operation{
+			Summary: "Preload the identifiers of the next tokens and payments of a terminal",
+			Description: "The given tokens and payment identifiers are queued first, followed by the next count " +
+				"generated ones. Token requests and payments take them in order.",
+			Request:  BankSepPreloadIdentifiersRequest{},
+			Response: BankSepIdentifiersResponse{},
+		}, PreloadIdentifiers)
+		route(fiber.MethodGet, "/public/token", &openapi.Operation{
+			Summary:    "Get the public info of a payment token, used by the payment page",
+			Parameters: []openapi.Parameter{openapi.QueryParam("token", "the payment token")},
+			Response:   BankSepPublicTokenInfoResponse{},
+		}, GetTokenInfo)
+		route(fiber.MethodPost, "/management/token/submit", &openapi.Operation{
+			Summary:  "Pay the transaction of a token with a card",
+			Request:  BankSepSubmitTokenRequest{},
+			Response: BankSepTokenFinalizeResponse{},
+		}, SubmitToken)
+		route(fiber.MethodPost, "/management/token/fail", &openapi.Operation{
+			Summary:  "Fail the transaction of a token",
+			Request:  BankSepCancelOrFailTokenRequest{},
+			Response: BankSepTokenFinalizeResponse{},
+		}, FailToken)
+		route(fiber.MethodPost, "/management/token/cancel", &openapi.Operation{
+			Summary:  "Cancel the transaction of a token as the customer",
+			Request:  BankSepCancelOrFailTokenRequest{},
+			Response: BankSepTokenFinalizeResponse{},
+		}, CancelToken)
+		route(fiber.MethodPost, BankSepPathOnlinePaymentGateway, &openapi.Operation{
+			Summary: "Request a payment token",
+			Description: "Posting a form with only the Token field redirects the customer to the " +
+				"payment page instead.",
+			Request:  BankSepTransactionRequest{},
+			Response: BankSepTransactionResponse{},
+		}, inspector.Record(BankSepName), PaymentGwTransaction)
+		route(fiber.MethodGet, BankSepPathOnlinePaymenyTokenRedirect, &openapi.Operation{
+			Summary: "Open the payment page of a token",
+			Description: "Under a namespace prefix the customer is redirected to the payment page along with the " +
+				"namespace, the page itself is served at this path outside of namespaces.",
+			Parameters: []openapi.Parameter{openapi.QueryParam("token", "the payment token")},
+		}, RedirectToPaymentPage)
+		route(fiber.MethodPost, BankSepPathGetReceipt, &openapi.Operation{
+			Summary:     "Get the receipt of a transaction",
+			Description: "Either RefNum or Token must be provided.",
+			Request:     BankSepGetReceiptRequest{},
+			Response:    BankSepGetReceiptResponse{},
+		}, inspector.Record(BankSepName), GetReceipt)
+		route(fiber.MethodPost, BankSepPathVerifyTransaction, &openapi.Operation{
+			Summary:  "Verify a paid transaction",
+			Request:  BankSepVerificationRequest{},
+			Response: BankSepVerificationResponse{},
+		}, inspector.Record(BankSepName), VerifyTransaction)
+		route(fiber.MethodPost, BankSepPathReverseTransaction, &openapi.Operation{
+			Summary:  "Reverse a paid transaction",
+			Request:  BankSepReverseRequest{},
+			Response: BankSepReverseResponse{},
+		}, inspector.Record(BankSepName), ReverseTransaction)
 	})
 }
 
@@ -61,6 +140,42 @@ func CreateTerminal(c *fiber.Ctx) error {
 	return c.JSON(resp)
 }
 
+func GetIdentifiers(c *fiber.Ctx) error {
+	resp, err := getTerminalIdentifiers(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(resp)
+}
+
+func SetIdentifierSeed(c *fiber.Ctx) error {
+	req := new(BankSepSetIdentifierSeedRequest)
+	err := c.BodyParser(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := setIdentifierSeed(c, req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(resp)
+}
+
+func PreloadIdentifiers(c *fiber.Ctx) error {
+	req := new(BankSepPreloadIdentifiersRequest)
+	err := c.BodyParser(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := preloadIdentifiers(c, req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(resp)
+}
+
 func sendJsonFromSamanError(c *fiber.Ctx, err error, status int) error {
 	return c.Status(status).JSON(BankSepTransactionResponse{
 		Status:    -1,
@@ -72,9 +187,7 @@ func sendJsonFromSamanError(c *fiber.Ctx, err error, status int) error {
 func PaymentGwTransaction(c *fiber.Ctx) error {
 	tokenValue := c.FormValue("Token")
 	if tokenValue != "" {
-		routerPrefix := registry.GetRouterPrefix(c)
-		target := routerPrefix + BankSepPathOnlinePaymenyTokenRedirect + "?token=" + url.QueryEscape(tokenValue)
-		return c.Redirect(target, fiber.StatusTemporaryRedirect)
+		return c.Redirect(paymentPageURL(c, tokenValue), fiber.StatusTemporaryRedirect)
 	}
 	txReq := new(BankSepTransactionRequest)
 	err := c.BodyParser(txReq)
@@ -82,13 +195,47 @@ func PaymentGwTransaction(c *fiber.Ctx) error {
 		wErr := fmt.Errorf("%w: %w", seperrors.ErrXInvalidRequest, err)
 		return sendJsonFromSamanError(c, wErr, fiber.StatusBadRequest)
 	}
+	terminalId, _ := txReq.TerminalId.Int64()
 	resp, err := processTransactionRequest(c, txReq)
+	countToken(c, terminalId, err)
 	if err != nil {
+		publishFeedEvent(c, eventbus.TypeTokenRejected, namespace.Get(c), terminalId, &BankSepFeedTokenRequest{
+			ResNum:    txReq.ResNum,
+			Amount:    txReq.Amount,
+			ErrorCode: strconv.Itoa(seperrors.GetBankSepErrorCode(err)),
+			ErrorDesc: err.Error(),
+		})
 		return sendJsonFromSamanError(c, err, fiber.StatusBadRequest)
 	}
+	publishFeedEvent(c, eventbus.TypeTokenCreated, namespace.Get(c), terminalId, &BankSepFeedTokenRequest{
+		ResNum: txReq.ResNum,
+		Amount: txReq.Amount,
+		Token:  resp.Token,
+	})
 	return c.JSON(resp)
 }
 
+// paymentPageURL returns the payment page of the token. The page is only served
+// outside the namespace prefix, it finds the token under the prefix of the namespace
+// it's told.
+func paymentPageURL(c *fiber.Ctx, token string) string {
+	bankPrefix := registry.AbsoluteURL(c, registry.GetBankPrefix(c))
+	target := bankPrefix + BankSepPathOnlinePaymenyTokenRedirect + "?token=" + url.QueryEscape(token)
+	if ns := namespace.Get(c); ns != namespace.Default {
+		target += "&namespace=" + url.QueryEscape(ns)
+	}
+	return target
+}
+
+// RedirectToPaymentPage sends the customers of a namespace to the payment page. The
+// web app serves the page itself at this path outside of namespaces.
+func RedirectToPaymentPage(c *fiber.Ctx) error {
+	if namespace.Get(c) == namespace.Default {
+		return c.Next()
+	}
+	return c.Redirect(paymentPageURL(c, c.Query("token")), fiber.StatusFound)
+}
+
 func GetTokenInfo(c *fiber.Ctx) error {
 	tokenValue := c.Query("token")
 	resp, err := getPublicTokenInfo(c, tokenValue)
@@ -108,6 +255,7 @@ func SubmitToken(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	countPayment(c, resp)
 	return c.JSON(resp)
 }
 
@@ -122,6 +270,7 @@ func CancelToken(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	countPayment(c, resp)
 	return c.JSON(resp)
 }
 
@@ -136,6 +285,7 @@ func FailToken(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	countPayment(c, resp)
 	return c.JSON(resp)
 }
 
@@ -157,6 +307,17 @@ func GetReceipt(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	feedData := &BankSepFeedReceiptRequest{
+		RefNum:       req.RefNum,
+		Token:        req.Token,
+		HasError:     resp.HasError,
+		ErrorCode:    resp.ErrorCode,
+		ErrorMessage: resp.ErrorMessage,
+	}
+	if !resp.HasError {
+		feedData.State = resp.Data.State
+	}
+	publishFeedEvent(c, eventbus.TypeReceiptRequested, namespace.Get(c), terminalNum, feedData)
 	return c.JSON(resp)
 }
 
@@ -178,6 +339,13 @@ func VerifyTransaction(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	countResult(c, verifyResults, terminalNum, resp.ResultCode)
+	publishFeedEvent(c, eventbus.TypeVerifyAttempted, namespace.Get(c), terminalNum, &BankSepFeedVerification{
+		RefNum:            req.RefNum,
+		Success:           resp.Success,
+		ResultCode:        resp.ResultCode,
+		ResultDescription: resp.ResultDescription,
+	})
 	return c.JSON(resp)
 }
 
@@ -199,5 +367,12 @@ func ReverseTransaction(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	countResult(c, reverseResults, terminalNum, resp.ResultCode)
+	publishFeedEvent(c, eventbus.TypeReverseAttempted, namespace.Get(c), terminalNum, &BankSepFeedVerification{
+		RefNum:            req.RefNum,
+		Success:           resp.Success,
+		ResultCode:        resp.ResultCode,
+		ResultDescription: resp.ResultDescription,
+	})
 	return c.JSON(resp)
 }
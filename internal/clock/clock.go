@@ -0,0 +1,320 @@
+package clock
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Global is the scope of the clock used by the namespaces without a clock of their
+// own. It's not a valid namespace name, so it can't collide with one.
+const Global = "*"
+
+var ErrNegativeDuration = errors.New("the clock can only be advanced by a positive duration")
+
+// A Clock tells the time the banks see. It's the real time unless the clock of the
+// namespace, or the global one, was frozen, advanced or set.
+//
+// Only the simulated world follows it: deadlines, expiries and the dates handed to
+// merchants. Latencies, locks and retention of the server itself use the real time.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Real is the clock of the scopes that were never changed.
+var Real Clock = realClock{}
+
+// State is the clock of a scope, the global one or a namespace.
+type State struct {
+	Scope string `gorm:"primaryKey;size:64"`
+	// the clock stands still at FrozenAt if set, otherwise it runs Offset ahead of
+	// the real time
+	FrozenAt  *time.Time
+	Offset    time.Duration
+	UpdatedAt time.Time
+}
+
+func (State) TableName() string {
+	return "clocks"
+}
+
+func (s *State) Now() time.Time {
+	if s.FrozenAt != nil {
+		return *s.FrozenAt
+	}
+	return time.Now().Add(s.Offset)
+}
+
+// A Listener is notified in the transaction of a change of the clock of scope, e.g. to
+// expire the tokens that became due. scope is Global or a namespace.
+type Listener func(tx *gorm.DB, scope string) error
+
+var listeners []Listener
+
+// the clocks are read for nearly every request, so For keeps them per database. A
+// change made here drops them at once, one made by another instance sharing the
+// database is seen once they are this old.
+const cacheTTL = time.Second
+
+type cache struct {
+	mu sync.Mutex
+	// bumped by every invalidation, so a read that raced with a change isn't kept
+	generation uint64
+	states     map[string]cachedState
+}
+
+type cachedState struct {
+	// nil for the real time
+	state    *State
+	loadedAt time.Time
+}
+
+// caches by connection pool
+var caches sync.Map
+
+func cacheOf(db *gorm.DB) *cache {
+	c, _ := caches.LoadOrStore(dbutils.Pool(db), &cache{states: map[string]cachedState{}})
+	return c.(*cache)
+}
+
+func (c *cache) get(scope string) (*State, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.states[scope]
+	if !ok || time.Since(cached.loadedAt) > cacheTTL {
+		return nil, c.generation, false
+	}
+	return cached.state, c.generation, true
+}
+
+func (c *cache) put(generation uint64, scope string, state *State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		c.states[scope] = cachedState{state: state, loadedAt: time.Now()}
+	}
+}
+
+// invalidate drops every cached clock of the database, a change of the global clock
+// moves all the namespaces following it.
+func invalidate(db *gorm.DB) {
+	c := cacheOf(db)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	clear(c.states)
+}
+
+// the model as of the migration creating it
+type state2025060601 struct {
+	Scope     string `gorm:"primaryKey;size:64"`
+	FrozenAt  *time.Time
+	Offset    time.Duration
+	UpdatedAt time.Time
+}
+
+func (state2025060601) TableName() string {
+	return "clocks"
+}
+
+func init() {
+	migration.Register(&migration.Migration{
+		Version: 2025060601,
+		Name:    "create_clocks",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(state2025060601{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(state2025060601{})
+		},
+	})
+
+	// tests that reset between runs expect to start in the real time again
+	snapshot.RegisterResetter(func(tx *gorm.DB, opts snapshot.ResetOptions) error {
+		return tx.Where("1 = 1").Delete(&State{}).Error
+	})
+	namespace.RegisterDestroyer(func(tx *gorm.DB, ns string) error {
+		invalidate(tx)
+		return tx.Where("scope = ?", ns).Delete(&State{}).Error
+	})
+	snapshot.OnReplaced(invalidate)
+	dbutils.OnClose(func(pool *sql.DB) {
+		caches.Delete(pool)
+	})
+
+	// registered first, so the other listeners read the changed clock
+	OnChange(func(tx *gorm.DB, scope string) error {
+		invalidate(tx)
+		return nil
+	})
+}
+
+// OnChange registers a listener of the clock changes, it must be called in init.
+func OnChange(listener Listener) {
+	listeners = append(listeners, listener)
+}
+
+// For returns the clock of the namespace: its own clock if it has one, otherwise the
+// global clock. The real time is used if the clocks can't be read.
+func For(db *gorm.DB, ns string) Clock {
+	c := cacheOf(db)
+	state, generation, ok := c.get(ns)
+	if ok {
+		if state == nil {
+			return Real
+		}
+		return state
+	}
+	state, err := Get(db, ns)
+	if err != nil {
+		slog.WarnContext(db.Statement.Context, "failed to read the clock, using the real time", "namespace", ns, "error", err)
+		return Real
+	}
+	c.put(generation, ns, state)
+	if state == nil {
+		return Real
+	}
+	return state
+}
+
+// ForRequest returns the clock of the namespace of the request.
+func ForRequest(c *fiber.Ctx) Clock {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return Real
+	}
+	return For(db, namespace.Get(c))
+}
+
+// Get returns the clock the scope follows, its own or the global one, nil for the
+// real time.
+func Get(db *gorm.DB, scope string) (*State, error) {
+	var states []*State
+	err := db.Where("scope IN ?", []string{scope, Global}).Find(&states).Error
+	if err != nil {
+		return nil, err
+	}
+	var result *State
+	for _, s := range states {
+		if s.Scope == scope {
+			return s, nil
+		}
+		result = s
+	}
+	return result, nil
+}
+
+// change applies fn to the clock the scope currently follows and stores the result
+// as the clock of the scope. A namespace that followed the global clock gets a clock
+// of its own starting at the same time.
+func change(db *gorm.DB, scope string, fn func(s *State)) (*State, error) {
+	var result *State
+	err := db.Transaction(func(tx *gorm.DB) error {
+		current, err := Get(tx, scope)
+		if err != nil {
+			return err
+		}
+		state := &State{Scope: scope}
+		if current != nil {
+			state.FrozenAt = current.FrozenAt
+			state.Offset = current.Offset
+		}
+		fn(state)
+		state.UpdatedAt = time.Now()
+		err = tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(state).Error
+		if err != nil {
+			return err
+		}
+		for _, l := range listeners {
+			if err := l(tx, scope); err != nil {
+				return err
+			}
+		}
+		result = state
+		return nil
+	})
+	// the listeners may have cached the clock before the transaction ended
+	invalidate(db)
+	return result, err
+}
+
+// Freeze stops the clock at, or at its current time if at is nil.
+func Freeze(db *gorm.DB, scope string, at *time.Time) (*State, error) {
+	return change(db, scope, func(s *State) {
+		now := s.Now()
+		if at != nil {
+			now = *at
+		}
+		s.FrozenAt = &now
+	})
+}
+
+// Resume lets a frozen clock run again from the time it was frozen at.
+func Resume(db *gorm.DB, scope string) (*State, error) {
+	return change(db, scope, func(s *State) {
+		if s.FrozenAt != nil {
+			s.Offset = time.Until(*s.FrozenAt)
+			s.FrozenAt = nil
+		}
+	})
+}
+
+// Advance moves the clock forward by d, it keeps running if it wasn't frozen.
+func Advance(db *gorm.DB, scope string, d time.Duration) (*State, error) {
+	if d < 0 {
+		return nil, ErrNegativeDuration
+	}
+	return change(db, scope, func(s *State) {
+		if s.FrozenAt != nil {
+			at := s.FrozenAt.Add(d)
+			s.FrozenAt = &at
+		} else {
+			s.Offset += d
+		}
+	})
+}
+
+// Set moves the clock to t, it keeps running if it wasn't frozen.
+func Set(db *gorm.DB, scope string, t time.Time) (*State, error) {
+	return change(db, scope, func(s *State) {
+		if s.FrozenAt != nil {
+			s.FrozenAt = &t
+		} else {
+			s.Offset = time.Until(t)
+		}
+	})
+}
+
+// Reset removes the clock of the scope. A namespace follows the global clock again,
+// the global clock goes back to the real time.
+func Reset(db *gorm.DB, scope string) error {
+	defer invalidate(db)
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("scope = ?", scope).Delete(&State{}).Error
+		if err != nil {
+			return err
+		}
+		for _, l := range listeners {
+			if err := l(tx, scope); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
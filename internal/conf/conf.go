@@ -1,16 +1,111 @@
 package conf
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path"
-	"strconv"
+	"slices"
+	"strings"
+	"time"
 )
 
+func init() {
+	Register(&Setting{Key: "data.path", Env: "IRBANKMOCK_DATA_PATH",
+		Description: "directory of the sqlite database and snapshots, the working directory if empty"})
+	Register(&Setting{Key: "db.name", Env: "IRBANKMOCK_DB_NAME", Default: "irbankmock.db",
+		Description: "file name of the sqlite database"})
+	Register(&Setting{Key: "db.inMemory", Env: "IRBANKMOCK_DB_IN_MEMORY", Default: "false", Validate: ValidateBool,
+		Description: "keep the sqlite database in memory only"})
+	Register(&Setting{Key: "db.driver", Env: "IRBANKMOCK_DB_DRIVER", Default: DbDriverSqlite,
+		Validate:    ValidateOneOf(DbDriverSqlite, DbDriverPostgres, "postgresql", "pgx", DbDriverMysql),
+		Description: "database backend, sqlite, postgres or mysql"})
+	Register(&Setting{Key: "db.dsn", Env: "IRBANKMOCK_DB_DSN", Secret: true,
+		Description: "connection string of the postgres and mysql backends"})
+	Register(&Setting{Key: "db.autoMigrate", Env: "IRBANKMOCK_AUTOMIGRATE", Default: "true", Validate: ValidateBool,
+		Description: "apply the pending migrations at startup"})
+	Register(&Setting{Key: "db.disableLog", Env: "IRBANKMOCK_DISABLE_GORM_LOG", Default: "false", Validate: ValidateBool,
+		Description: "disable the sql query log"})
+	Register(&Setting{Key: "log.level", Env: "IRBANKMOCK_LOG_LEVEL", Default: "info",
+		Validate:    ValidateOneOf("debug", "info", "warn", "error"),
+		Description: "minimum level of the logs, debug includes sql statements and request bodies"})
+	Register(&Setting{Key: "log.format", Env: "IRBANKMOCK_LOG_FORMAT", Default: "json", Validate: ValidateOneOf("json", "text"),
+		Description: "format of the logs, json or text"})
+	Register(&Setting{Key: "server.listen", Env: "IRBANKMOCK_SERVER_PORT", Default: ":3000",
+		Description: "listen address of the http server"})
+	Register(&Setting{Key: "server.publicHostname", Env: "IRBANKMOCK_PUBLIC_HOSTNAME", Validate: validatePublicHostname,
+		Description: "base url of the service as seen by the merchants, derived from the requests if empty"})
+	Register(&Setting{Key: "server.trustedProxies", Env: "IRBANKMOCK_TRUSTED_PROXIES", Default: defaultTrustedProxies,
+		Validate:    validateTrustedProxies,
+		Description: "comma separated ips and cidrs of the proxies whose X-Forwarded-* headers are trusted, * for all"})
+	Register(&Setting{Key: "server.shutdownTimeout", Env: "IRBANKMOCK_SHUTDOWN_TIMEOUT", Default: "30s", Validate: ValidateDuration,
+		Description: "how long in-flight requests and jobs may take to finish on shutdown"})
+	Register(&Setting{Key: "server.tls.listen", Env: "IRBANKMOCK_TLS_LISTEN",
+		Description: "listen address of the https server, disabled if empty"})
+	Register(&Setting{Key: "server.tls.certFile", Env: "IRBANKMOCK_TLS_CERT_FILE",
+		Description: "pem certificate of the https server, issued by a generated local ca if empty"})
+	Register(&Setting{Key: "server.tls.keyFile", Env: "IRBANKMOCK_TLS_KEY_FILE",
+		Description: "pem private key of server.tls.certFile"})
+	Register(&Setting{Key: "server.tls.hosts", Env: "IRBANKMOCK_TLS_HOSTS", Default: "localhost,127.0.0.1,::1",
+		Description: "comma separated hostnames and ips of the generated certificate"})
+	Register(&Setting{Key: "server.webAppPath", Env: "IRBANKMOCK_WEBAPP_PATH", Default: "./web/app/out",
+		Description: "directory of the built web app, overrides the one embedded in the binary"})
+	Register(&Setting{Key: "fixtures.path", Env: "IRBANKMOCK_FIXTURES_PATH",
+		Description: "yaml or json file of terminals and transactions seeded at startup"})
+	Register(&Setting{Key: "admin.token", Env: "IRBANKMOCK_ADMIN_TOKEN", Secret: true,
+		Description: "bearer token required by the management routes"})
+	Register(&Setting{Key: "admin.username", Env: "IRBANKMOCK_ADMIN_USERNAME",
+		Description: "basic auth username required by the management routes"})
+	Register(&Setting{Key: "admin.password", Env: "IRBANKMOCK_ADMIN_PASSWORD", Secret: true,
+		Description: "basic auth password of admin.username"})
+	Register(&Setting{Key: "webhook.maxAttempts", Env: "IRBANKMOCK_WEBHOOK_MAX_ATTEMPTS", Default: "8", Validate: ValidatePositiveInt,
+		Description: "attempts to deliver a webhook before giving up"})
+	Register(&Setting{Key: "ids.seed", Env: "IRBANKMOCK_ID_SEED",
+		Description: "seed of the tokens and reference numbers handed out, random if empty"})
+	Register(&Setting{Key: "inspector.retention", Env: "IRBANKMOCK_INSPECTOR_RETENTION", Default: "24h", Validate: ValidateDuration,
+		Description: "how long recorded exchanges are kept, 0 disables recording"})
+	Register(&Setting{Key: "inspector.redact", Env: "IRBANKMOCK_INSPECTOR_REDACT",
+		Description: "comma separated extra body fields and headers to redact in recorded exchanges"})
+}
+
+func validatePublicHostname(value string) error {
+	if value == "" {
+		return nil
+	}
+	if strings.ContainsAny(value, " \t\n") {
+		return errors.New("must not contain spaces")
+	}
+	if strings.Contains(value, "://") {
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("must be an http or https url")
+		}
+	}
+	return nil
+}
+
+// loopback and private networks, where ingresses and sidecars usually run
+const defaultTrustedProxies = "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+
+func validateTrustedProxies(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" || item == "*" || net.ParseIP(item) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(item); err != nil {
+			return fmt.Errorf("%q is not an ip or cidr", item)
+		}
+	}
+	return nil
+}
+
 func GetDataPath() string {
-	env := os.Getenv("IRBANKMOCK_DATA_PATH")
+	val := Get("data.path")
 
-	if env == "" {
+	if val == "" {
 		cwd, err := os.Getwd()
 		if err != nil {
 			return "."
@@ -18,59 +113,194 @@ func GetDataPath() string {
 		return cwd
 	}
 
-	return env
+	return val
 }
 
 func GetDbFileName() string {
-	env := os.Getenv("IRBANKMOCK_DB_NAME")
-	if env == "" {
-		return "irbankmock.db"
-	}
-	return env
+	return Get("db.name")
 }
 
 func GetDbPath() string {
 	return path.Join(GetDataPath(), GetDbFileName()+"?_pragma=foreign_keys(1)")
 }
 
-func GetListenAddress() string {
-	env := os.Getenv("IRBANKMOCK_SERVER_PORT")
-	if env == "" {
-		return ":3000"
+// IsInMemoryDb reports whether the sqlite database lives in memory only, nothing is
+// written to the data path and all data is lost on exit.
+func IsInMemoryDb() bool {
+	return GetBool("db.inMemory")
+}
+
+// GetInMemoryDbPath returns the path of a shared-cache in-memory database. Every
+// connection opened with the same name shares the database.
+func GetInMemoryDbPath(name string) string {
+	return "file:" + name + "?mode=memory&cache=shared&_pragma=foreign_keys(1)"
+}
+
+const DbDriverSqlite = "sqlite"
+const DbDriverPostgres = "postgres"
+const DbDriverMysql = "mysql"
+
+// GetDbDriver returns the database backend, one of sqlite (default), postgres or mysql.
+func GetDbDriver() string {
+	val := strings.ToLower(strings.TrimSpace(Get("db.driver")))
+	switch val {
+	case "":
+		return DbDriverSqlite
+	case "postgresql", "pgx":
+		return DbDriverPostgres
 	}
-	return env
+	return val
+}
+
+// GetDbDSN returns the connection string of postgres and mysql backends. sqlite
+// ignores it and uses the file at GetDbPath instead.
+func GetDbDSN() string {
+	return Get("db.dsn")
+}
+
+func GetListenAddress() string {
+	return Get("server.listen")
 }
 
 func ShouldAutoMigrate() bool {
-	env := os.Getenv("IRBANKMOCK_AUTOMIGRATE")
-	val, err := strconv.ParseBool(env)
-	if err != nil {
-		if env != "" {
-			fmt.Println("invalid value for IRBANKMOCK_AUTOMIGRATE value, falling-back to default=true")
-		}
+	// an in-memory database is always empty at start
+	if IsInMemoryDb() {
 		return true
 	}
-	return val
+	return GetBool("db.autoMigrate")
 }
 
 func IsGormLogDisabled() bool {
-	env := os.Getenv("IRBANKMOCK_DISABLE_GORM_LOG")
-	val, _ := strconv.ParseBool(env)
-	return val
+	return GetBool("db.disableLog")
 }
 
-func GetWebAppPath() string {
-	env := os.Getenv("IRBANKMOCK_WEBAPP_PATH")
-	if env == "" {
-		return "./web/app/out"
+func GetLogLevel() string {
+	return Get("log.level")
+}
+
+func GetLogFormat() string {
+	return Get("log.format")
+}
+
+func GetShutdownTimeout() time.Duration {
+	return GetDuration("server.shutdownTimeout")
+}
+
+// GetTLSListenAddress returns the listen address of the https server, empty if
+// https is disabled. It runs side by side with the http server.
+func GetTLSListenAddress() string {
+	return Get("server.tls.listen")
+}
+
+func GetTLSCertFile() string {
+	return Get("server.tls.certFile")
+}
+
+func GetTLSKeyFile() string {
+	return Get("server.tls.keyFile")
+}
+
+// hostnames and ips of the generated certificate, the host of the public hostname
+// is always included.
+func GetTLSHosts() []string {
+	hosts := GetList("server.tls.hosts")
+	if public := GetPublicHostname(); public != "" {
+		if !strings.Contains(public, "://") {
+			public = "http://" + public
+		}
+		u, err := url.Parse(public)
+		if err == nil && u.Hostname() != "" && !slices.Contains(hosts, u.Hostname()) {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	if len(hosts) == 0 {
+		return []string{"localhost"}
 	}
-	return env
+	return hosts
+}
+
+// directory of the generated ca and certificate
+func GetTLSPath() string {
+	return path.Join(GetDataPath(), "tls")
 }
 
+func GetWebAppPath() string {
+	return Get("server.webAppPath")
+}
+
+// IsWebAppPathSet reports whether the web app directory is configured, which wins over
+// the web app embedded in the binary.
+func IsWebAppPathSet() bool {
+	return IsSet("server.webAppPath")
+}
+
+// GetPublicHostname returns the configured base url of the service, with or without
+// a scheme. It is empty unless configured, the urls are then derived from the request.
 func GetPublicHostname() string {
-	env := os.Getenv("IRBANKMOCK_PUBLIC_HOSTNAME")
-	if env == "" {
-		return "misconfig.example.com"
+	return strings.TrimSuffix(Get("server.publicHostname"), "/")
+}
+
+// GetTrustedProxies returns the ips and cidrs of the trusted proxies, nil if all
+// proxies are trusted.
+func GetTrustedProxies() []string {
+	proxies := GetList("server.trustedProxies")
+	for _, p := range proxies {
+		if p == "*" {
+			return nil
+		}
 	}
-	return env
+	if proxies == nil {
+		return []string{}
+	}
+	return proxies
+}
+
+// path of a yaml/json file declaring terminals and transactions to be seeded at startup.
+// fixtures are not loaded if empty.
+func GetFixturesPath() string {
+	return Get("fixtures.path")
+}
+
+func GetSnapshotsPath() string {
+	return path.Join(GetDataPath(), "snapshots")
+}
+
+// static bearer token required for management routes. admin authentication is
+// disabled unless either a token or a username is set.
+func GetAdminToken() string {
+	return Get("admin.token")
+}
+
+// basic auth username required for management routes.
+func GetAdminUsername() string {
+	return Get("admin.username")
+}
+
+func GetAdminPassword() string {
+	return Get("admin.password")
+}
+
+func IsAdminAuthEnabled() bool {
+	return GetAdminToken() != "" || GetAdminUsername() != ""
+}
+
+// maximum number of attempts to deliver a webhook before giving up
+func GetWebhookMaxAttempts() int {
+	return GetInt("webhook.maxAttempts")
+}
+
+// how long the recorded http exchanges of merchant routes are kept, e.g. 24h.
+// recording is disabled if set to 0.
+func GetInspectorRetention() time.Duration {
+	return GetDuration("inspector.retention")
+}
+
+// seed of the identifiers handed out by the banks, they are random if empty
+func GetIdSeed() string {
+	return Get("ids.seed")
+}
+
+// extra body fields and headers to redact in recorded exchanges
+func GetInspectorRedactedFields() []string {
+	return GetList("inspector.redact")
 }
@@ -0,0 +1,343 @@
+package conf
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const SourceDefault = "default"
+const SourceFile = "file"
+const SourceEnv = "env"
+const SourceFlag = "flag"
+
+// env var holding the path of the config file, the -config flag takes precedence
+const configPathEnv = "IRBANKMOCK_CONFIG"
+
+const redacted = "[redacted]"
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// A Setting is a configuration value. It is looked up in the command line flags,
+// then the environment, then the config file, and falls back to Default.
+type Setting struct {
+	// dotted path of the setting in the config file, also the name of its flag
+	Key string
+	Env string
+	// raw default value, validated like the other sources
+	Default     string
+	Description string
+	// secret values are redacted from the effective configuration
+	Secret   bool
+	Validate func(value string) error
+}
+
+var settings = map[string]*Setting{}
+
+var fileValues = map[string]string{}
+var flagValues = map[string]string{}
+var configFile string
+
+// Register adds a setting. Settings must be registered before Load, i.e. in init.
+func Register(s *Setting) {
+	if _, ok := settings[s.Key]; ok {
+		panic("duplicate setting " + s.Key)
+	}
+	settings[s.Key] = s
+}
+
+// RegisterBank adds a setting of a bank, keyed banks.<bank>.<key> in the config file.
+func RegisterBank(bankName string, s *Setting) {
+	s.Key = "banks." + bankName + "." + s.Key
+	Register(s)
+}
+
+// Load parses the global flags in args, reads the config file and validates all
+// settings. It returns the arguments left after the flags. The flags and the file of
+// a previous Load are dropped.
+func Load(args []string) ([]string, error) {
+	flagValues = map[string]string{}
+	fileValues = map[string]string{}
+	configFile = ""
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	path := fs.String("config", os.Getenv(configPathEnv), "path of a yaml, json or toml config file")
+	for _, s := range sortedSettings() {
+		key := s.Key
+		fs.Func(key, s.Description, func(v string) error {
+			flagValues[key] = v
+			return nil
+		})
+	}
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return []string{"help"}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err.Error())
+	}
+
+	if *path != "" {
+		err = readFile(*path)
+		if err != nil {
+			return nil, err
+		}
+		configFile = *path
+	}
+	return fs.Args(), Validate()
+}
+
+func readFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	// json is a subset of yaml, toml files are told apart by their extension
+	var root map[string]any
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(content, &root)
+	} else {
+		err = yaml.Unmarshal(content, &root)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidConfig, path, err.Error())
+	}
+	values := map[string]string{}
+	flatten("", root, values)
+
+	var errs []error
+	for key := range values {
+		if _, ok := settings[key]; !ok {
+			errs = append(errs, fmt.Errorf("%w: unknown setting %s in %s", ErrInvalidConfig, key, path))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	fileValues = values
+	return nil
+}
+
+// flatten turns the nested mappings of the file into dotted keys. Lists are joined
+// with commas, like their env vars.
+func flatten(prefix string, node map[string]any, out map[string]string) {
+	for k, v := range node {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			flatten(key, val, out)
+		case []any:
+			items := make([]string, len(val))
+			for i, item := range val {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(val)
+		}
+	}
+}
+
+// Validate checks the effective value of every setting and returns all problems at once.
+func Validate() error {
+	var errs []error
+	for _, s := range sortedSettings() {
+		if s.Validate == nil {
+			continue
+		}
+		value, source := lookup(s)
+		err := s.Validate(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s (%s) %s", ErrInvalidConfig, s.Key, describeSource(s, source), err.Error()))
+		}
+	}
+	if GetDbDriver() != DbDriverSqlite && GetDbDSN() == "" {
+		errs = append(errs, fmt.Errorf("%w: db.dsn is required by the %s driver", ErrInvalidConfig, GetDbDriver()))
+	}
+	if (GetTLSCertFile() == "") != (GetTLSKeyFile() == "") {
+		errs = append(errs, fmt.Errorf("%w: server.tls.certFile and server.tls.keyFile must be set together", ErrInvalidConfig))
+	}
+	if GetListenAddress() == "" && GetTLSListenAddress() == "" {
+		errs = append(errs, fmt.Errorf("%w: either server.listen or server.tls.listen is required", ErrInvalidConfig))
+	}
+	if GetAdminUsername() != "" && GetAdminPassword() == "" {
+		errs = append(errs, fmt.Errorf("%w: admin.password is required along with admin.username", ErrInvalidConfig))
+	}
+	return errors.Join(errs...)
+}
+
+func describeSource(s *Setting, source string) string {
+	switch source {
+	case SourceEnv:
+		return s.Env
+	case SourceFlag:
+		return "-" + s.Key
+	case SourceFile:
+		return configFile
+	}
+	return source
+}
+
+func lookup(s *Setting) (string, string) {
+	if v, ok := flagValues[s.Key]; ok {
+		return v, SourceFlag
+	}
+	// empty env vars count as unset, like compose files passing through missing variables
+	if s.Env != "" {
+		if v := os.Getenv(s.Env); v != "" {
+			return v, SourceEnv
+		}
+	}
+	if v, ok := fileValues[s.Key]; ok {
+		return v, SourceFile
+	}
+	return s.Default, SourceDefault
+}
+
+// Get returns the effective value of a registered setting.
+func Get(key string) string {
+	s, ok := settings[key]
+	if !ok {
+		panic("unknown setting " + key)
+	}
+	value, _ := lookup(s)
+	return value
+}
+
+// IsSet reports whether a setting is given by a flag, env var or the config file
+// rather than falling back to its default.
+func IsSet(key string) bool {
+	s, ok := settings[key]
+	if !ok {
+		panic("unknown setting " + key)
+	}
+	_, source := lookup(s)
+	return source != SourceDefault
+}
+
+// GetBool, GetInt and GetDuration parse the value of settings validated with the
+// matching validator.
+func GetBool(key string) bool {
+	val, _ := strconv.ParseBool(Get(key))
+	return val
+}
+
+func GetInt(key string) int {
+	val, _ := strconv.Atoi(Get(key))
+	return val
+}
+
+func GetDuration(key string) time.Duration {
+	val, _ := time.ParseDuration(Get(key))
+	return val
+}
+
+func GetList(key string) []string {
+	value := Get(key)
+	if value == "" {
+		return nil
+	}
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// EffectiveSetting is the resolved value of a setting and where it came from.
+type EffectiveSetting struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Source      string `json:"source"`
+	Env         string `json:"env,omitempty"`
+	Description string `json:"description"`
+}
+
+// Effective returns all settings ordered by key, with the secret values redacted.
+func Effective() []*EffectiveSetting {
+	var result []*EffectiveSetting
+	for _, s := range sortedSettings() {
+		value, source := lookup(s)
+		if s.Secret && value != "" {
+			value = redacted
+		}
+		result = append(result, &EffectiveSetting{
+			Key:         s.Key,
+			Value:       value,
+			Source:      source,
+			Env:         s.Env,
+			Description: s.Description,
+		})
+	}
+	return result
+}
+
+// ConfigFile returns the path of the loaded config file, empty if none.
+func ConfigFile() string {
+	return configFile
+}
+
+func sortedSettings() []*Setting {
+	result := make([]*Setting, 0, len(settings))
+	for _, s := range settings {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+func ValidateBool(value string) error {
+	_, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.New("must be true or false")
+	}
+	return nil
+}
+
+func ValidatePositiveInt(value string) error {
+	val, err := strconv.Atoi(value)
+	if err != nil || val <= 0 {
+		return errors.New("must be a positive number")
+	}
+	return nil
+}
+
+// ValidateDuration accepts durations like 30m or 24h, zero included.
+func ValidateDuration(value string) error {
+	val, err := time.ParseDuration(value)
+	if err != nil || val < 0 {
+		return errors.New("must be a duration like 30m or 24h")
+	}
+	return nil
+}
+
+func ValidateOneOf(values ...string) func(string) error {
+	return func(value string) error {
+		for _, v := range values {
+			if strings.EqualFold(strings.TrimSpace(value), v) {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+	}
+}
@@ -0,0 +1,157 @@
+package conf_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+)
+
+// clearEnv unsets the env vars of the settings used by the tests, empty counts as unset.
+func clearEnv(t *testing.T) {
+	for _, env := range []string{"IRBANKMOCK_CONFIG", "IRBANKMOCK_LOG_LEVEL", "IRBANKMOCK_LOG_FORMAT", "IRBANKMOCK_DB_IN_MEMORY", "IRBANKMOCK_ADMIN_TOKEN", "IRBANKMOCK_DB_DSN", "IRBANKMOCK_TLS_HOSTS"} {
+		t.Setenv(env, "")
+	}
+}
+
+// load runs conf.Load with the given flags and the config file content, if any.
+func load(t *testing.T, args []string, fileName string, content string) ([]string, error) {
+	t.Helper()
+	t.Cleanup(func() { conf.Load(nil) })
+	if fileName != "" {
+		path := filepath.Join(t.TempDir(), fileName)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+	return conf.Load(args)
+}
+
+func effective(t *testing.T, key string) *conf.EffectiveSetting {
+	t.Helper()
+	for _, s := range conf.Effective() {
+		if s.Key == key {
+			return s
+		}
+	}
+	t.Fatalf("setting %s is not effective", key)
+	return nil
+}
+
+func TestPrecedence(t *testing.T) {
+	file := "log:\n  level: warn\n"
+	cases := []struct {
+		name       string
+		env        string
+		args       []string
+		fileName   string
+		wantValue  string
+		wantSource string
+	}{
+		{"default", "", nil, "", "info", conf.SourceDefault},
+		{"file over default", "", nil, "config.yaml", "warn", conf.SourceFile},
+		{"env over file", "error", nil, "config.yaml", "error", conf.SourceEnv},
+		{"flag over env", "error", []string{"-log.level", "debug"}, "config.yaml", "debug", conf.SourceFlag},
+		{"empty env is unset", "", nil, "config.yaml", "warn", conf.SourceFile},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("IRBANKMOCK_LOG_LEVEL", tc.env)
+			args, err := load(t, append(tc.args, "serve"), tc.fileName, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, []string{"serve"}) {
+				t.Errorf("left arguments are %v, want [serve]", args)
+			}
+			s := effective(t, "log.level")
+			if s.Value != tc.wantValue || s.Source != tc.wantSource {
+				t.Errorf("log.level is %q from %s, want %q from %s", s.Value, s.Source, tc.wantValue, tc.wantSource)
+			}
+			if conf.Get("log.level") != tc.wantValue {
+				t.Errorf("Get returned %q, want %q", conf.Get("log.level"), tc.wantValue)
+			}
+		})
+	}
+}
+
+func TestFileFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "log:\n  level: warn\ndb:\n  inMemory: true\nserver:\n  tls:\n    hosts: [localhost, example.com]\n",
+		"config.json": `{"log": {"level": "warn"}, "db": {"inMemory": true}, "server": {"tls": {"hosts": ["localhost", "example.com"]}}}`,
+		"config.toml": "[log]\nlevel = \"warn\"\n\n[db]\ninMemory = true\n\n[server.tls]\nhosts = [\"localhost\", \"example.com\"]\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			clearEnv(t)
+			if _, err := load(t, nil, name, content); err != nil {
+				t.Fatal(err)
+			}
+			if got := conf.Get("log.level"); got != "warn" {
+				t.Errorf("log.level is %q, want warn", got)
+			}
+			if !conf.GetBool("db.inMemory") {
+				t.Error("db.inMemory is not set")
+			}
+			if got := conf.GetList("server.tls.hosts"); !reflect.DeepEqual(got, []string{"localhost", "example.com"}) {
+				t.Errorf("server.tls.hosts is %v", got)
+			}
+			if conf.ConfigFile() == "" {
+				t.Error("the config file is not reported")
+			}
+		})
+	}
+}
+
+func TestUnknownFileKey(t *testing.T) {
+	clearEnv(t)
+	_, err := load(t, nil, "config.yaml", "log:\n  level: warn\n  colour: true\n")
+	if !errors.Is(err, conf.ErrInvalidConfig) {
+		t.Fatalf("loading an unknown key returned %v", err)
+	}
+	if !strings.Contains(err.Error(), "log.colour") {
+		t.Errorf("the error doesn't name the key: %v", err)
+	}
+}
+
+func TestValidateReportsEverySetting(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("IRBANKMOCK_LOG_LEVEL", "loud")
+	_, err := load(t, []string{"-db.inMemory", "maybe"}, "config.yaml", "log:\n  format: xml\n")
+	if !errors.Is(err, conf.ErrInvalidConfig) {
+		t.Fatalf("loading invalid settings returned %v", err)
+	}
+	for _, want := range []string{"log.level (IRBANKMOCK_LOG_LEVEL)", "db.inMemory (-db.inMemory)", "log.format (" + conf.ConfigFile() + ")"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("the error doesn't report %s: %v", want, err)
+		}
+	}
+}
+
+func TestEffectiveRedactsSecrets(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("IRBANKMOCK_ADMIN_TOKEN", "hunter2")
+	if _, err := load(t, nil, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	token := effective(t, "admin.token")
+	if token.Value == "hunter2" || token.Value == "" {
+		t.Errorf("the admin token is shown as %q", token.Value)
+	}
+	if token.Source != conf.SourceEnv || token.Env != "IRBANKMOCK_ADMIN_TOKEN" {
+		t.Errorf("the admin token is from %s %s", token.Source, token.Env)
+	}
+	if dsn := effective(t, "db.dsn"); dsn.Value != "" {
+		t.Errorf("the unset dsn is shown as %q", dsn.Value)
+	}
+	if level := effective(t, "log.level"); level.Value != "info" {
+		t.Errorf("log.level is shown as %q", level.Value)
+	}
+}
@@ -1,13 +1,18 @@
 package dbutils
 
 import (
+	"database/sql"
 	"errors"
-	"log"
-	"time"
+	"fmt"
+	"sync"
 
 	"github.com/abramad-labs/irbankmock/internal/conf"
 	"github.com/glebarez/sqlite"
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -18,26 +23,151 @@ var key dbCtxKeyType
 
 var gormLogger logger.Interface
 
+var closeHooksMu sync.Mutex
+var closeHooks []func(pool *sql.DB)
+
+var ErrUnknownDriver = errors.New("unknown database driver")
+var ErrMissingDSN = errors.New("IRBANKMOCK_DB_DSN is required for this database driver")
+var ErrInMemoryDriver = errors.New("in-memory database is only supported by the sqlite driver")
+
 func InitializeDb() (*gorm.DB, error) {
-	dbpath := conf.GetDbPath()
-	db, err := gorm.Open(sqlite.Open(dbpath), &gorm.Config{})
+	dialector, err := openDialector(conf.GetDbDriver())
 	if err != nil {
 		return nil, err
 	}
-	if err = db.Exec("PRAGMA foreign_keys = ON;").Error; err != nil {
-		log.Fatalf("could not enable foreign keys on sqlite: %s", err.Error())
+	return open(dialector, conf.IsInMemoryDb())
+}
+
+// OpenInMemory opens an empty in-memory sqlite database regardless of the configured
+// driver, e.g. for the test servers of the unit tests of other services.
+func OpenInMemory() (*gorm.DB, error) {
+	return open(sqlite.Open(inMemoryPath()), true)
+}
+
+// a unique name per database, so every server of a process starts clean
+func inMemoryPath() string {
+	return conf.GetInMemoryDbPath("irbankmock-" + uuid.NewString())
+}
+
+func open(dialector gorm.Dialector, inMemory bool) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: newLogger(logger.Warn)})
+	if err != nil {
+		return nil, err
+	}
+	if IsSqlite(db) {
+		if err = db.Exec("PRAGMA foreign_keys = ON;").Error; err != nil {
+			return nil, fmt.Errorf("could not enable foreign keys on sqlite: %w", err)
+		}
+	}
+	if inMemory {
+		// the in-memory database is dropped as soon as its last connection closes, so
+		// idle connections are kept open for the lifetime of the process
+		sqlDb, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDb.SetMaxIdleConns(4)
+		sqlDb.SetConnMaxIdleTime(0)
+		sqlDb.SetConnMaxLifetime(0)
 	}
 
-	gormLogger = logger.New(log.Default(), logger.Config{
-		SlowThreshold:             365 * 24 * time.Hour,
-		LogLevel:                  logger.Info,
-		IgnoreRecordNotFoundError: true,
-		Colorful:                  false,
-	})
+	gormLogger = newLogger(logger.Info)
 
 	return db, err
 }
 
+func openDialector(driver string) (gorm.Dialector, error) {
+	if conf.IsInMemoryDb() && driver != conf.DbDriverSqlite {
+		return nil, ErrInMemoryDriver
+	}
+	switch driver {
+	case conf.DbDriverSqlite:
+		if conf.IsInMemoryDb() {
+			return sqlite.Open(inMemoryPath()), nil
+		}
+		return sqlite.Open(conf.GetDbPath()), nil
+	case conf.DbDriverPostgres:
+		dsn := conf.GetDbDSN()
+		if dsn == "" {
+			return nil, ErrMissingDSN
+		}
+		return postgres.Open(dsn), nil
+	case conf.DbDriverMysql:
+		dsn := conf.GetDbDSN()
+		if dsn == "" {
+			return nil, ErrMissingDSN
+		}
+		cfg, err := mysqldriver.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mysql dsn: %w", err)
+		}
+		// time columns are scanned into time.Time which mysql only does with parseTime
+		cfg.ParseTime = true
+		return mysql.Open(cfg.FormatDSN()), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownDriver, driver)
+}
+
+// IsSqlite reports whether db is backed by sqlite. Some features like snapshots rely
+// on sqlite specific sql.
+func IsSqlite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// SupportsReturning reports whether inserts and updates of db can return the rows
+// they wrote, mysql can't.
+func SupportsReturning(db *gorm.DB) bool {
+	return db.Dialector.Name() != "mysql"
+}
+
+// SyncSequence moves the id sequence of the model's table past its largest id.
+// Postgres doesn't advance the sequence when rows are inserted with explicit ids,
+// other databases do so it's a no-op there.
+func SyncSequence(db *gorm.DB, model any) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	return db.Exec(
+		"SELECT setval(pg_get_serial_sequence(?, 'id'), COALESCE((SELECT MAX(id) FROM "+
+			stmt.Quote(stmt.Table)+"), 0) + 1, false)",
+		stmt.Table,
+	).Error
+}
+
+// Close closes the connections of the database.
+func Close(db *gorm.DB) error {
+	sqlDb, err := db.DB()
+	if err != nil {
+		return err
+	}
+	closeHooksMu.Lock()
+	hooks := closeHooks
+	closeHooksMu.Unlock()
+	for _, hook := range hooks {
+		hook(sqlDb)
+	}
+	return sqlDb.Close()
+}
+
+// Pool returns the connection pool of db, also of its sessions and transactions. The
+// state packages keep per server, e.g. the metrics of the test servers running in one
+// process, is keyed by it.
+func Pool(db *gorm.DB) *sql.DB {
+	sqlDb, _ := db.DB()
+	return sqlDb
+}
+
+// OnClose registers fn to drop the state kept for the pool once Close closes it.
+func OnClose(fn func(pool *sql.DB)) {
+	closeHooksMu.Lock()
+	defer closeHooksMu.Unlock()
+	closeHooks = append(closeHooks, fn)
+}
+
 func ContextWithDb(c *fiber.Ctx, db *gorm.DB) *fiber.Ctx {
 	c.Locals(key, db)
 	return c
@@ -48,8 +178,9 @@ func GetDb(c *fiber.Ctx) (*gorm.DB, error) {
 	if db == nil {
 		return nil, errors.New("db is not initialized")
 	}
+	// the context carries the request id to the sql logs
 	if conf.IsGormLogDisabled() || gormLogger == nil {
-		return db.Session(&gorm.Session{}), nil
+		return db.Session(&gorm.Session{Context: c.UserContext()}), nil
 	}
-	return db.Session(&gorm.Session{Logger: gormLogger}), nil
+	return db.Session(&gorm.Session{Context: c.UserContext(), Logger: gormLogger}), nil
 }
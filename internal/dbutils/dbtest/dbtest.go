@@ -0,0 +1,66 @@
+// Package dbtest opens the databases of the tests. They run on a fresh in-memory
+// sqlite database unless IRBANKMOCK_TEST_DB_DRIVER selects another backend, e.g.
+//
+//	IRBANKMOCK_TEST_DB_DRIVER=postgres \
+//	IRBANKMOCK_TEST_DB_DSN="host=localhost user=postgres password=postgres dbname=irbankmock_test" \
+//	go test ./...
+//
+// The database must be a disposable one, every test drops all of its tables.
+package dbtest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"gorm.io/gorm"
+)
+
+const DriverEnv = "IRBANKMOCK_TEST_DB_DRIVER"
+const DSNEnv = "IRBANKMOCK_TEST_DB_DSN"
+
+// Open returns an empty database which is closed by t.Cleanup. Tests using it must not
+// run in parallel when a shared backend is selected.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	driver := os.Getenv(DriverEnv)
+	if driver == "" {
+		db, err := dbutils.OpenInMemory()
+		if err != nil {
+			t.Fatalf("failed to open the in-memory database: %v", err)
+		}
+		t.Cleanup(func() { dbutils.Close(db) })
+		return db
+	}
+
+	t.Setenv("IRBANKMOCK_DB_DRIVER", driver)
+	t.Setenv("IRBANKMOCK_DB_DSN", os.Getenv(DSNEnv))
+	t.Setenv("IRBANKMOCK_DB_IN_MEMORY", "")
+	db, err := dbutils.InitializeDb()
+	if err != nil {
+		t.Fatalf("failed to open the %s test database: %v", driver, err)
+	}
+	dropTables(t, db)
+	t.Cleanup(func() {
+		dropTables(t, db)
+		dbutils.Close(db)
+	})
+	return db
+}
+
+func dropTables(t testing.TB, db *gorm.DB) {
+	t.Helper()
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		t.Fatalf("failed to list the tables of the test database: %v", err)
+	}
+	values := make([]any, 0, len(tables))
+	for _, table := range tables {
+		values = append(values, table)
+	}
+	// postgres and mysql drop the tables regardless of the foreign keys between them
+	err = db.Migrator().DropTable(values...)
+	if err != nil {
+		t.Fatalf("failed to drop the tables of the test database: %v", err)
+	}
+}
@@ -1,39 +1,359 @@
 package migration
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
-type Migration func(gorm.Migrator) error
+const VersionsTableName = "schema_migrations"
+const LockTableName = "schema_migration_locks"
 
-var migrations []MigrationNamePair
+const lockTimeout = time.Minute
+const lockRetryInterval = 500 * time.Millisecond
 
-type MigrationNamePair struct {
+// the holder of the lock refreshes it while migrating, a lock that wasn't refreshed
+// for staleLockAge is left by a crashed instance and gets taken over
+const lockHeartbeatInterval = 10 * time.Second
+const staleLockAge = 30 * time.Second
+
+var ErrLocked = errors.New("migrations are locked by another instance")
+var ErrNoDownMigration = errors.New("migration can not be rolled back")
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+// A Migration changes the schema or the data of the database. Versions order the
+// migrations of all packages, use the date they were written in the form of
+// YYYYMMDDNN, e.g. 2025060101. Released migrations must never be changed, add a
+// new one instead.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	// optional, migrations without Down can't be rolled back
+	Down func(tx *gorm.DB) error
+}
+
+var migrations = map[int64]*Migration{}
+
+type appliedMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
 	Name      string
-	Migration Migration
+	AppliedAt time.Time
+}
+
+func (appliedMigration) TableName() string {
+	return VersionsTableName
+}
+
+type migrationLock struct {
+	ID       int `gorm:"primaryKey;autoIncrement:false"`
+	LockedBy string
+	LockedAt time.Time
+}
+
+func (migrationLock) TableName() string {
+	return LockTableName
+}
+
+func Register(m *Migration) {
+	if m.Version <= 0 || m.Up == nil {
+		panic(fmt.Sprintf("invalid migration %d %s", m.Version, m.Name))
+	}
+	if existing, ok := migrations[m.Version]; ok {
+		panic(fmt.Sprintf("migration version %d is used by both %s and %s", m.Version, existing.Name, m.Name))
+	}
+	migrations[m.Version] = m
+}
+
+func sorted() []*Migration {
+	result := make([]*Migration, 0, len(migrations))
+	for _, m := range migrations {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+// StatusEntry is a registered or applied migration. Migrations applied by a newer
+// version of the service are not registered and reported as unknown.
+type StatusEntry struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt"`
+	Unknown   bool       `json:"unknown"`
+}
+
+func ensureTables(db *gorm.DB) error {
+	return db.Migrator().AutoMigrate(&appliedMigration{}, &migrationLock{})
+}
+
+// appliedRows returns the applied migrations, latest first, at most limit of them
+// unless limit is zero. A database that was never migrated has none.
+func appliedRows(db *gorm.DB, limit int) ([]*appliedMigration, error) {
+	var rows []*appliedMigration
+	if !db.Migrator().HasTable(&appliedMigration{}) {
+		return rows, nil
+	}
+	query := db.Order("version desc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func applied(db *gorm.DB) (map[int64]*appliedMigration, error) {
+	rows, err := appliedRows(db, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int64]*appliedMigration, len(rows))
+	for _, r := range rows {
+		result[r.Version] = r
+	}
+	return result, nil
+}
+
+// Status lists the registered and applied migrations. It only reads, so it doesn't
+// create the tables of the migrations on a database that was never migrated.
+func Status(db *gorm.DB) ([]*StatusEntry, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var result []*StatusEntry
+	for _, m := range sorted() {
+		entry := &StatusEntry{Version: m.Version, Name: m.Name}
+		if a, ok := done[m.Version]; ok {
+			entry.Applied = true
+			entry.AppliedAt = &a.AppliedAt
+			delete(done, m.Version)
+		}
+		result = append(result, entry)
+	}
+	for _, a := range done {
+		result = append(result, &StatusEntry{
+			Version:   a.Version,
+			Name:      a.Name,
+			Applied:   true,
+			AppliedAt: &a.AppliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
 }
 
-func init() {
-	migrations = make([]MigrationNamePair, 0)
+// SchemaVersion returns the latest applied migration and the number of registered
+// migrations that are not applied yet. It only reads the applied versions, so it's
+// cheap enough for readiness probes.
+func SchemaVersion(db *gorm.DB) (int64, int, error) {
+	done, err := applied(db)
+	if err != nil {
+		return 0, 0, err
+	}
+	var version int64
+	for v := range done {
+		version = max(version, v)
+	}
+	missing := 0
+	for _, m := range migrations {
+		if _, ok := done[m.Version]; !ok {
+			missing++
+		}
+	}
+	return version, missing, nil
+}
+
+type UpOptions struct {
+	// only report the pending migrations
+	DryRun bool
+	// apply the migrations up to and including this version, zero for all
+	Target int64
+}
+
+func pending(db *gorm.DB, target int64) ([]*Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	var result []*Migration
+	for _, m := range sorted() {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := done[m.Version]; !ok {
+			result = append(result, m)
+		}
+	}
+	return result, nil
 }
 
-func RegisterMigration(name string, migration Migration) {
-	migrations = append(migrations, MigrationNamePair{
-		Name:      name,
-		Migration: migration,
+// Up applies the pending migrations in order and returns them. Every migration runs
+// in its own transaction along with recording its version. A dry run only reads.
+func Up(db *gorm.DB, opts UpOptions) ([]*Migration, error) {
+	if opts.DryRun {
+		return pending(db, opts.Target)
+	}
+	var result []*Migration
+	err := withLock(db, func() error {
+		todo, err := pending(db, opts.Target)
+		if err != nil {
+			return err
+		}
+		for _, m := range todo {
+			slog.Info("migration up", "version", m.Version, "name", m.Name)
+			err = db.Transaction(func(tx *gorm.DB) error {
+				err := m.Up(tx)
+				if err != nil {
+					return err
+				}
+				return tx.Create(&appliedMigration{
+					Version:   m.Version,
+					Name:      m.Name,
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s failed: %w", m.Version, m.Name, err)
+			}
+			result = append(result, m)
+		}
+		return nil
 	})
+	return result, err
 }
 
-func ApplyMigrations(migrator gorm.Migrator) error {
-	for _, mig := range migrations {
-		log.Printf("auto migration: %s", mig.Name)
-		err := mig.Migration(migrator)
+type DownOptions struct {
+	// only report the migrations that would be rolled back
+	DryRun bool
+	// number of migrations to roll back, defaults to one
+	Steps int
+}
+
+// latest returns the last steps applied migrations, latest first, failing if any of
+// them can't be rolled back.
+func latest(db *gorm.DB, steps int) ([]*Migration, error) {
+	rows, err := appliedRows(db, steps)
+	if err != nil {
+		return nil, err
+	}
+	var result []*Migration
+	for _, r := range rows {
+		m, ok := migrations[r.Version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, r.Version)
+		}
+		if m.Down == nil {
+			return nil, fmt.Errorf("%w: %d %s", ErrNoDownMigration, m.Version, m.Name)
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// Down rolls back the latest applied migrations and returns them. A dry run only
+// reads.
+func Down(db *gorm.DB, opts DownOptions) ([]*Migration, error) {
+	steps := opts.Steps
+	if steps <= 0 {
+		steps = 1
+	}
+	if opts.DryRun {
+		return latest(db, steps)
+	}
+	var result []*Migration
+	err := withLock(db, func() error {
+		todo, err := latest(db, steps)
 		if err != nil {
 			return err
 		}
+		for _, m := range todo {
+			slog.Info("migration down", "version", m.Version, "name", m.Name)
+			err = db.Transaction(func(tx *gorm.DB) error {
+				err := m.Down(tx)
+				if err != nil {
+					return err
+				}
+				return tx.Delete(&appliedMigration{}, m.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rolling back migration %d %s failed: %w", m.Version, m.Name, err)
+			}
+			result = append(result, m)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// withLock runs fn while holding the migration lock, so two instances sharing a
+// database don't migrate it at the same time.
+func withLock(db *gorm.DB, fn func() error) error {
+	err := ensureTables(db)
+	if err != nil {
+		return err
 	}
-	migrations = nil
-	return nil
+
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), uuid.NewString())
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err = db.Create(&migrationLock{ID: 1, LockedBy: owner, LockedAt: time.Now()}).Error
+		if err == nil {
+			break
+		}
+		var lock migrationLock
+		if db.Take(&lock, 1).Error == nil && time.Since(lock.LockedAt) > staleLockAge {
+			slog.Warn("removing stale migration lock", "lockedBy", lock.LockedBy)
+			db.Where("id = 1 AND locked_by = ?", lock.LockedBy).Delete(&migrationLock{})
+			continue
+		}
+		if time.Now().After(deadline) {
+			return ErrLocked
+		}
+		time.Sleep(lockRetryInterval)
+	}
+	stopHeartbeat := make(chan struct{})
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(lockHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopHeartbeat:
+				return
+			case <-ticker.C:
+				err := db.Model(&migrationLock{}).Where("id = 1 AND locked_by = ?", owner).
+					UpdateColumn("locked_at", time.Now()).Error
+				if err != nil {
+					slog.Warn("failed to refresh the migration lock", "error", err)
+				}
+			}
+		}
+	}()
+	defer func() {
+		close(stopHeartbeat)
+		<-heartbeatDone
+		err := db.Where("id = 1 AND locked_by = ?", owner).Delete(&migrationLock{}).Error
+		if err != nil {
+			slog.Error("failed to release the migration lock", "error", err)
+		}
+	}()
+	return fn()
 }
@@ -0,0 +1,107 @@
+package migration_test
+
+import (
+	"testing"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils/dbtest"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	// register the migrations of every package
+	_ "github.com/abramad-labs/irbankmock/internal/banks"
+	_ "github.com/abramad-labs/irbankmock/internal/server"
+)
+
+func TestUpAppliesEveryMigration(t *testing.T) {
+	db := dbtest.Open(t)
+
+	applied, err := migration.Up(db, migration.UpOptions{})
+	if err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	if len(applied) == 0 {
+		t.Fatal("up applied no migrations")
+	}
+	status, err := migration.Status(db)
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if len(status) != len(applied) {
+		t.Fatalf("status lists %d migrations, up applied %d", len(status), len(applied))
+	}
+	for _, entry := range status {
+		if !entry.Applied {
+			t.Errorf("migration %d %s is not applied", entry.Version, entry.Name)
+		}
+	}
+	version, pending, err := migration.SchemaVersion(db)
+	if err != nil {
+		t.Fatalf("schema version failed: %v", err)
+	}
+	if pending != 0 || version != applied[len(applied)-1].Version {
+		t.Errorf("schema version is %d with %d pending, want %d with none", version, pending, applied[len(applied)-1].Version)
+	}
+
+	again, err := migration.Up(db, migration.UpOptions{})
+	if err != nil {
+		t.Fatalf("second up failed: %v", err)
+	}
+	if len(again) != 0 {
+		t.Errorf("second up applied %d migrations", len(again))
+	}
+}
+
+func TestDownRollsBackEveryMigration(t *testing.T) {
+	db := dbtest.Open(t)
+
+	applied, err := migration.Up(db, migration.UpOptions{})
+	if err != nil {
+		t.Fatalf("up failed: %v", err)
+	}
+	rolledBack, err := migration.Down(db, migration.DownOptions{Steps: len(applied)})
+	if err != nil {
+		t.Fatalf("down failed: %v", err)
+	}
+	if len(rolledBack) != len(applied) {
+		t.Fatalf("down rolled back %d migrations, want %d", len(rolledBack), len(applied))
+	}
+	for i, m := range rolledBack {
+		if want := applied[len(applied)-1-i].Version; m.Version != want {
+			t.Errorf("migration %d was rolled back as #%d, want %d", m.Version, i, want)
+		}
+	}
+
+	reapplied, err := migration.Up(db, migration.UpOptions{})
+	if err != nil {
+		t.Fatalf("up after down failed: %v", err)
+	}
+	if len(reapplied) != len(applied) {
+		t.Errorf("up after down applied %d migrations, want %d", len(reapplied), len(applied))
+	}
+}
+
+func TestStatusAndDryRunOnlyRead(t *testing.T) {
+	db := dbtest.Open(t)
+
+	status, err := migration.Status(db)
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	for _, entry := range status {
+		if entry.Applied {
+			t.Errorf("migration %d %s is applied on an empty database", entry.Version, entry.Name)
+		}
+	}
+	planned, err := migration.Up(db, migration.UpOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if len(planned) != len(status) {
+		t.Errorf("dry run plans %d migrations, status lists %d", len(planned), len(status))
+	}
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 0 {
+		t.Errorf("status and dry run created the tables %v", tables)
+	}
+}
@@ -0,0 +1,345 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidName = errors.New("snapshot name may only contain letters, digits, '-' and '_'")
+var ErrNotFound = errors.New("snapshot not found")
+var ErrAlreadyExists = errors.New("snapshot already exists")
+var ErrInvalidDbFile = errors.New("file is not a valid sqlite database")
+var ErrUnsupportedDriver = errors.New("snapshots are only supported on sqlite databases")
+
+const snapshotExt = ".db"
+
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+var nameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+type ResetOptions struct {
+	KeepTerminals bool
+}
+
+// A Resetter removes the data of a bank. Resetters run inside a single transaction.
+type Resetter func(tx *gorm.DB, opts ResetOptions) error
+
+var resetters []Resetter
+
+func RegisterResetter(resetter Resetter) {
+	resetters = append(resetters, resetter)
+}
+
+var replacedHooks []func(db *gorm.DB)
+
+// OnReplaced registers fn to run once Reset or RestoreFile replaced the data, e.g. to
+// drop what was cached of it. It must be called in init.
+func OnReplaced(fn func(db *gorm.DB)) {
+	replacedHooks = append(replacedHooks, fn)
+}
+
+func replaced(db *gorm.DB) {
+	for _, fn := range replacedHooks {
+		fn(db)
+	}
+}
+
+type Info struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func Reset(db *gorm.DB, opts ResetOptions) error {
+	defer replaced(db)
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, r := range resetters {
+			if err := r(tx, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func snapshotPath(name string) (string, error) {
+	if !nameRegex.MatchString(name) {
+		return "", ErrInvalidName
+	}
+	return path.Join(conf.GetSnapshotsPath(), name+snapshotExt), nil
+}
+
+func List() ([]*Info, error) {
+	entries, err := os.ReadDir(conf.GetSnapshotsPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []*Info{}, nil
+		}
+		return nil, err
+	}
+
+	result := make([]*Info, 0, len(entries))
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), snapshotExt)
+		if e.IsDir() || !ok || !nameRegex.MatchString(name) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &Info{
+			Name:      name,
+			Size:      fi.Size(),
+			CreatedAt: fi.ModTime(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// Supported returns ErrUnsupportedDriver if the database can't be exported or
+// restored. Reset works on every database.
+func Supported(db *gorm.DB) error {
+	if !dbutils.IsSqlite(db) {
+		return ErrUnsupportedDriver
+	}
+	return nil
+}
+
+func Create(db *gorm.DB, name string) (*Info, error) {
+	if err := Supported(db); err != nil {
+		return nil, err
+	}
+	dst, err := snapshotPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(dst); err == nil {
+		return nil, ErrAlreadyExists
+	}
+	err = os.MkdirAll(conf.GetSnapshotsPath(), 0o755)
+	if err != nil {
+		return nil, err
+	}
+	err = Export(db, dst)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(dst)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("snapshot created", "name", name)
+	return &Info{Name: name, Size: fi.Size(), CreatedAt: fi.ModTime()}, nil
+}
+
+// Export writes a consistent copy of the database into dst which must not exist.
+func Export(db *gorm.DB, dst string) error {
+	if err := Supported(db); err != nil {
+		return err
+	}
+	err := db.Exec("VACUUM INTO ?", dst).Error
+	if err != nil {
+		return fmt.Errorf("failed to export database: %w", err)
+	}
+	return nil
+}
+
+func Delete(name string) error {
+	src, err := snapshotPath(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Path returns the file path of an existing snapshot.
+func Path(name string) (string, error) {
+	src, err := snapshotPath(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Stat(src); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return src, nil
+}
+
+func Restore(db *gorm.DB, name string) error {
+	src, err := Path(name)
+	if err != nil {
+		return err
+	}
+	err = RestoreFile(db, src)
+	if err != nil {
+		return err
+	}
+	slog.Info("snapshot restored", "name", name)
+	return nil
+}
+
+// Save stores the uploaded database file as a snapshot. An existing snapshot of the
+// name is only replaced if overwrite is set, ErrAlreadyExists is returned otherwise.
+func Save(name string, r io.Reader, overwrite bool) (*Info, error) {
+	dst, err := snapshotPath(name)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(conf.GetSnapshotsPath(), 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, len(sqliteHeader))
+	_, err = io.ReadFull(r, header)
+	if err != nil || !bytes.Equal(header, sqliteHeader) {
+		return nil, ErrInvalidDbFile
+	}
+
+	tmp := dst + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, io.MultiReader(bytes.NewReader(header), r))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if overwrite {
+		err = os.Rename(tmp, dst)
+	} else {
+		// unlike rename, link fails if the snapshot was saved in the meantime
+		err = os.Link(tmp, dst)
+		os.Remove(tmp)
+		if errors.Is(err, os.ErrExist) {
+			return nil, ErrAlreadyExists
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(dst)
+	if err != nil {
+		return nil, err
+	}
+	return &Info{Name: name, Size: fi.Size(), CreatedAt: fi.ModTime()}, nil
+}
+
+// RestoreFile replaces the content of every table with the content of the same table
+// in the given database file. The live database is kept open, so the copy happens
+// over an attached database on a single connection.
+func RestoreFile(db *gorm.DB, src string) error {
+	if err := Supported(db); err != nil {
+		return err
+	}
+	defer replaced(db)
+	return db.Connection(func(conn *gorm.DB) error {
+		err := conn.Exec("ATTACH DATABASE ? AS snapshot", src).Error
+		if err != nil {
+			return fmt.Errorf("failed to attach snapshot: %w", err)
+		}
+		defer conn.Exec("DETACH DATABASE snapshot")
+
+		return conn.Transaction(func(tx *gorm.DB) error {
+			err := tx.Exec("PRAGMA defer_foreign_keys = ON").Error
+			if err != nil {
+				return err
+			}
+
+			var tables []string
+			err = tx.Raw("SELECT name FROM main.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").
+				Scan(&tables).Error
+			if err != nil {
+				return err
+			}
+
+			for _, table := range tables {
+				// the schema of the live database stays as it is, so do its migrations
+				if table == migration.VersionsTableName || table == migration.LockTableName {
+					continue
+				}
+				err = restoreTable(tx, table)
+				if err != nil {
+					return fmt.Errorf("failed to restore table %s: %w", table, err)
+				}
+			}
+			return restoreTable(tx, "sqlite_sequence")
+		})
+	})
+}
+
+func restoreTable(tx *gorm.DB, table string) error {
+	mainColumns, err := tableColumns(tx, "main", table)
+	if err != nil {
+		return err
+	}
+	if len(mainColumns) == 0 {
+		return nil
+	}
+	snapColumns, err := tableColumns(tx, "snapshot", table)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Exec(fmt.Sprintf("DELETE FROM main.%q", table)).Error
+	if err != nil {
+		return err
+	}
+
+	// columns are matched by name so snapshots taken before a schema change still
+	// restore; columns missing in the snapshot get their default value.
+	snapSet := make(map[string]bool, len(snapColumns))
+	for _, c := range snapColumns {
+		snapSet[c] = true
+	}
+	var common []string
+	for _, c := range mainColumns {
+		if snapSet[c] {
+			common = append(common, fmt.Sprintf("%q", c))
+		}
+	}
+	if len(common) == 0 {
+		return nil
+	}
+	cols := strings.Join(common, ", ")
+	return tx.Exec(fmt.Sprintf("INSERT INTO main.%q (%s) SELECT %s FROM snapshot.%q", table, cols, cols, table)).Error
+}
+
+func tableColumns(tx *gorm.DB, schema string, table string) ([]string, error) {
+	var columns []string
+	err := tx.Raw(fmt.Sprintf("SELECT name FROM pragma_table_info(%s, %s)", quoteLiteral(table), quoteLiteral(schema))).
+		Scan(&columns).Error
+	return columns, err
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,196 @@
+package snapshot_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/abramad-labs/irbankmock/internal/banks"
+	"github.com/abramad-labs/irbankmock/internal/banks/sep"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/dbtest"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// openDb returns a migrated database with the snapshots kept in a directory of the
+// test.
+func openDb(t *testing.T) *gorm.DB {
+	t.Helper()
+	t.Setenv("IRBANKMOCK_DATA_PATH", t.TempDir())
+	db := dbtest.Open(t)
+	if err := snapshot.Supported(db); err != nil {
+		t.Skip(err)
+	}
+	_, err := migration.Up(db, migration.UpOptions{})
+	if err != nil {
+		t.Fatalf("migrations failed: %v", err)
+	}
+	return db
+}
+
+func createTransaction(t *testing.T, db *gorm.DB, resNum string) (*sep.BankSepTerminal, *sep.BankSepTransaction) {
+	t.Helper()
+	terminal := &sep.BankSepTerminal{Name: "shop", Username: "user", Password: "pass"}
+	err := db.Create(terminal).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	btrx := &sep.BankSepTransaction{
+		TerminalId:       int64(terminal.ID),
+		Amount:           120000,
+		ResNum:           resNum,
+		Token:            "token-" + resNum,
+		RedirectURL:      "http://shop.test/callback",
+		TokenExpiryInMin: 20,
+	}
+	err = db.Create(btrx).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return terminal, btrx
+}
+
+func count(t *testing.T, db *gorm.DB, model any) int64 {
+	t.Helper()
+	var n int64
+	err := db.Model(model).Count(&n).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCreateResetRestore(t *testing.T) {
+	db := openDb(t)
+	terminal, btrx := createTransaction(t, db, "order-1")
+
+	_, err := snapshot.Create(db, "before")
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err = snapshot.Create(db, "before"); !errors.Is(err, snapshot.ErrAlreadyExists) {
+		t.Errorf("creating the snapshot again returned %v, want ErrAlreadyExists", err)
+	}
+
+	err = snapshot.Reset(db, snapshot.ResetOptions{})
+	if err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if count(t, db, &sep.BankSepTerminal{}) != 0 || count(t, db, &sep.BankSepTransaction{}) != 0 {
+		t.Fatal("reset kept the terminals or transactions")
+	}
+
+	err = snapshot.Restore(db, "before")
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	var restored sep.BankSepTransaction
+	err = db.Preload("Terminal").Take(&restored, btrx.ID).Error
+	if err != nil {
+		t.Fatalf("the transaction wasn't restored: %v", err)
+	}
+	if restored.Token != btrx.Token || restored.Terminal.ID != terminal.ID || restored.Terminal.Password != terminal.Password {
+		t.Errorf("restored %+v, want %+v", restored, btrx)
+	}
+
+	// the sequences are restored along with the rows
+	newTerminal, newBtrx := createTransaction(t, db, "order-2")
+	if newTerminal.ID <= terminal.ID || newBtrx.ID <= btrx.ID {
+		t.Errorf("the ids %d and %d were handed out after restoring %d and %d", newTerminal.ID, newBtrx.ID, terminal.ID, btrx.ID)
+	}
+}
+
+func TestSave(t *testing.T) {
+	db := openDb(t)
+	createTransaction(t, db, "order-1")
+	exported := filepath.Join(t.TempDir(), "exported.db")
+	err := snapshot.Export(db, exported)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	upload := func(name string, overwrite bool) error {
+		t.Helper()
+		f, err := os.Open(exported)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, err = snapshot.Save(name, f, overwrite)
+		return err
+	}
+
+	_, err = snapshot.Save("text", strings.NewReader("definitely not a database"), false)
+	if !errors.Is(err, snapshot.ErrInvalidDbFile) {
+		t.Errorf("saving a text file returned %v, want ErrInvalidDbFile", err)
+	}
+	if _, err = snapshot.Path("text"); !errors.Is(err, snapshot.ErrNotFound) {
+		t.Errorf("the rejected upload was kept: %v", err)
+	}
+
+	if err = upload("uploaded", false); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err = upload("uploaded", false); !errors.Is(err, snapshot.ErrAlreadyExists) {
+		t.Errorf("saving over the snapshot returned %v, want ErrAlreadyExists", err)
+	}
+	if err = upload("uploaded", true); err != nil {
+		t.Errorf("saving over the snapshot with overwrite failed: %v", err)
+	}
+
+	err = snapshot.Reset(db, snapshot.ResetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = snapshot.Restore(db, "uploaded")
+	if err != nil {
+		t.Fatalf("restoring the upload failed: %v", err)
+	}
+	if count(t, db, &sep.BankSepTransaction{}) != 1 {
+		t.Error("the upload wasn't restored")
+	}
+}
+
+func TestRestoreOlderSchema(t *testing.T) {
+	db := openDb(t)
+	terminal, _ := createTransaction(t, db, "order-1")
+	err := db.Model(terminal).Update("id_seed", "seed").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := filepath.Join(t.TempDir(), "old.db")
+	err = snapshot.Export(db, exported)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	// the snapshot of a release before the seeds existed
+	old, err := gorm.Open(sqlite.Open(exported), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = old.Exec("ALTER TABLE bank_sep_terminals DROP COLUMN id_seed").Error
+	if closeErr := dbutils.Close(old); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = snapshot.RestoreFile(db, exported)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	var restored sep.BankSepTerminal
+	err = db.Take(&restored, terminal.ID).Error
+	if err != nil {
+		t.Fatalf("the terminal wasn't restored: %v", err)
+	}
+	if restored.Name != terminal.Name || restored.IdSeed != "" {
+		t.Errorf("restored %+v, want %s without a seed", restored, terminal.Name)
+	}
+}
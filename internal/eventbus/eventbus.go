@@ -0,0 +1,144 @@
+package eventbus
+
+import (
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"gorm.io/gorm"
+)
+
+// event types of the live feed
+const TypeTokenCreated = "token.created"
+const TypeTokenRejected = "token.rejected"
+const TypePaymentFinalized = "payment.finalized"
+const TypeReceiptRequested = "receipt.requested"
+const TypeVerifyAttempted = "verify.attempted"
+const TypeReverseAttempted = "reverse.attempted"
+
+// Event is a notable thing that happened while serving a bank request. Events are
+// only kept in memory and delivered to the subscribers connected at that moment.
+type Event struct {
+	Type       string    `json:"type"`
+	Bank       string    `json:"bank"`
+	Namespace  string    `json:"namespace"`
+	TerminalId int64     `json:"terminalId"`
+	RequestId  string    `json:"requestId,omitempty"`
+	Time       time.Time `json:"time"`
+	Data       any       `json:"data"`
+}
+
+type Filter func(e *Event) bool
+
+// Subscription receives the published events on C. Slow subscribers don't block the
+// publishers, events are dropped once the buffer of C is full.
+type Subscription struct {
+	C       <-chan *Event
+	c       chan *Event
+	filter  Filter
+	dropped atomic.Int64
+	once    sync.Once
+	bus     *bus
+}
+
+const subscriptionBuffer = 256
+
+// bus holds the subscriptions of one server, test servers running in one process don't
+// see each other's events.
+type bus struct {
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+}
+
+// buses by connection pool
+var buses sync.Map
+
+func init() {
+	dbutils.OnClose(func(pool *sql.DB) {
+		if b, ok := buses.LoadAndDelete(pool); ok {
+			b.(*bus).closeAll()
+		}
+	})
+}
+
+func busOf(db *gorm.DB) *bus {
+	b, _ := buses.LoadOrStore(dbutils.Pool(db), &bus{subscriptions: map[*Subscription]struct{}{}})
+	return b.(*bus)
+}
+
+// Subscribe subscribes to the events of the server using db.
+func Subscribe(db *gorm.DB, filter Filter) *Subscription {
+	c := make(chan *Event, subscriptionBuffer)
+	sub := &Subscription{
+		C:      c,
+		c:      c,
+		filter: filter,
+		bus:    busOf(db),
+	}
+	sub.bus.mu.Lock()
+	sub.bus.subscriptions[sub] = struct{}{}
+	sub.bus.mu.Unlock()
+	return sub
+}
+
+// Close unsubscribes and closes C. It is safe to call it more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subscriptions, s)
+		s.bus.mu.Unlock()
+		close(s.c)
+	})
+}
+
+// Dropped returns the number of events not delivered because the subscriber was slow.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Publish delivers e to the subscribers of the server using db.
+func Publish(db *gorm.DB, e *Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b := busOf(db)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subscriptions {
+		if sub.filter != nil && !sub.filter(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// CloseAll closes every subscription of the server using db, which ends the live feed
+// streams on shutdown.
+func CloseAll(db *gorm.DB) {
+	busOf(db).closeAll()
+}
+
+func (b *bus) closeAll() {
+	b.mu.RLock()
+	subs := make([]*Subscription, 0, len(b.subscriptions))
+	for sub := range b.subscriptions {
+		subs = append(subs, sub)
+	}
+	b.mu.RUnlock()
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+func SubscriberCount(db *gorm.DB) int {
+	b := busOf(db)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subscriptions)
+}
@@ -0,0 +1,66 @@
+package fixtures
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// A Loader seeds the bank's section of a fixtures file into the database.
+// decode unmarshals the section into the bank's own fixture model.
+// Loaders must be idempotent since fixtures are applied on every startup.
+type Loader func(db *gorm.DB, decode func(v any) error) error
+
+var loaders map[string]Loader
+
+func init() {
+	loaders = make(map[string]Loader)
+}
+
+func RegisterLoader(bankName string, loader Loader) {
+	loaders[bankName] = loader
+}
+
+// fixtures file layout. json files are accepted as well since json is a subset of yaml.
+//
+//	banks:
+//	  saman:
+//	    terminals: [...]
+//	    transactions: [...]
+type fixturesFile struct {
+	Banks map[string]yaml.Node `yaml:"banks"`
+}
+
+func ApplyFile(db *gorm.DB, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read fixtures file: %w", err)
+	}
+	return Apply(db, content)
+}
+
+func Apply(db *gorm.DB, content []byte) error {
+	var file fixturesFile
+	err := yaml.Unmarshal(content, &file)
+	if err != nil {
+		return fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+
+	for bankName, node := range file.Banks {
+		loader, ok := loaders[bankName]
+		if !ok {
+			return fmt.Errorf("no fixture loader is registered for bank %q", bankName)
+		}
+		slog.Info("applying fixtures", "bank", bankName)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return loader(tx, node.Decode)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply %s fixtures: %w", bankName, err)
+		}
+	}
+	return nil
+}
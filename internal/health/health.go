@@ -0,0 +1,131 @@
+package health
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/abramad-labs/irbankmock/internal/banks/registry"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/openapi"
+	"github.com/abramad-labs/irbankmock/internal/scheduler"
+	"github.com/abramad-labs/irbankmock/internal/version"
+	"github.com/gofiber/fiber/v2"
+)
+
+const HealthPath = "/healthz"
+const ReadyPath = "/readyz"
+const VersionPath = "/version"
+
+const checkOk = "ok"
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type ReadyResponse struct {
+	Ready bool `json:"ready"`
+	// result of each check, ok or the reason it failed
+	Checks map[string]string `json:"checks"`
+}
+
+type VersionResponse struct {
+	Version   string   `json:"version"`
+	GoVersion string   `json:"goVersion"`
+	Banks     []string `json:"banks"`
+	// latest applied migration, zero if the database is unreachable
+	SchemaVersion int64 `json:"schemaVersion"`
+}
+
+type Options struct {
+	// the background jobs are run by scheduler.RunDue rather than the loop, e.g. by the
+	// test servers, so the readiness probe doesn't wait for the loop
+	ManualJobs bool
+}
+
+// Routes adds the probes and the version route.
+func Routes(r fiber.Router, opts Options) {
+	openapi.Route(r, fiber.MethodGet, HealthPath, &openapi.Operation{
+		Summary:     "Liveness probe",
+		Description: "Succeeds as long as the process serves requests.",
+		Tags:        []string{"health"},
+		Response:    HealthResponse{},
+	}, Healthz)
+	openapi.Route(r, fiber.MethodGet, ReadyPath, &openapi.Operation{
+		Summary: "Readiness probe",
+		Description: "Fails with 503 unless the database is reachable, all migrations are applied and the " +
+			"background jobs are running.",
+		Tags:     []string{"health"},
+		Response: ReadyResponse{},
+	}, Readyz(opts))
+	openapi.Route(r, fiber.MethodGet, VersionPath, &openapi.Operation{
+		Summary:  "Build information",
+		Tags:     []string{"health"},
+		Response: VersionResponse{},
+	}, Version)
+}
+
+// Healthz doesn't check any dependency, restarting the process wouldn't fix them.
+func Healthz(c *fiber.Ctx) error {
+	return c.JSON(&HealthResponse{Status: checkOk})
+}
+
+func Readyz(opts Options) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return readyz(c, opts)
+	}
+}
+
+func readyz(c *fiber.Ctx, opts Options) error {
+	resp := &ReadyResponse{Ready: true, Checks: map[string]string{}}
+	fail := func(check string, reason string) {
+		resp.Ready = false
+		resp.Checks[check] = reason
+	}
+
+	db, err := dbutils.GetDb(c)
+	if err == nil {
+		err = db.Exec("SELECT 1").Error
+	}
+	if err != nil {
+		fail("database", err.Error())
+		fail("migrations", "database is unreachable")
+	} else {
+		resp.Checks["database"] = checkOk
+		_, pending, err := migration.SchemaVersion(db)
+		switch {
+		case err != nil:
+			fail("migrations", err.Error())
+		case pending > 0:
+			fail("migrations", fmt.Sprintf("%d pending", pending))
+		default:
+			resp.Checks["migrations"] = checkOk
+		}
+	}
+
+	switch {
+	case opts.ManualJobs:
+		resp.Checks["jobs"] = "run manually"
+	case scheduler.Running():
+		resp.Checks["jobs"] = checkOk
+	default:
+		fail("jobs", "not running")
+	}
+
+	if !resp.Ready {
+		c.Status(fiber.StatusServiceUnavailable)
+	}
+	return c.JSON(resp)
+}
+
+func Version(c *fiber.Ctx) error {
+	resp := &VersionResponse{
+		Version:   version.ServerVersion,
+		GoVersion: runtime.Version(),
+		Banks:     registry.BankNames(),
+	}
+	if db, err := dbutils.GetDb(c); err == nil {
+		resp.SchemaVersion, _, _ = migration.SchemaVersion(db)
+	}
+	return c.JSON(resp)
+}
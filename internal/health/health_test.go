@@ -0,0 +1,67 @@
+package health_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/abramad-labs/irbankmock/internal/banks"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/dbtest"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/health"
+	"github.com/abramad-labs/irbankmock/internal/server"
+	"github.com/gofiber/fiber/v2"
+)
+
+func readyz(t *testing.T, app *fiber.App) (int, *health.ReadyResponse) {
+	t.Helper()
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, health.ReadyPath, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	resp := new(health.ReadyResponse)
+	if err = json.NewDecoder(res.Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, resp
+}
+
+func TestReadyOnceMigrated(t *testing.T) {
+	db := dbtest.Open(t)
+	app := server.NewApp(db, server.Options{DisableStartupMessage: true, ManualJobs: true})
+
+	status, resp := readyz(t, app)
+	if status != http.StatusServiceUnavailable || resp.Ready {
+		t.Errorf("readyz responded with %d before the migrations, want 503", status)
+	}
+	if !strings.HasSuffix(resp.Checks["migrations"], "pending") || resp.Checks["database"] != "ok" {
+		t.Errorf("readyz reported %v before the migrations", resp.Checks)
+	}
+
+	if _, err := migration.Up(db, migration.UpOptions{}); err != nil {
+		t.Fatalf("migrations failed: %v", err)
+	}
+	status, resp = readyz(t, app)
+	if status != http.StatusOK || !resp.Ready {
+		t.Errorf("readyz responded with %d after the migrations: %v", status, resp.Checks)
+	}
+	if resp.Checks["migrations"] != "ok" || resp.Checks["jobs"] != "run manually" {
+		t.Errorf("readyz reported %v after the migrations", resp.Checks)
+	}
+}
+
+func TestNotReadyWithoutJobs(t *testing.T) {
+	db := dbtest.Open(t)
+	if _, err := migration.Up(db, migration.UpOptions{}); err != nil {
+		t.Fatalf("migrations failed: %v", err)
+	}
+	app := server.NewApp(db, server.Options{DisableStartupMessage: true})
+
+	status, resp := readyz(t, app)
+	if status != http.StatusServiceUnavailable || resp.Checks["jobs"] != "not running" {
+		t.Errorf("readyz responded with %d and %v while the scheduler isn't running", status, resp.Checks)
+	}
+}
@@ -0,0 +1,76 @@
+// Package idgen generates the identifiers the banks hand out, like payment tokens and
+// reference numbers. They are random by default. A seeded generator yields the same
+// identifiers on every run, so tests can assert exact values.
+package idgen
+
+import (
+	"crypto/sha256"
+	"math/rand/v2"
+
+	"github.com/google/uuid"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// the default alphabet and length of gonanoid, so seeded ids look like random ones
+const nanoIdAlphabet = "_-0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+const nanoIdLength = 21
+
+type Generator interface {
+	// Int63 returns a non-negative number, e.g. an rrn
+	Int63() int64
+	// UUID returns a version 4 uuid
+	UUID() string
+	// NanoID returns a url safe id of 21 characters
+	NanoID() string
+}
+
+type randomGenerator struct{}
+
+func (randomGenerator) Int63() int64 {
+	return rand.Int64()
+}
+
+func (randomGenerator) UUID() string {
+	return uuid.NewString()
+}
+
+func (randomGenerator) NanoID() string {
+	return gonanoid.Must()
+}
+
+// Random is the generator used unless a seed is configured.
+var Random Generator = randomGenerator{}
+
+type seededGenerator struct {
+	r *rand.Rand
+}
+
+// Seeded returns a generator whose identifiers are determined by the seed and the
+// stream. Callers pick a different stream for every generator of the same seed, e.g.
+// the terminal and the number of tokens it issued, otherwise the ids repeat.
+func Seeded(seed string, stream string) Generator {
+	key := sha256.Sum256([]byte(seed + "\x00" + stream))
+	return &seededGenerator{r: rand.New(rand.NewChaCha8(key))}
+}
+
+func (g *seededGenerator) Int63() int64 {
+	return g.r.Int64()
+}
+
+func (g *seededGenerator) UUID() string {
+	var id uuid.UUID
+	for i := range id {
+		id[i] = byte(g.r.UintN(256))
+	}
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return id.String()
+}
+
+func (g *seededGenerator) NanoID() string {
+	id := make([]byte, nanoIdLength)
+	for i := range id {
+		id[i] = nanoIdAlphabet[g.r.IntN(len(nanoIdAlphabet))]
+	}
+	return string(id)
+}
@@ -0,0 +1,266 @@
+package inspector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/abramad-labs/irbankmock/internal/scheduler"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const maxBodySize = 64 * 1024
+
+var ErrExchangeNotFound = errors.New("exchange not found")
+
+type linkCtxKeyType struct{}
+
+var linkKey linkCtxKeyType
+
+type bankCtxKeyType struct{}
+
+var bankKey bankCtxKeyType
+
+// Exchange is a recorded request of a merchant and the response the bank returned.
+type Exchange struct {
+	ID        uint64 `gorm:"primarykey"`
+	RequestId string `gorm:"size:64;index"`
+	Bank      string
+	Namespace string `gorm:"size:64"`
+
+	Method          string
+	Path            string `gorm:"size:2083"`
+	Query           string `gorm:"size:2083"`
+	RemoteIP        string
+	RequestHeaders  string
+	RequestBody     string
+	ResponseStatus  int
+	ResponseHeaders string
+	ResponseBody    string
+	LatencyMs       float64
+
+	TerminalId    *int64  `gorm:"index"`
+	TransactionId *uint64 `gorm:"index"`
+
+	CreatedAt time.Time `gorm:"index"`
+}
+
+type link struct {
+	terminalId    *int64
+	transactionId *uint64
+}
+
+// RetentionJobName is the scheduler job removing the expired exchanges.
+const RetentionJobName = "inspector.retention"
+
+// the model as of the migration creating it
+type exchange2025060401 struct {
+	ID              uint64 `gorm:"primarykey"`
+	RequestId       string `gorm:"size:64;index"`
+	Bank            string
+	Namespace       string `gorm:"size:64"`
+	Method          string
+	Path            string `gorm:"size:2083"`
+	Query           string `gorm:"size:2083"`
+	RemoteIP        string
+	RequestHeaders  string
+	RequestBody     string
+	ResponseStatus  int
+	ResponseHeaders string
+	ResponseBody    string
+	LatencyMs       float64
+	TerminalId      *int64    `gorm:"index"`
+	TransactionId   *uint64   `gorm:"index"`
+	CreatedAt       time.Time `gorm:"index"`
+}
+
+func (exchange2025060401) TableName() string {
+	return "exchanges"
+}
+
+func init() {
+	scheduler.Register(&scheduler.Definition{
+		Name:     RetentionJobName,
+		Interval: time.Minute,
+		Run: func(ctx context.Context, db *gorm.DB, payload []byte) error {
+			if !IsEnabled() {
+				return nil
+			}
+			return RemoveExpired(db)
+		},
+	})
+
+	migration.Register(&migration.Migration{
+		Version: 2025060401,
+		Name:    "create_inspector_exchanges",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(exchange2025060401{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(exchange2025060401{})
+		},
+	})
+
+	snapshot.RegisterResetter(func(tx *gorm.DB, opts snapshot.ResetOptions) error {
+		return tx.Where("1 = 1").Delete(&Exchange{}).Error
+	})
+
+	namespace.RegisterDestroyer(func(tx *gorm.DB, ns string) error {
+		return tx.Where("namespace = ?", ns).Delete(&Exchange{}).Error
+	})
+}
+
+func IsEnabled() bool {
+	return conf.GetInspectorRetention() > 0
+}
+
+// Link associates the exchange of the current request with a terminal and, if
+// resolved, a transaction.
+func Link(c *fiber.Ctx, terminalId int64, transactionId *uint64) {
+	c.Locals(linkKey, &link{
+		terminalId:    &terminalId,
+		transactionId: transactionId,
+	})
+}
+
+// Record is a route middleware marking the exchanges of a merchant route to be stored
+// by Middleware.
+func Record(bank string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(bankKey, bank)
+		return c.Next()
+	}
+}
+
+// Middleware stores the whole exchange of the requests marked by Record. It comes
+// before the error middleware, to record what the merchant actually received.
+func Middleware(c *fiber.Ctx) error {
+	if !IsEnabled() {
+		return c.Next()
+	}
+
+	start := time.Now()
+	err := c.Next()
+	if err != nil {
+		return err
+	}
+	bank, ok := c.Locals(bankKey).(string)
+	if !ok {
+		return nil
+	}
+	latency := time.Since(start)
+
+	requestId, _ := c.Locals("requestid").(string)
+	exchange := &Exchange{
+		RequestId:       requestId,
+		Bank:            bank,
+		Namespace:       namespace.Get(c),
+		Method:          c.Method(),
+		Path:            c.Path(),
+		Query:           string(c.Request().URI().QueryString()),
+		RemoteIP:        c.IP(),
+		RequestHeaders:  headersJson(c.GetReqHeaders()),
+		RequestBody:     redactBody(c.Get(fiber.HeaderContentType), c.Body()),
+		ResponseStatus:  c.Response().StatusCode(),
+		ResponseHeaders: headersJson(c.GetRespHeaders()),
+		ResponseBody:    redactBody(string(c.Response().Header.ContentType()), c.Response().Body()),
+		LatencyMs:       float64(latency.Microseconds()) / 1000,
+		CreatedAt:       start,
+	}
+	if l, ok := c.Locals(linkKey).(*link); ok {
+		exchange.TerminalId = l.terminalId
+		exchange.TransactionId = l.transactionId
+	}
+
+	db, dbErr := dbutils.GetDb(c)
+	if dbErr == nil {
+		dbErr = db.Create(exchange).Error
+	}
+	if dbErr != nil {
+		slog.ErrorContext(c.UserContext(), "failed to record exchange", "error", dbErr)
+	}
+	return nil
+}
+
+func headersJson(headers map[string][]string) string {
+	flat := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if len(v) > 0 {
+			flat[k] = v[0]
+		}
+	}
+	content, err := json.Marshal(redactHeaders(flat))
+	if err != nil {
+		return "{}"
+	}
+	return string(content)
+}
+
+type ExchangeFilter struct {
+	RequestId     string
+	Bank          string
+	Namespace     string
+	TerminalId    *int64
+	TransactionId *uint64
+	Since         *time.Time
+	Limit         int
+}
+
+func List(db *gorm.DB, filter *ExchangeFilter) ([]*Exchange, error) {
+	query := db.Model(&Exchange{}).Order("id desc")
+	if filter.RequestId != "" {
+		query = query.Where("request_id = ?", filter.RequestId)
+	}
+	if filter.Bank != "" {
+		query = query.Where("bank = ?", filter.Bank)
+	}
+	if filter.Namespace != "" {
+		query = query.Where("namespace = ?", filter.Namespace)
+	}
+	if filter.TerminalId != nil {
+		query = query.Where("terminal_id = ?", *filter.TerminalId)
+	}
+	if filter.TransactionId != nil {
+		query = query.Where("transaction_id = ?", *filter.TransactionId)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	var exchanges []*Exchange
+	err := query.Limit(limit).Find(&exchanges).Error
+	return exchanges, err
+}
+
+func Get(db *gorm.DB, id uint64) (*Exchange, error) {
+	var exchange Exchange
+	err := db.Take(&exchange, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrExchangeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &exchange, nil
+}
+
+func Clear(db *gorm.DB) error {
+	return db.Where("1 = 1").Delete(&Exchange{}).Error
+}
+
+// RemoveExpired removes the exchanges older than the retention.
+func RemoveExpired(db *gorm.DB) error {
+	deadline := time.Now().Add(-conf.GetInspectorRetention())
+	return db.Where("created_at < ?", deadline).Delete(&Exchange{}).Error
+}
@@ -0,0 +1,23 @@
+package inspector
+
+import (
+	"strings"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/redact"
+)
+
+func redactHeaders(headers map[string]string) map[string]string {
+	return redact.Headers(headers, conf.GetInspectorRedactedFields()...)
+}
+
+// redactBody removes the sensitive fields from json and form bodies, along with the
+// fields configured in inspector.redact. The body is truncated only after redaction,
+// a cut body would no longer parse and be masked by the less thorough text rules.
+func redactBody(contentType string, body []byte) string {
+	redacted := redact.Body(contentType, body, conf.GetInspectorRedactedFields()...)
+	if len(redacted) > maxBodySize {
+		redacted = strings.ToValidUTF8(redacted[:maxBodySize], "")
+	}
+	return redacted
+}
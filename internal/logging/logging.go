@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/redact"
+)
+
+type requestIdKeyType struct{}
+
+var requestIdKey requestIdKeyType
+
+// WithRequestId returns a context whose logs carry the request id.
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
+
+// Setup makes the configured logger the default of slog and the log package, so
+// every log line goes through the redaction.
+func Setup() {
+	slog.SetDefault(slog.New(NewHandler(os.Stderr)))
+}
+
+// NewHandler returns a handler in the configured level and format, which adds the
+// request id of the context and redacts sensitive attributes and card numbers.
+func NewHandler(w io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{
+		Level:       parseLevel(conf.GetLogLevel()),
+		ReplaceAttr: redactAttr,
+	}
+	var handler slog.Handler
+	if strings.EqualFold(conf.GetLogFormat(), "text") {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return &contextHandler{Handler: handler}
+}
+
+func parseLevel(value string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindAny {
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(err.Error())
+		}
+	}
+	// the message and the built-in attributes pass through here as well
+	if redact.IsSensitive(a.Key) {
+		return slog.String(a.Key, redact.Value)
+	}
+	if a.Value.Kind() == slog.KindString {
+		return slog.String(a.Key, redact.Text(a.Value.String()))
+	}
+	return a
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if requestId := RequestId(ctx); requestId != "" {
+		r.AddAttrs(slog.String("requestId", requestId))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
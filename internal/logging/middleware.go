@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/redact"
+	"github.com/gofiber/fiber/v2"
+)
+
+// bodies logged at debug level are cut to this size
+const maxLoggedBody = 4 * 1024
+
+// Middleware logs every request once it's handled. It must come after the requestid
+// middleware; the user context of the request carries the id from here on, so logs of
+// the handlers and their sql statements can be correlated with the request. The errors
+// of the handlers must be written before, by the error middleware.
+func Middleware(c *fiber.Ctx) error {
+	requestId, _ := c.Locals("requestid").(string)
+	ctx := WithRequestId(c.UserContext(), requestId)
+	c.SetUserContext(ctx)
+
+	start := time.Now()
+	err := c.Next()
+	if err != nil {
+		return err
+	}
+
+	status := c.Response().StatusCode()
+	level := slog.LevelInfo
+	if status >= fiber.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	attrs := []slog.Attr{
+		slog.String("method", c.Method()),
+		slog.String("path", c.Path()),
+		slog.Int("status", status),
+		slog.Float64("latencyMs", float64(time.Since(start).Microseconds())/1000),
+		slog.String("ip", c.IP()),
+	}
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		attrs = append(attrs, slog.String("requestBody", loggedBody(c.Get(fiber.HeaderContentType), c.Body())))
+		// reading a streamed body, like the live feed, would wait for the stream to end
+		if !c.Response().IsBodyStream() {
+			attrs = append(attrs,
+				slog.String("responseBody", loggedBody(string(c.Response().Header.ContentType()), c.Response().Body())))
+		}
+	}
+	slog.LogAttrs(ctx, level, "request", attrs...)
+	return nil
+}
+
+func loggedBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	redacted := redact.Body(contentType, body, conf.GetInspectorRedactedFields()...)
+	if len(redacted) > maxLoggedBody {
+		// persian bodies would otherwise be cut within a character
+		redacted = strings.ToValidUTF8(redacted[:maxLoggedBody], "") + "..."
+	}
+	return redacted
+}
@@ -0,0 +1,177 @@
+package management
+
+import (
+	"errors"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/clock"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/abramad-labs/irbankmock/internal/webhook"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var ErrClockTimeRequired = errors.New("time is required")
+var ErrInvalidClockDuration = errors.New("duration must be like 30m or 2h")
+
+const ClockSourceNamespace = "namespace"
+const ClockSourceGlobal = "global"
+const ClockSourceReal = "real"
+
+type ClockRequest struct {
+	// the clock of the namespace, the global clock if empty
+	Namespace string `json:"namespace"`
+	// the time to freeze the clock at, the current time of the clock if empty. required
+	// to set the clock.
+	Time *time.Time `json:"time"`
+	// the duration to advance the clock by, e.g. 31m
+	Duration string `json:"duration"`
+}
+
+type ClockResponse struct {
+	// empty for the global clock
+	Namespace string    `json:"namespace"`
+	Now       time.Time `json:"now"`
+	Frozen    bool      `json:"frozen"`
+	// how far the clock is ahead of the real time, negative if it's behind
+	Offset string `json:"offset"`
+	// the clock the scope follows: its own, the global one or the real time
+	Source string `json:"source"`
+}
+
+// clockScope returns the scope of the clock of the namespace, validating that the
+// namespace exists.
+func clockScope(db *gorm.DB, ns string) (string, error) {
+	if ns == "" {
+		return clock.Global, nil
+	}
+	ns, err := namespace.Lookup(db, ns)
+	if err != nil {
+		return "", namespaceUserError(err)
+	}
+	return ns, nil
+}
+
+func clockResponse(c *fiber.Ctx, db *gorm.DB, scope string) error {
+	state, err := clock.Get(db, scope)
+	if err != nil {
+		return err
+	}
+	resp := &ClockResponse{Source: ClockSourceReal}
+	if scope != clock.Global {
+		resp.Namespace = scope
+	}
+	var now time.Time
+	if state == nil {
+		now = time.Now()
+	} else {
+		now = state.Now()
+		resp.Frozen = state.FrozenAt != nil
+		resp.Source = ClockSourceGlobal
+		if state.Scope != clock.Global {
+			resp.Source = ClockSourceNamespace
+		}
+	}
+	resp.Now = now
+	resp.Offset = time.Until(now).Round(time.Second).String()
+	return c.JSON(resp)
+}
+
+// changeClock runs change on the clock of the requested scope and responds with the
+// changed clock.
+func changeClock(c *fiber.Ctx, change func(db *gorm.DB, scope string, req *ClockRequest) error) error {
+	req := new(ClockRequest)
+	if len(c.Body()) > 0 {
+		err := c.BodyParser(req)
+		if err != nil {
+			return err
+		}
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	scope, err := clockScope(db, req.Namespace)
+	if err != nil {
+		return err
+	}
+	err = change(db, scope, req)
+	if err != nil {
+		return err
+	}
+	// the tokens the change expired queued their deliveries
+	webhook.Wake()
+	return clockResponse(c, db, scope)
+}
+
+// GetClock returns the clock of the namespace query parameter, or the global clock.
+func GetClock(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	scope, err := clockScope(db, c.Query("namespace"))
+	if err != nil {
+		return err
+	}
+	return clockResponse(c, db, scope)
+}
+
+func FreezeClock(c *fiber.Ctx) error {
+	return changeClock(c, func(db *gorm.DB, scope string, req *ClockRequest) error {
+		_, err := clock.Freeze(db, scope, req.Time)
+		return err
+	})
+}
+
+func ResumeClock(c *fiber.Ctx) error {
+	return changeClock(c, func(db *gorm.DB, scope string, req *ClockRequest) error {
+		_, err := clock.Resume(db, scope)
+		return err
+	})
+}
+
+func AdvanceClock(c *fiber.Ctx) error {
+	return changeClock(c, func(db *gorm.DB, scope string, req *ClockRequest) error {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return usererror.NewBadRequest(ErrInvalidClockDuration)
+		}
+		_, err = clock.Advance(db, scope, d)
+		if errors.Is(err, clock.ErrNegativeDuration) {
+			return usererror.NewBadRequest(err)
+		}
+		return err
+	})
+}
+
+func SetClock(c *fiber.Ctx) error {
+	return changeClock(c, func(db *gorm.DB, scope string, req *ClockRequest) error {
+		if req.Time == nil {
+			return usererror.NewBadRequest(ErrClockTimeRequired)
+		}
+		_, err := clock.Set(db, scope, *req.Time)
+		return err
+	})
+}
+
+// ResetClock brings the clock of the namespace query parameter back to the global
+// clock, or the global clock back to the real time.
+func ResetClock(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	scope, err := clockScope(db, c.Query("namespace"))
+	if err != nil {
+		return err
+	}
+	err = clock.Reset(db, scope)
+	if err != nil {
+		return err
+	}
+	webhook.Wake()
+	return clockResponse(c, db, scope)
+}
@@ -0,0 +1,20 @@
+package management
+
+import (
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ConfigResponse struct {
+	// path of the loaded config file, empty if the service is configured by env vars only
+	ConfigFile string                   `json:"configFile"`
+	Settings   []*conf.EffectiveSetting `json:"settings"`
+}
+
+// GetConfig reports the effective configuration with the secrets redacted.
+func GetConfig(c *fiber.Ctx) error {
+	return c.JSON(&ConfigResponse{
+		ConfigFile: conf.ConfigFile(),
+		Settings:   conf.Effective(),
+	})
+}
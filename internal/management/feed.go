@@ -0,0 +1,171 @@
+package management
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/eventbus"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const feedPingInterval = 15 * time.Second
+const feedWriteTimeout = 10 * time.Second
+
+var feedUpgrader = websocket.FastHTTPUpgrader{
+	// the feed is read-only and the management routes are already guarded by the
+	// admin authentication, so the origin is not restricted
+	CheckOrigin: func(ctx *fasthttp.RequestCtx) bool {
+		return true
+	},
+}
+
+// feedFilter builds the subscription filter from the bank, namespace, terminalId and
+// comma separated types query parameters.
+func feedFilter(c *fiber.Ctx) (eventbus.Filter, error) {
+	bank := c.Query("bank")
+	ns := strings.ToLower(c.Query("namespace"))
+	var terminalId *int64
+	if v := c.Query("terminalId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, usererror.NewBadRequest(ErrInvalidId)
+		}
+		terminalId = &id
+	}
+	var types []string
+	if v := c.Query("types"); v != "" {
+		types = strings.Split(v, ",")
+	}
+
+	return func(e *eventbus.Event) bool {
+		if bank != "" && e.Bank != bank {
+			return false
+		}
+		if ns != "" && e.Namespace != ns {
+			return false
+		}
+		if terminalId != nil && e.TerminalId != *terminalId {
+			return false
+		}
+		if types != nil {
+			for _, t := range types {
+				if t == e.Type {
+					return true
+				}
+			}
+			return false
+		}
+		return true
+	}, nil
+}
+
+// StreamFeedSSE streams the live feed as server-sent events.
+func StreamFeedSSE(c *fiber.Ctx) error {
+	filter, err := feedFilter(c)
+	if err != nil {
+		return err
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	sub := eventbus.Subscribe(db, filter)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+		ticker := time.NewTicker(feedPingInterval)
+		defer ticker.Stop()
+
+		fmt.Fprint(w, ": connected\n\n")
+		if w.Flush() != nil {
+			return
+		}
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			case <-ticker.C:
+				// keeps proxies from closing the connection and detects gone clients
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			if w.Flush() != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// StreamFeedWS streams the live feed over a websocket, one json event per message.
+func StreamFeedWS(c *fiber.Ctx) error {
+	filter, err := feedFilter(c)
+	if err != nil {
+		return err
+	}
+	if !websocket.FastHTTPIsWebSocketUpgrade(c.Context()) {
+		return fiber.ErrUpgradeRequired
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+
+	return feedUpgrader.Upgrade(c.Context(), func(conn *websocket.Conn) {
+		defer conn.Close()
+		sub := eventbus.Subscribe(db, filter)
+		defer sub.Close()
+
+		// incoming messages are ignored, reading is only needed to notice the close
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(feedPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				conn.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+				if conn.WriteJSON(e) != nil {
+					return
+				}
+			case <-ticker.C:
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(feedWriteTimeout))
+				if err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	})
+}
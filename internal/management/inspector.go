@@ -0,0 +1,136 @@
+package management
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/inspector"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrInvalidSince = errors.New("since must be an RFC3339 time")
+
+type ExchangeResponse struct {
+	ID              uint64            `json:"id"`
+	RequestId       string            `json:"requestId"`
+	Bank            string            `json:"bank"`
+	Namespace       string            `json:"namespace"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query"`
+	RemoteIP        string            `json:"remoteIp"`
+	RequestHeaders  map[string]string `json:"requestHeaders"`
+	RequestBody     string            `json:"requestBody"`
+	ResponseStatus  int               `json:"responseStatus"`
+	ResponseHeaders map[string]string `json:"responseHeaders"`
+	ResponseBody    string            `json:"responseBody"`
+	LatencyMs       float64           `json:"latencyMs"`
+	TerminalId      *int64            `json:"terminalId"`
+	TransactionId   *uint64           `json:"transactionId"`
+	CreatedAt       time.Time         `json:"createdAt"`
+}
+
+func newExchangeResponse(e *inspector.Exchange) *ExchangeResponse {
+	resp := &ExchangeResponse{
+		ID:             e.ID,
+		RequestId:      e.RequestId,
+		Bank:           e.Bank,
+		Namespace:      e.Namespace,
+		Method:         e.Method,
+		Path:           e.Path,
+		Query:          e.Query,
+		RemoteIP:       e.RemoteIP,
+		RequestBody:    e.RequestBody,
+		ResponseStatus: e.ResponseStatus,
+		ResponseBody:   e.ResponseBody,
+		LatencyMs:      e.LatencyMs,
+		TerminalId:     e.TerminalId,
+		TransactionId:  e.TransactionId,
+		CreatedAt:      e.CreatedAt,
+	}
+	json.Unmarshal([]byte(e.RequestHeaders), &resp.RequestHeaders)
+	json.Unmarshal([]byte(e.ResponseHeaders), &resp.ResponseHeaders)
+	return resp
+}
+
+// ListExchanges returns the recorded merchant exchanges, newest first. It can be
+// filtered by the requestId, bank, namespace, terminalId, transactionId and since
+// query parameters.
+func ListExchanges(c *fiber.Ctx) error {
+	filter := &inspector.ExchangeFilter{
+		RequestId: c.Query("requestId"),
+		Bank:      c.Query("bank"),
+		Namespace: c.Query("namespace"),
+		Limit:     c.QueryInt("limit", 100),
+	}
+	if v := c.Query("terminalId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return usererror.NewBadRequest(ErrInvalidId)
+		}
+		filter.TerminalId = &id
+	}
+	if v := c.Query("transactionId"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return usererror.NewBadRequest(ErrInvalidId)
+		}
+		filter.TransactionId = &id
+	}
+	if v := c.Query("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return usererror.NewBadRequest(ErrInvalidSince)
+		}
+		filter.Since = &since
+	}
+
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	exchanges, err := inspector.List(db, filter)
+	if err != nil {
+		return err
+	}
+	resp := make([]*ExchangeResponse, len(exchanges))
+	for i, e := range exchanges {
+		resp[i] = newExchangeResponse(e)
+	}
+	return c.JSON(resp)
+}
+
+func GetExchange(c *fiber.Ctx) error {
+	id, err := idParam(c)
+	if err != nil {
+		return err
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	exchange, err := inspector.Get(db, id)
+	if err != nil {
+		if errors.Is(err, inspector.ErrExchangeNotFound) {
+			return usererror.NewWithStatus(err, fiber.StatusNotFound)
+		}
+		return err
+	}
+	return c.JSON(newExchangeResponse(exchange))
+}
+
+func ClearExchanges(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	err = inspector.Clear(db)
+	if err != nil {
+		return err
+	}
+	return c.JSON(&SuccessResponse{Success: true})
+}
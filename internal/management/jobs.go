@@ -0,0 +1,107 @@
+package management
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/scheduler"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/gofiber/fiber/v2"
+)
+
+type JobResponse struct {
+	ID       uint64              `json:"id"`
+	Name     string              `json:"name"`
+	Periodic bool                `json:"periodic"`
+	Interval string              `json:"interval,omitempty"`
+	Payload  json.RawMessage     `json:"payload,omitempty"`
+	Status   scheduler.JobStatus `json:"status"`
+	// next run of a scheduled job
+	RunAt          time.Time  `json:"runAt"`
+	Attempts       int        `json:"attempts"`
+	Runs           int64      `json:"runs"`
+	Failures       int64      `json:"failures"`
+	LastRunAt      *time.Time `json:"lastRunAt"`
+	LastDurationMs int64      `json:"lastDurationMs"`
+	LastError      *string    `json:"lastError"`
+	LockedBy       *string    `json:"lockedBy"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+func newJobResponse(j *scheduler.Job) *JobResponse {
+	resp := &JobResponse{
+		ID:             j.ID,
+		Name:           j.Name,
+		Periodic:       j.Periodic,
+		Status:         j.Status,
+		RunAt:          j.RunAt,
+		Attempts:       j.Attempts,
+		Runs:           j.Runs,
+		Failures:       j.Failures,
+		LastRunAt:      j.LastRunAt,
+		LastDurationMs: j.LastDurationMs,
+		LastError:      j.LastError,
+		LockedBy:       j.LockedBy,
+		CreatedAt:      j.CreatedAt,
+	}
+	if j.Periodic {
+		resp.Interval = j.Interval.String()
+	}
+	if j.Payload != "" && j.Payload != "null" {
+		resp.Payload = json.RawMessage(j.Payload)
+	}
+	return resp
+}
+
+func jobUserError(err error) error {
+	switch {
+	case errors.Is(err, scheduler.ErrJobNotFound):
+		return usererror.NewWithStatus(err, fiber.StatusNotFound)
+	case errors.Is(err, scheduler.ErrJobNotScheduled):
+		return usererror.NewWithStatus(err, fiber.StatusConflict)
+	}
+	return err
+}
+
+// ListJobs returns the periodic jobs and the delayed jobs of the scheduler. It can be
+// filtered by the name and status query parameters.
+func ListJobs(c *fiber.Ctx) error {
+	filter := &scheduler.ListFilter{
+		Name:   c.Query("name"),
+		Status: scheduler.JobStatus(c.Query("status")),
+		Limit:  c.QueryInt("limit", 100),
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	jobs, err := scheduler.List(db, filter)
+	if err != nil {
+		return err
+	}
+	resp := make([]*JobResponse, len(jobs))
+	for i, j := range jobs {
+		resp[i] = newJobResponse(j)
+	}
+	return c.JSON(resp)
+}
+
+// RunJob runs a scheduled job right away instead of waiting for its time, and responds
+// once it finished.
+func RunJob(c *fiber.Ctx) error {
+	id, err := idParam(c)
+	if err != nil {
+		return err
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	job, err := scheduler.RunNow(c.UserContext(), db, id)
+	if err != nil {
+		return jobUserError(err)
+	}
+	return c.JSON(newJobResponse(job))
+}
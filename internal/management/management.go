@@ -0,0 +1,222 @@
+package management
+
+import (
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/openapi"
+	"github.com/abramad-labs/irbankmock/internal/webhook"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RouterPrefix is the root of the management api which is not bound to a specific bank.
+const RouterPrefix = "/management"
+
+const openapiTag = "management"
+
+// route adds a management route along with its metadata in the openapi document.
+func route(g fiber.Router, method string, path string, op *openapi.Operation, handler fiber.Handler) {
+	op.Tags = []string{openapiTag}
+	openapi.Route(g, method, path, op, handler)
+}
+
+func ConfigRouters(g fiber.Router) {
+	route(g, fiber.MethodGet, "/auth/check", &openapi.Operation{
+		Summary:  "Check the admin credentials",
+		Response: CheckAuthResponse{},
+	}, CheckAuth)
+	route(g, fiber.MethodGet, "/config", &openapi.Operation{
+		Summary:     "Show the effective configuration",
+		Description: "Values of secret settings are redacted.",
+		Response:    ConfigResponse{},
+	}, GetConfig)
+	route(g, fiber.MethodPost, "/db/reset", &openapi.Operation{
+		Summary:  "Remove all transactions, and the terminals unless keepTerminals is set",
+		Request:  ResetDbRequest{},
+		Response: SuccessResponse{},
+	}, ResetDb)
+	route(g, fiber.MethodGet, "/db/download", &openapi.Operation{
+		Summary:             "Download a copy of the database",
+		ResponseContentType: fiber.MIMEOctetStream,
+		Response:            openapi.BinarySchema,
+	}, DownloadDb)
+	route(g, fiber.MethodPost, "/db/upload", &openapi.Operation{
+		Summary: "Replace the database with an uploaded sqlite file",
+		Description: "The file is also kept as a snapshot named by the name field, \"uploaded\" by default. " +
+			"Saving over an existing snapshot fails with 409 unless overwrite is true.",
+		RequestContentType: fiber.MIMEMultipartForm,
+		Request: &openapi.Schema{
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"file":      openapi.BinarySchema,
+				"name":      {Type: "string"},
+				"overwrite": {Type: "boolean"},
+			},
+		},
+		Response: SuccessResponse{},
+	}, UploadDb)
+	route(g, fiber.MethodGet, "/db/migrations", &openapi.Operation{
+		Summary:  "List the schema migrations and whether they are applied",
+		Response: []migration.StatusEntry{},
+	}, ListMigrations)
+	route(g, fiber.MethodGet, "/snapshots", &openapi.Operation{
+		Summary:  "List the snapshots",
+		Response: []snapshot.Info{},
+	}, ListSnapshots)
+	route(g, fiber.MethodPost, "/snapshots", &openapi.Operation{
+		Summary:  "Snapshot the current database",
+		Request:  CreateSnapshotRequest{},
+		Response: snapshot.Info{},
+	}, CreateSnapshot)
+	route(g, fiber.MethodDelete, "/snapshots/:name", &openapi.Operation{
+		Summary:  "Delete a snapshot",
+		Response: SuccessResponse{},
+	}, DeleteSnapshot)
+	route(g, fiber.MethodPost, "/snapshots/:name/restore", &openapi.Operation{
+		Summary:  "Restore the database from a snapshot",
+		Response: SuccessResponse{},
+	}, RestoreSnapshot)
+	route(g, fiber.MethodGet, "/snapshots/:name/download", &openapi.Operation{
+		Summary:             "Download a snapshot",
+		ResponseContentType: fiber.MIMEOctetStream,
+		Response:            openapi.BinarySchema,
+	}, DownloadSnapshot)
+	route(g, fiber.MethodGet, "/namespaces", &openapi.Operation{
+		Summary:  "List the namespaces",
+		Response: []NamespaceResponse{},
+	}, ListNamespaces)
+	route(g, fiber.MethodPost, "/namespaces", &openapi.Operation{
+		Summary:  "Create a namespace",
+		Request:  CreateNamespaceRequest{},
+		Response: NamespaceResponse{},
+	}, CreateNamespace)
+	route(g, fiber.MethodDelete, "/namespaces/:name", &openapi.Operation{
+		Summary:  "Remove a namespace with all of its terminals and transactions",
+		Response: SuccessResponse{},
+	}, DestroyNamespace)
+	route(g, fiber.MethodGet, "/webhooks", &openapi.Operation{
+		Summary:  "List the webhook subscriptions",
+		Response: []WebhookSubscriptionResponse{},
+	}, ListWebhooks)
+	route(g, fiber.MethodPost, "/webhooks", &openapi.Operation{
+		Summary:  "Subscribe to the transaction events",
+		Request:  webhook.SubscriptionRequest{},
+		Response: WebhookSubscriptionResponse{},
+	}, CreateWebhook)
+	route(g, fiber.MethodDelete, "/webhooks/:id", &openapi.Operation{
+		Summary:  "Remove a webhook subscription and its deliveries",
+		Response: SuccessResponse{},
+	}, DeleteWebhook)
+	route(g, fiber.MethodGet, "/webhooks/deliveries", &openapi.Operation{
+		Summary: "List the webhook deliveries, newest first",
+		Parameters: []openapi.Parameter{
+			openapi.QueryParam("subscriptionId", ""),
+			openapi.QueryParam("status", "pending, delivered or failed"),
+			openapi.QueryParam("limit", "at most 1000, defaults to 100"),
+		},
+		Response: []WebhookDeliveryResponse{},
+	}, ListWebhookDeliveries)
+	route(g, fiber.MethodPost, "/webhooks/deliveries/:id/redeliver", &openapi.Operation{
+		Summary:  "Send a webhook delivery again",
+		Response: SuccessResponse{},
+	}, RedeliverWebhook)
+	feedParams := []openapi.Parameter{
+		openapi.QueryParam("bank", ""),
+		openapi.QueryParam("namespace", ""),
+		openapi.QueryParam("terminalId", ""),
+		openapi.QueryParam("types", "comma separated event types"),
+	}
+	route(g, fiber.MethodGet, "/feed/sse", &openapi.Operation{
+		Summary:             "Stream the live feed as server-sent events",
+		Parameters:          feedParams,
+		ResponseContentType: "text/event-stream",
+		Response:            &openapi.Schema{Type: "string"},
+	}, StreamFeedSSE)
+	route(g, fiber.MethodGet, "/feed/ws", &openapi.Operation{
+		Summary:     "Stream the live feed over a websocket",
+		Description: "Every message is a json encoded event.",
+		Parameters:  feedParams,
+	}, StreamFeedWS)
+	clockParams := []openapi.Parameter{openapi.QueryParam("namespace", "the global clock if empty")}
+	route(g, fiber.MethodGet, "/clock", &openapi.Operation{
+		Summary:    "Show the time the banks see in a namespace",
+		Parameters: clockParams,
+		Response:   ClockResponse{},
+	}, GetClock)
+	route(g, fiber.MethodDelete, "/clock", &openapi.Operation{
+		Summary: "Reset a clock",
+		Description: "The clock of a namespace follows the global clock again, the global clock goes back to the " +
+			"real time.",
+		Parameters: clockParams,
+		Response:   ClockResponse{},
+	}, ResetClock)
+	route(g, fiber.MethodPost, "/clock/freeze", &openapi.Operation{
+		Summary:  "Stop a clock at its current time, or at the given time",
+		Request:  ClockRequest{},
+		Response: ClockResponse{},
+	}, FreezeClock)
+	route(g, fiber.MethodPost, "/clock/resume", &openapi.Operation{
+		Summary:  "Let a frozen clock run again",
+		Request:  ClockRequest{},
+		Response: ClockResponse{},
+	}, ResumeClock)
+	route(g, fiber.MethodPost, "/clock/advance", &openapi.Operation{
+		Summary:     "Move a clock forward",
+		Description: "Unpaid tokens that become due are expired right away.",
+		Request:     ClockRequest{},
+		Response:    ClockResponse{},
+	}, AdvanceClock)
+	route(g, fiber.MethodPost, "/clock/set", &openapi.Operation{
+		Summary:  "Move a clock to the given time",
+		Request:  ClockRequest{},
+		Response: ClockResponse{},
+	}, SetClock)
+	route(g, fiber.MethodGet, "/jobs", &openapi.Operation{
+		Summary: "List the periodic and delayed jobs of the scheduler",
+		Parameters: []openapi.Parameter{
+			openapi.QueryParam("name", ""),
+			openapi.QueryParam("status", "scheduled, running, done or failed"),
+			openapi.QueryParam("limit", "defaults to 100"),
+		},
+		Response: []JobResponse{},
+	}, ListJobs)
+	route(g, fiber.MethodPost, "/jobs/:id/run", &openapi.Operation{
+		Summary:  "Run a scheduled job now and wait for it",
+		Response: JobResponse{},
+	}, RunJob)
+	route(g, fiber.MethodGet, "/exchanges", &openapi.Operation{
+		Summary: "List the recorded merchant exchanges, newest first",
+		Parameters: []openapi.Parameter{
+			openapi.QueryParam("requestId", ""),
+			openapi.QueryParam("bank", ""),
+			openapi.QueryParam("namespace", ""),
+			openapi.QueryParam("terminalId", ""),
+			openapi.QueryParam("transactionId", ""),
+			openapi.QueryParam("since", "RFC3339 time"),
+			openapi.QueryParam("limit", "at most 1000, defaults to 100"),
+		},
+		Response: []ExchangeResponse{},
+	}, ListExchanges)
+	route(g, fiber.MethodDelete, "/exchanges", &openapi.Operation{
+		Summary:  "Remove all recorded exchanges",
+		Response: SuccessResponse{},
+	}, ClearExchanges)
+	route(g, fiber.MethodGet, "/exchanges/:id", &openapi.Operation{
+		Summary:  "Get a recorded exchange",
+		Response: ExchangeResponse{},
+	}, GetExchange)
+}
+
+type CheckAuthResponse struct {
+	Success     bool `json:"success"`
+	AuthEnabled bool `json:"authEnabled"`
+}
+
+// CheckAuth lets clients validate their credentials, it only succeeds if the request
+// passed the admin authentication.
+func CheckAuth(c *fiber.Ctx) error {
+	return c.JSON(&CheckAuthResponse{
+		Success:     true,
+		AuthEnabled: conf.IsAdminAuthEnabled(),
+	})
+}
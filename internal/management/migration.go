@@ -0,0 +1,20 @@
+package management
+
+import (
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListMigrations reports the registered migrations and whether they are applied.
+func ListMigrations(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	entries, err := migration.Status(db)
+	if err != nil {
+		return err
+	}
+	return c.JSON(entries)
+}
@@ -0,0 +1,76 @@
+package management
+
+import (
+	"errors"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CreateNamespaceRequest struct {
+	Name string `json:"name"`
+}
+
+type NamespaceResponse struct {
+	Name string `json:"name"`
+}
+
+func namespaceUserError(err error) error {
+	switch {
+	case errors.Is(err, namespace.ErrInvalidName), errors.Is(err, namespace.ErrDefaultNamespace):
+		return usererror.NewBadRequest(err)
+	case errors.Is(err, namespace.ErrNotFound):
+		return usererror.NewWithStatus(err, fiber.StatusNotFound)
+	case errors.Is(err, namespace.ErrAlreadyExists):
+		return usererror.NewWithStatus(err, fiber.StatusConflict)
+	}
+	return err
+}
+
+func ListNamespaces(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	namespaces, err := namespace.List(db)
+	if err != nil {
+		return err
+	}
+	resp := make([]*NamespaceResponse, len(namespaces))
+	for i, ns := range namespaces {
+		resp[i] = &NamespaceResponse{Name: ns.Name}
+	}
+	return c.JSON(resp)
+}
+
+func CreateNamespace(c *fiber.Ctx) error {
+	req := new(CreateNamespaceRequest)
+	err := c.BodyParser(req)
+	if err != nil {
+		return err
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	ns, err := namespace.Create(db, req.Name)
+	if err != nil {
+		return namespaceUserError(err)
+	}
+	return c.JSON(&NamespaceResponse{Name: ns.Name})
+}
+
+// DestroyNamespace removes the namespace and all of the terminals and transactions in it.
+func DestroyNamespace(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	err = namespace.Destroy(db, c.Params("name"))
+	if err != nil {
+		return namespaceUserError(err)
+	}
+	return c.JSON(&SuccessResponse{Success: true})
+}
@@ -0,0 +1,180 @@
+package management
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidOverwrite = errors.New("overwrite must be true or false")
+
+type ResetDbRequest struct {
+	KeepTerminals bool `json:"keepTerminals"`
+}
+
+type CreateSnapshotRequest struct {
+	Name string `json:"name"`
+}
+
+type SuccessResponse struct {
+	Success bool `json:"success"`
+}
+
+func snapshotUserError(err error) error {
+	switch {
+	case errors.Is(err, snapshot.ErrInvalidName), errors.Is(err, snapshot.ErrInvalidDbFile):
+		return usererror.NewBadRequest(err)
+	case errors.Is(err, snapshot.ErrNotFound):
+		return usererror.NewWithStatus(err, fiber.StatusNotFound)
+	case errors.Is(err, snapshot.ErrAlreadyExists):
+		return usererror.NewWithStatus(err, fiber.StatusConflict)
+	case errors.Is(err, snapshot.ErrUnsupportedDriver):
+		return usererror.NewWithStatus(err, fiber.StatusNotImplemented)
+	}
+	return err
+}
+
+func ResetDb(c *fiber.Ctx) error {
+	req := new(ResetDbRequest)
+	if len(c.Body()) > 0 {
+		err := c.BodyParser(req)
+		if err != nil {
+			return err
+		}
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	err = snapshot.Reset(db, snapshot.ResetOptions{KeepTerminals: req.KeepTerminals})
+	if err != nil {
+		return err
+	}
+	return c.JSON(&SuccessResponse{Success: true})
+}
+
+func ListSnapshots(c *fiber.Ctx) error {
+	resp, err := snapshot.List()
+	if err != nil {
+		return err
+	}
+	return c.JSON(resp)
+}
+
+func CreateSnapshot(c *fiber.Ctx) error {
+	req := new(CreateSnapshotRequest)
+	err := c.BodyParser(req)
+	if err != nil {
+		return err
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	resp, err := snapshot.Create(db, req.Name)
+	if err != nil {
+		return snapshotUserError(err)
+	}
+	return c.JSON(resp)
+}
+
+func DeleteSnapshot(c *fiber.Ctx) error {
+	err := snapshot.Delete(c.Params("name"))
+	if err != nil {
+		return snapshotUserError(err)
+	}
+	return c.JSON(&SuccessResponse{Success: true})
+}
+
+func RestoreSnapshot(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	err = snapshot.Restore(db, c.Params("name"))
+	if err != nil {
+		return snapshotUserError(err)
+	}
+	return c.JSON(&SuccessResponse{Success: true})
+}
+
+func DownloadSnapshot(c *fiber.Ctx) error {
+	name := c.Params("name")
+	src, err := snapshot.Path(name)
+	if err != nil {
+		return snapshotUserError(err)
+	}
+	return c.Download(src, name+".db")
+}
+
+// DownloadDb sends a consistent copy of the live database.
+func DownloadDb(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	tmp := path.Join(os.TempDir(), "irbankmock-"+uuid.NewString()+".db")
+	err = snapshot.Export(db, tmp)
+	if err != nil {
+		return snapshotUserError(err)
+	}
+	defer os.Remove(tmp)
+
+	content, err := os.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	filename := fmt.Sprintf("%s-%s", time.Now().Format("20060102-150405"), conf.GetDbFileName())
+	c.Attachment(filename)
+	return c.Send(content)
+}
+
+// UploadDb replaces the live database with the uploaded file. The uploaded file is
+// kept as the "uploaded" snapshot so it can be restored again later. An existing
+// snapshot of the name is only replaced if the overwrite field is true.
+func UploadDb(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	err = snapshot.Supported(db)
+	if err != nil {
+		return snapshotUserError(err)
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return usererror.NewBadRequest(err)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	name := c.FormValue("name", "uploaded")
+	overwrite, err := strconv.ParseBool(c.FormValue("overwrite", "false"))
+	if err != nil {
+		return usererror.NewBadRequest(ErrInvalidOverwrite)
+	}
+	_, err = snapshot.Save(name, f, overwrite)
+	if err != nil {
+		return snapshotUserError(err)
+	}
+
+	err = snapshot.Restore(db, name)
+	if err != nil {
+		return snapshotUserError(err)
+	}
+	return c.JSON(&SuccessResponse{Success: true})
+}
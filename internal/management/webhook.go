@@ -0,0 +1,184 @@
+package management
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/abramad-labs/irbankmock/internal/webhook"
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrInvalidId = errors.New("invalid id")
+
+type WebhookSubscriptionResponse struct {
+	ID         uint64              `json:"id"`
+	URL        string              `json:"url"`
+	Secret     string              `json:"secret"`
+	Events     []webhook.EventType `json:"events"`
+	Bank       string              `json:"bank"`
+	TerminalId *int64              `json:"terminalId"`
+	Namespace  string              `json:"namespace"`
+}
+
+func newWebhookSubscriptionResponse(s *webhook.Subscription) *WebhookSubscriptionResponse {
+	return &WebhookSubscriptionResponse{
+		ID:         s.ID,
+		URL:        s.URL,
+		Secret:     s.Secret,
+		Events:     s.EventList(),
+		Bank:       s.Bank,
+		TerminalId: s.TerminalId,
+		Namespace:  s.Namespace,
+	}
+}
+
+type WebhookDeliveryResponse struct {
+	ID             uint64                 `json:"id"`
+	SubscriptionId uint64                 `json:"subscriptionId"`
+	EventId        string                 `json:"eventId"`
+	Event          webhook.EventType      `json:"event"`
+	Payload        json.RawMessage        `json:"payload"`
+	Status         webhook.DeliveryStatus `json:"status"`
+	Attempts       int                    `json:"attempts"`
+	NextAttemptAt  time.Time              `json:"nextAttemptAt"`
+	LastAttemptAt  *time.Time             `json:"lastAttemptAt"`
+	LastStatusCode *int                   `json:"lastStatusCode"`
+	LastError      *string                `json:"lastError"`
+	LatencyMs      *int64                 `json:"latencyMs"`
+	CreatedAt      time.Time              `json:"createdAt"`
+	DeliveredAt    *time.Time             `json:"deliveredAt"`
+}
+
+func webhookUserError(err error) error {
+	switch {
+	case errors.Is(err, webhook.ErrInvalidURL), errors.Is(err, webhook.ErrInvalidEvent):
+		return usererror.NewBadRequest(err)
+	case errors.Is(err, webhook.ErrSubscriptionNotFound), errors.Is(err, webhook.ErrDeliveryNotFound):
+		return usererror.NewWithStatus(err, fiber.StatusNotFound)
+	}
+	return err
+}
+
+func idParam(c *fiber.Ctx) (uint64, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return 0, usererror.NewBadRequest(ErrInvalidId)
+	}
+	return id, nil
+}
+
+func ListWebhooks(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	subs, err := webhook.ListSubscriptions(db)
+	if err != nil {
+		return err
+	}
+	resp := make([]*WebhookSubscriptionResponse, len(subs))
+	for i, s := range subs {
+		resp[i] = newWebhookSubscriptionResponse(s)
+	}
+	return c.JSON(resp)
+}
+
+func CreateWebhook(c *fiber.Ctx) error {
+	req := new(webhook.SubscriptionRequest)
+	err := c.BodyParser(req)
+	if err != nil {
+		return err
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	sub, err := webhook.CreateSubscription(db, req)
+	if err != nil {
+		return webhookUserError(err)
+	}
+	return c.JSON(newWebhookSubscriptionResponse(sub))
+}
+
+func DeleteWebhook(c *fiber.Ctx) error {
+	id, err := idParam(c)
+	if err != nil {
+		return err
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	err = webhook.DeleteSubscription(db, id)
+	if err != nil {
+		return webhookUserError(err)
+	}
+	return c.JSON(&SuccessResponse{Success: true})
+}
+
+// ListWebhookDeliveries returns the delivery log, newest first. It can be filtered by
+// the subscriptionId and status query parameters.
+func ListWebhookDeliveries(c *fiber.Ctx) error {
+	filter := &webhook.DeliveryFilter{
+		Limit: c.QueryInt("limit", 100),
+	}
+	if v := c.Query("subscriptionId"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return usererror.NewBadRequest(ErrInvalidId)
+		}
+		filter.SubscriptionId = &id
+	}
+	if v := c.Query("status"); v != "" {
+		status := webhook.DeliveryStatus(v)
+		filter.Status = &status
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	deliveries, err := webhook.ListDeliveries(db, filter)
+	if err != nil {
+		return err
+	}
+	resp := make([]*WebhookDeliveryResponse, len(deliveries))
+	for i, d := range deliveries {
+		resp[i] = &WebhookDeliveryResponse{
+			ID:             d.ID,
+			SubscriptionId: d.SubscriptionId,
+			EventId:        d.EventId,
+			Event:          d.Event,
+			Payload:        json.RawMessage(d.Payload),
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			NextAttemptAt:  d.NextAttemptAt,
+			LastAttemptAt:  d.LastAttemptAt,
+			LastStatusCode: d.LastStatusCode,
+			LastError:      d.LastError,
+			LatencyMs:      d.LatencyMs,
+			CreatedAt:      d.CreatedAt,
+			DeliveredAt:    d.DeliveredAt,
+		}
+	}
+	return c.JSON(resp)
+}
+
+func RedeliverWebhook(c *fiber.Ctx) error {
+	id, err := idParam(c)
+	if err != nil {
+		return err
+	}
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	err = webhook.Redeliver(db, id)
+	if err != nil {
+		return webhookUserError(err)
+	}
+	return c.JSON(&SuccessResponse{Success: true})
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/openapi"
+	"github.com/gofiber/fiber/v2"
+)
+
+var httpRequests = NewCounterVec("irbankmock_http_requests_total",
+	"Handled http requests by route pattern and status code.", "method", "route", "status")
+var httpDuration = NewHistogramVec("irbankmock_http_request_duration_seconds",
+	"Latency of http requests by route pattern.", DefaultBuckets, "method", "route")
+
+// Routes adds the route prometheus scrapes.
+func Routes(r fiber.Router) {
+	openapi.Route(r, fiber.MethodGet, Path, &openapi.Operation{
+		Summary:             "Prometheus metrics",
+		Description:         "Request counts and latencies per route, bank outcomes and database pool stats.",
+		Tags:                []string{"metrics"},
+		ResponseContentType: "text/plain",
+		Response:            &openapi.Schema{Type: "string"},
+	}, Handler)
+}
+
+// Middleware records the count and latency of requests. Requests are labeled with the
+// route pattern rather than the path, so tokens and ids don't create new series. The
+// errors of the handlers must be written before, by the error middleware.
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	if err != nil {
+		return err
+	}
+	status := c.Response().StatusCode()
+	route := c.Route().Path
+	if status == fiber.StatusNotFound && route == "/" {
+		// unmatched requests end up on the catch-all of the middlewares
+		route = "unmatched"
+	}
+	// the values may point into buffers reused by fasthttp
+	method := strings.Clone(c.Method())
+	route = strings.Clone(route)
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	httpRequests.With(db).WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.With(db).WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// Handler serves the metrics of the server in the prometheus text format.
+func Handler(c *fiber.Ctx) error {
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	return serverOf(db).handler(c)
+}
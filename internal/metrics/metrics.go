@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/version"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// Path is the route serving the metrics in the prometheus text format.
+const Path = "/metrics"
+
+// DefaultBuckets are the upper bounds of latency histograms, in seconds.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// server holds the metrics of one server, test servers running in one process count
+// their own requests and payments.
+type server struct {
+	registry *prometheus.Registry
+	handler  fiber.Handler
+	// collectors by metric name
+	collectors sync.Map
+}
+
+// servers by connection pool
+var servers sync.Map
+
+func init() {
+	dbutils.OnClose(func(pool *sql.DB) {
+		servers.Delete(pool)
+	})
+}
+
+// serverOf returns the metrics of the server using db, along with the runtime, build
+// and connection pool metrics on first use.
+func serverOf(db *gorm.DB) *server {
+	pool := dbutils.Pool(db)
+	if s, ok := servers.Load(pool); ok {
+		return s.(*server)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "irbankmock_build_info",
+			Help:        "Build information of the running server, always 1.",
+			ConstLabels: prometheus.Labels{"version": version.ServerVersion},
+		}, func() float64 { return 1 }),
+	)
+	if pool != nil {
+		registerDbStats(registry, pool)
+	}
+	s, _ := servers.LoadOrStore(pool, &server{
+		registry: registry,
+		handler:  adaptor.HTTPHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})),
+	})
+	return s.(*server)
+}
+
+// collector returns the collector of the metric of the server using db, created and
+// registered on first use.
+func collector[T prometheus.Collector](db *gorm.DB, name string, create func() T) T {
+	s := serverOf(db)
+	if c, ok := s.collectors.Load(name); ok {
+		return c.(T)
+	}
+	c, loaded := s.collectors.LoadOrStore(name, create())
+	if !loaded {
+		s.registry.MustRegister(c.(T))
+	}
+	return c.(T)
+}
+
+// CounterVec is declared once and counted by each server on its own.
+type CounterVec struct {
+	opts   prometheus.CounterOpts
+	labels []string
+}
+
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{opts: prometheus.CounterOpts{Name: name, Help: help}, labels: labels}
+}
+
+// With returns the counter of the server using db.
+func (v *CounterVec) With(db *gorm.DB) *prometheus.CounterVec {
+	return collector(db, v.opts.Name, func() *prometheus.CounterVec {
+		return prometheus.NewCounterVec(v.opts, v.labels)
+	})
+}
+
+// HistogramVec is declared once and observed by each server on its own.
+type HistogramVec struct {
+	opts   prometheus.HistogramOpts
+	labels []string
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{opts: prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels: labels}
+}
+
+// With returns the histogram of the server using db.
+func (v *HistogramVec) With(db *gorm.DB) *prometheus.HistogramVec {
+	return collector(db, v.opts.Name, func() *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(v.opts, v.labels)
+	})
+}
+
+// registerDbStats exposes the connection pool as gauges.
+func registerDbStats(registry *prometheus.Registry, pool *sql.DB) {
+	gauges := []struct {
+		name string
+		help string
+		fn   func(sql.DBStats) float64
+	}{
+		{"irbankmock_db_open_connections", "Open connections of the database pool.",
+			func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"irbankmock_db_in_use_connections", "Connections of the database pool currently in use.",
+			func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"irbankmock_db_idle_connections", "Idle connections of the database pool.",
+			func(s sql.DBStats) float64 { return float64(s.Idle) }},
+		{"irbankmock_db_max_open_connections", "Maximum open connections of the database pool.",
+			func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"irbankmock_db_wait_count", "Connections waited for since the pool was opened.",
+			func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"irbankmock_db_wait_duration_seconds", "Time spent waiting for connections since the pool was opened.",
+			func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+	}
+	for _, g := range gauges {
+		fn := g.fn
+		registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: g.name, Help: g.help},
+			func() float64 { return fn(pool.Stats()) }))
+	}
+}
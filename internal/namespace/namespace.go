@@ -0,0 +1,219 @@
+package namespace
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Default is the namespace of requests that do not select any namespace. It always
+// exists and can't be destroyed.
+const Default = "default"
+
+// HeaderName selects the namespace of a request. Namespaces can also be selected using
+// the url prefix, see registry.RegistryNamespacePrefix.
+const HeaderName = "X-IRBankMock-Namespace"
+
+var ErrInvalidName = errors.New("namespace name may only contain lowercase letters, digits, '-' and '_'")
+var ErrNotFound = errors.New("namespace not found")
+var ErrAlreadyExists = errors.New("namespace already exists")
+var ErrDefaultNamespace = errors.New("default namespace can't be created or destroyed")
+
+var nameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type namespaceCtxKeyType struct{}
+
+var namespaceKey namespaceCtxKeyType
+
+type Namespace struct {
+	Name      string `gorm:"primarykey;size:64"`
+	CreatedAt time.Time
+}
+
+// A Destroyer removes the data that belongs to a namespace.
+type Destroyer func(tx *gorm.DB, namespace string) error
+
+var destroyers []Destroyer
+
+// the model as of the migration creating it
+type namespace2025060101 struct {
+	Name      string `gorm:"primarykey;size:64"`
+	CreatedAt time.Time
+}
+
+func (namespace2025060101) TableName() string {
+	return "namespaces"
+}
+
+func init() {
+	migration.Register(&migration.Migration{
+		Version: 2025060101,
+		Name:    "create_namespaces",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(namespace2025060101{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(namespace2025060101{})
+		},
+	})
+
+	snapshot.RegisterResetter(func(tx *gorm.DB, opts snapshot.ResetOptions) error {
+		if opts.KeepTerminals {
+			return nil
+		}
+		return tx.Where("1 = 1").Delete(&Namespace{}).Error
+	})
+}
+
+func RegisterDestroyer(destroyer Destroyer) {
+	destroyers = append(destroyers, destroyer)
+}
+
+func normalize(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !nameRegex.MatchString(name) {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// Use selects the namespace of the request. An empty name selects the namespace of
+// the request header, or the default namespace if the header is not set either.
+func Use(c *fiber.Ctx, name string) error {
+	if name == "" {
+		name = c.Get(HeaderName)
+	}
+	if name == "" {
+		c.Locals(namespaceKey, Default)
+		return nil
+	}
+
+	db, err := dbutils.GetDb(c)
+	if err != nil {
+		return err
+	}
+	name, err = Lookup(db, name)
+	switch {
+	case errors.Is(err, ErrInvalidName):
+		return usererror.NewBadRequest(err)
+	case errors.Is(err, ErrNotFound):
+		return usererror.NewWithStatus(err, fiber.StatusNotFound)
+	case err != nil:
+		return err
+	}
+	c.Locals(namespaceKey, name)
+	return nil
+}
+
+// Lookup normalizes the name and makes sure the namespace exists.
+func Lookup(db *gorm.DB, name string) (string, error) {
+	name, err := normalize(name)
+	if err != nil {
+		return "", err
+	}
+	if name == Default {
+		return name, nil
+	}
+	var exists bool
+	err = db.Model(&Namespace{}).Select("count(*) > 0").Where("name = ?", name).Find(&exists).Error
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", ErrNotFound
+	}
+	return name, nil
+}
+
+// Get returns the namespace selected for the request.
+func Get(c *fiber.Ctx) string {
+	ns, ok := c.Locals(namespaceKey).(string)
+	if !ok {
+		return Default
+	}
+	return ns
+}
+
+// Scope limits a query to the rows of the request namespace. The queried model must
+// have a namespace column.
+func Scope(c *fiber.Ctx) func(db *gorm.DB) *gorm.DB {
+	ns := Get(c)
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("namespace = ?", ns)
+	}
+}
+
+func List(db *gorm.DB) ([]*Namespace, error) {
+	var namespaces []*Namespace
+	err := db.Order("name").Find(&namespaces).Error
+	if err != nil {
+		return nil, err
+	}
+	return append([]*Namespace{{Name: Default}}, namespaces...), nil
+}
+
+func Create(db *gorm.DB, name string) (*Namespace, error) {
+	name, err := normalize(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == Default {
+		return nil, ErrDefaultNamespace
+	}
+	ns := &Namespace{Name: name}
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(ns)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrAlreadyExists
+	}
+	return ns, nil
+}
+
+// Ensure creates the namespace if it doesn't exist.
+func Ensure(db *gorm.DB, name string) error {
+	name, err := normalize(name)
+	if err != nil {
+		return err
+	}
+	if name == Default {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Namespace{Name: name}).Error
+}
+
+// Destroy removes the namespace along with all of its data.
+func Destroy(db *gorm.DB, name string) error {
+	name, err := normalize(name)
+	if err != nil {
+		return err
+	}
+	if name == Default {
+		return ErrDefaultNamespace
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("name = ?", name).Delete(&Namespace{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		for _, d := range destroyers {
+			if err := d(tx, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,328 @@
+package openapi
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/abramad-labs/irbankmock/internal/version"
+	"github.com/gofiber/fiber/v2"
+	swaggerfiles "github.com/swaggo/files/v2"
+)
+
+const SpecPath = "/openapi.json"
+const DocsPath = "/docs"
+const docsAssetsPath = DocsPath + "/:file"
+
+// Operation describes a route. Request and Response are zero values of the types
+// the route decodes and encodes, e.g. BankSepTransactionRequest{}, or a *Schema for
+// bodies that aren't go types.
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// content type of the request body, defaults to application/json
+	RequestContentType string
+	Request            any
+	// content type of the response body, defaults to application/json
+	ResponseContentType string
+	Response            any
+	Parameters          []Parameter
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// QueryParam is a shorthand for an optional string query parameter.
+func QueryParam(name string, description string) Parameter {
+	return Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Schema:      &Schema{Type: "string"},
+	}
+}
+
+// BinarySchema is the schema of file uploads and downloads.
+var BinarySchema = &Schema{Type: "string", Format: "binary"}
+
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]*PathItem `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type PathItem struct {
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	OperationId string               `json:"operationId"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	Security    []map[string][]any   `json:"security,omitempty"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+type routeKey struct {
+	method string
+	path   string
+}
+
+var operations sync.Map
+
+// Route adds the handlers of a route to r along with its metadata, so the documented
+// routes are the served ones:
+//
+//	openapi.Route(g, fiber.MethodGet, "/jobs", &openapi.Operation{
+//		Summary:  "List the jobs",
+//		Response: []JobResponse{},
+//	}, ListJobs)
+func Route(r fiber.Router, method string, path string, op *Operation, handlers ...fiber.Handler) fiber.Router {
+	prefix := ""
+	if g, ok := r.(*fiber.Group); ok {
+		prefix = g.Prefix
+	}
+	full := strings.TrimSuffix(prefix, "/") + path
+	operations.Store(routeKey{method: strings.ToUpper(method), path: strings.ToLower(full)}, op)
+	return r.Add(method, path, handlers...)
+}
+
+// skipped routes are either duplicates or not part of the api
+var skippedPrefixes = []string{"/ns/:namespace/"}
+var skippedPaths = []string{SpecPath, DocsPath, docsAssetsPath}
+
+// documents of the apps, generated on their first request of the spec
+var generated sync.Map
+
+// Generate builds the document of every route registered on app. Routes without
+// registered metadata are still listed with a generic response.
+func Generate(app *fiber.App) *Document {
+	gen := &schemaGenerator{components: map[string]*Schema{}}
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:   "IRBankMock",
+			Version: version.ServerVersion,
+		},
+		Paths: map[string]map[string]*PathItem{},
+		Components: Components{
+			Schemas: gen.components,
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer"},
+				"basicAuth":  {Type: "http", Scheme: "basic"},
+			},
+		},
+	}
+
+	for _, route := range app.GetRoutes(true) {
+		if !isDocumented(route) {
+			continue
+		}
+		path := openapiPath(route.Path)
+		method := strings.ToLower(route.Method)
+		if _, ok := doc.Paths[path][method]; ok {
+			continue
+		}
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*PathItem{}
+		}
+		doc.Paths[path][method] = buildPathItem(gen, route)
+	}
+	return doc
+}
+
+func isDocumented(route fiber.Route) bool {
+	if route.Method == fiber.MethodHead || route.Method == fiber.MethodConnect || route.Method == fiber.MethodTrace {
+		return false
+	}
+	for _, p := range skippedPrefixes {
+		if strings.HasPrefix(route.Path, p) {
+			return false
+		}
+	}
+	for _, p := range skippedPaths {
+		if route.Path == p {
+			return false
+		}
+	}
+	return true
+}
+
+func buildPathItem(gen *schemaGenerator, route fiber.Route) *PathItem {
+	op := &Operation{}
+	if found, ok := operations.Load(routeKey{method: route.Method, path: strings.ToLower(route.Path)}); ok {
+		op = found.(*Operation)
+	}
+
+	item := &PathItem{
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		OperationId: operationId(route),
+		Responses:   map[string]*Response{},
+	}
+
+	for _, p := range route.Params {
+		item.Parameters = append(item.Parameters, Parameter{
+			Name:     p,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	item.Parameters = append(item.Parameters, op.Parameters...)
+
+	if op.Request != nil {
+		item.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				contentType(op.RequestContentType): {Schema: gen.schemaOf(op.Request)},
+			},
+		}
+	}
+
+	ok := &Response{Description: "OK"}
+	if op.Response != nil {
+		ok.Content = map[string]*MediaType{
+			contentType(op.ResponseContentType): {Schema: gen.schemaOf(op.Response)},
+		}
+	}
+	item.Responses["200"] = ok
+
+	if strings.Contains(strings.ToLower(route.Path), "/management") {
+		item.Security = []map[string][]any{
+			{"bearerAuth": {}},
+			{"basicAuth": {}},
+		}
+		item.Responses["401"] = &Response{Description: "Unauthorized"}
+		item.Responses["403"] = &Response{Description: "Forbidden"}
+	}
+	return item
+}
+
+func contentType(t string) string {
+	if t == "" {
+		return fiber.MIMEApplicationJSON
+	}
+	return t
+}
+
+// openapiPath converts the fiber parameters like :id to {id}
+func openapiPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + strings.TrimSuffix(strings.TrimPrefix(s, ":"), "?") + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func operationId(route fiber.Route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(route.Method))
+	for _, s := range strings.FieldsFunc(route.Path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '-' || r == '_' || r == '.'
+	}) {
+		b.WriteString(strings.ToUpper(s[:1]) + s[1:])
+	}
+	return b.String()
+}
+
+// ServeSpec returns the generated document of the app. The document is generated
+// once, on the first request, after all routes are registered.
+func ServeSpec(c *fiber.Ctx) error {
+	doc, ok := generated.Load(c.App())
+	if !ok {
+		doc, _ = generated.LoadOrStore(c.App(), Generate(c.App()))
+	}
+	return c.JSON(doc)
+}
+
+// the assets of swagger ui are embedded, so the docs work without internet access
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <title>IRBankMock API</title>
+  <link rel="stylesheet" href="` + DocsPath + `/swagger-ui.css" />
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="` + DocsPath + `/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "` + SpecPath + `", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>`
+
+var docsAssets = map[string]string{
+	"swagger-ui.css":       "text/css; charset=utf-8",
+	"swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+}
+
+// Routes serves the spec and the Swagger UI of the app.
+func Routes(r fiber.Router) {
+	r.Get(SpecPath, ServeSpec)
+	r.Get(DocsPath, ServeDocs)
+	r.Get(docsAssetsPath, serveDocsAsset)
+}
+
+// ServeDocs renders the Swagger UI of the spec.
+func ServeDocs(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.SendString(docsPage)
+}
+
+func serveDocsAsset(c *fiber.Ctx) error {
+	name := path.Base(c.Params("file"))
+	contentType, ok := docsAssets[name]
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	content, err := fs.ReadFile(swaggerfiles.FS, name)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+	return c.Send(content)
+}
@@ -0,0 +1,139 @@
+package redact
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Value replaces redacted values.
+const Value = "***"
+
+// normalized names of headers, body fields and columns that are never stored or logged
+var fields = []string{
+	"authorization",
+	"proxyauthorization",
+	"cookie",
+	"setcookie",
+	"password",
+	"cardpassword",
+	"pin",
+	"pin2",
+	"cvv",
+	"cvv2",
+	"pan",
+	"cardnumber",
+	"paidcardnumber",
+	"expiredate",
+	"secret",
+}
+
+func normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.Trim(name, "\"'`")
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		// table qualified column
+		name = strings.Trim(name[i+1:], "\"'`")
+	}
+	return strings.NewReplacer("_", "", "-", "").Replace(name)
+}
+
+// IsSensitive reports whether a header, body field or column is redacted. extra are
+// additional names configured by the user.
+func IsSensitive(name string, extra ...string) bool {
+	name = normalize(name)
+	for _, f := range fields {
+		if f == name {
+			return true
+		}
+	}
+	for _, f := range extra {
+		if normalize(f) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func Headers(headers map[string]string, extra ...string) map[string]string {
+	for k := range headers {
+		if IsSensitive(k, extra...) {
+			headers[k] = Value
+		}
+	}
+	return headers
+}
+
+// Body removes the sensitive fields from json and form bodies. Other bodies only have
+// card numbers masked.
+func Body(contentType string, body []byte, extra ...string) string {
+	contentType = strings.ToLower(contentType)
+
+	if strings.Contains(contentType, "json") {
+		var v any
+		if err := json.Unmarshal(body, &v); err == nil {
+			redacted, err := json.Marshal(redactJson(v, extra))
+			if err == nil {
+				return string(redacted)
+			}
+		}
+	} else if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err == nil {
+			for k := range values {
+				if IsSensitive(k, extra...) {
+					values[k] = []string{Value}
+				}
+			}
+			return values.Encode()
+		}
+	}
+	return Text(string(body))
+}
+
+func redactJson(v any, extra []string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if IsSensitive(k, extra...) {
+				t[k] = Value
+			} else {
+				t[k] = redactJson(child, extra)
+			}
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = redactJson(child, extra)
+		}
+	}
+	return v
+}
+
+var digitsPattern = regexp.MustCompile(`[0-9]{16,}`)
+
+// keyValuePattern matches assignments of sensitive keys in free text, e.g.
+// "cvv2":"123", password=secret or `password` = 'secret'.
+var keyValuePattern = regexp.MustCompile(`(?i)(["'` + "`" + `]?\b(?:` + strings.Join([]string{
+	"password", "card_?password", "pin2?", "cvv2?", "pan", "card_?number", "paid_?card_?number", "secret",
+}, "|") + `)\b["'` + "`" + `]?\s*[:=]\s*)("[^"]*"|'[^']*'|[^\s&,;)}\]]+)`)
+
+// Text masks card numbers and values assigned to sensitive keys in free text like log
+// messages and sql statements. Card numbers are runs of exactly 16 digits, they keep
+// their first 6 and last 4 digits, longer runs like rrns are left alone.
+func Text(s string) string {
+	s = digitsPattern.ReplaceAllStringFunc(s, func(digits string) string {
+		if len(digits) != 16 {
+			return digits
+		}
+		return digits[:6] + "******" + digits[12:]
+	})
+	return keyValuePattern.ReplaceAllStringFunc(s, func(match string) string {
+		m := keyValuePattern.FindStringSubmatch(match)
+		value := m[2]
+		if quote := value[0]; quote == '"' || quote == '\'' {
+			return m[1] + string(quote) + Value + string(quote)
+		}
+		return m[1] + Value
+	})
+}
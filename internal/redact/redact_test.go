@@ -0,0 +1,124 @@
+package redact_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/abramad-labs/irbankmock/internal/redact"
+)
+
+func TestText(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"card number", "paid by 6037991234567890", "paid by 603799******7890"},
+		{"rrn", "rrn 58613059128908571100", "rrn 58613059128908571100"},
+		{"short number", "terminal 123456789012345", "terminal 123456789012345"},
+		{"query assignment", "cvv2=123&amount=1000", "cvv2=***&amount=1000"},
+		{"json field", `{"password":"secret","amount":1000}`, `{"password":"***","amount":1000}`},
+		{"single quoted", "card_number = '6037991234567890'", "card_number = '***'"},
+		{"sql column", "`cvv` = 123)", "`cvv` = ***)"},
+		{"unrelated key", "passwords_reset=1 username=bob", "passwords_reset=1 username=bob"},
+	}
+	for _, tc := range cases {
+		if got := redact.Text(tc.in); got != tc.want {
+			t.Errorf("%s: Text(%q) = %q, want %q", tc.name, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestBody(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		in          string
+		extra       []string
+		want        string
+	}{
+		{
+			name:        "nested json",
+			contentType: "application/json; charset=utf-8",
+			in:          `{"card":{"CardNumber":"6037991234567890","Cvv":123},"resNum":"order-1"}`,
+			want:        `{"card":{"CardNumber":"***","Cvv":"***"},"resNum":"order-1"}`,
+		},
+		{
+			name:        "json arrays",
+			contentType: "application/json",
+			in:          `{"cards":[{"pan":"6037991234567890"},{"card_password":"12345"}],"ids":[1,2]}`,
+			want:        `{"cards":[{"pan":"***"},{"card_password":"***"}],"ids":[1,2]}`,
+		},
+		{
+			name:        "extra json field",
+			contentType: "application/json",
+			in:          `{"MobileNo":"09120000000","Amount":1000}`,
+			extra:       []string{"mobile_no"},
+			want:        `{"Amount":1000,"MobileNo":"***"}`,
+		},
+		{
+			name:        "form",
+			contentType: "application/x-www-form-urlencoded",
+			in:          "Token=abc&Password=12345&CellNumber=09120000000",
+			extra:       []string{"cellNumber"},
+			want:        "CellNumber=%2A%2A%2A&Password=%2A%2A%2A&Token=abc",
+		},
+		{
+			name:        "invalid json",
+			contentType: "application/json",
+			in:          `{"pan":"6037991234567890"`,
+			want:        `{"pan":"***"`,
+		},
+		{
+			name:        "text",
+			contentType: "text/plain",
+			in:          "card 6037991234567890",
+			want:        "card 603799******7890",
+		},
+	}
+	for _, tc := range cases {
+		got := redact.Body(tc.contentType, []byte(tc.in), tc.extra...)
+		if !equalBody(tc.contentType, got, tc.want) {
+			t.Errorf("%s: Body(%q) = %q, want %q", tc.name, tc.in, got, tc.want)
+		}
+	}
+}
+
+// equalBody compares json bodies by their values, the order of their fields doesn't
+// matter.
+func equalBody(contentType string, got string, want string) bool {
+	var gotValue, wantValue any
+	if json.Unmarshal([]byte(got), &gotValue) == nil && json.Unmarshal([]byte(want), &wantValue) == nil {
+		return reflect.DeepEqual(gotValue, wantValue)
+	}
+	if contentType == "application/x-www-form-urlencoded" {
+		gotValues, gotErr := url.ParseQuery(got)
+		wantValues, wantErr := url.ParseQuery(want)
+		return gotErr == nil && wantErr == nil && reflect.DeepEqual(gotValues, wantValues)
+	}
+	return got == want
+}
+
+func TestHeaders(t *testing.T) {
+	headers := redact.Headers(map[string]string{
+		"Authorization":       "Bearer token",
+		"Proxy-Authorization": "Basic abc",
+		"Cookie":              "session=1",
+		"Set-Cookie":          "session=1",
+		"X-Api-Key":           "key",
+		"Content-Type":        "application/json",
+	}, "x-api-key")
+	want := map[string]string{
+		"Authorization":       redact.Value,
+		"Proxy-Authorization": redact.Value,
+		"Cookie":              redact.Value,
+		"Set-Cookie":          redact.Value,
+		"X-Api-Key":           redact.Value,
+		"Content-Type":        "application/json",
+	}
+	if !reflect.DeepEqual(headers, want) {
+		t.Errorf("Headers redacted to %v, want %v", headers, want)
+	}
+}
@@ -0,0 +1,577 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/pointers"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type JobStatus string
+
+const JobStatusScheduled = JobStatus("scheduled")
+const JobStatusRunning = JobStatus("running")
+const JobStatusDone = JobStatus("done")
+const JobStatusFailed = JobStatus("failed")
+
+const pollInterval = time.Second
+const batchSize = 50
+
+// a running job locked longer than this was left by a crashed instance and is run again
+const staleLockAge = 10 * time.Minute
+
+const defaultMaxAttempts = 5
+const initialBackoff = 10 * time.Second
+
+// finished delayed jobs are kept this long to be inspected through the management api
+const finishedJobRetention = 24 * time.Hour
+
+const CleanupJobName = "scheduler.cleanup"
+
+var ErrUnknownJob = errors.New("unknown job")
+var ErrJobNotFound = errors.New("job not found")
+var ErrJobNotScheduled = errors.New("only scheduled jobs can be run")
+
+// Job is the persisted state of a periodic job, or a single run of a delayed job.
+type Job struct {
+	ID       uint64 `gorm:"primaryKey"`
+	Name     string `gorm:"index"`
+	Periodic bool
+	// time between the runs of periodic jobs
+	Interval time.Duration
+	// json payload passed to the handler of delayed jobs
+	Payload  string
+	Status   JobStatus `gorm:"index"`
+	RunAt    time.Time `gorm:"index"`
+	Attempts int
+	Runs     int64
+	Failures int64
+
+	LastRunAt      *time.Time
+	LastDurationMs int64
+	LastError      *string
+
+	LockedBy *string
+	LockedAt *time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (Job) TableName() string {
+	return "scheduler_jobs"
+}
+
+// Handler runs a job. ctx is cancelled if the job outlives the shutdown timeout.
+type Handler func(ctx context.Context, db *gorm.DB, payload []byte) error
+
+// Definition declares a job. Jobs with an Interval run periodically, all jobs can
+// also be scheduled to run once with Schedule.
+type Definition struct {
+	Name     string
+	Interval time.Duration
+	Run      Handler
+	// attempts of a failed delayed job before giving up, five by default
+	MaxAttempts int
+	// periodic jobs run by every instance on its own instead of being persisted, for
+	// frequent polls that claim their work themselves
+	InMemory bool
+}
+
+var definitions = map[string]*Definition{}
+
+// instance is the state of the jobs of one server, test servers running in one process
+// only wait for their own jobs.
+type instance struct {
+	running sync.WaitGroup
+	// state of the in-memory periodic jobs
+	inMemoryMu      sync.Mutex
+	inMemoryNextRun map[string]time.Time
+	inMemoryRunning map[string]bool
+}
+
+// instances by connection pool
+var instances sync.Map
+
+func instanceOf(db *gorm.DB) *instance {
+	inst, _ := instances.LoadOrStore(dbutils.Pool(db), &instance{
+		inMemoryNextRun: map[string]time.Time{},
+		inMemoryRunning: map[string]bool{},
+	})
+	return inst.(*instance)
+}
+
+type runNowCtxKeyType struct{}
+
+var runNowKey runNowCtxKeyType
+
+var owner string
+
+var wakeup = make(chan struct{}, 1)
+var triggeredMu sync.Mutex
+var triggered = map[string]struct{}{}
+
+// the instance of the loop started by Start
+var loopInstance *instance
+var stopLoop context.CancelFunc
+var loopDone chan struct{}
+var cancelJobs context.CancelFunc
+
+// unix nanos of the last poll of the loop, zero while it's not running
+var lastPoll atomic.Int64
+
+// the model as of the migration creating it
+type job2025060501 struct {
+	ID             uint64 `gorm:"primaryKey"`
+	Name           string `gorm:"index"`
+	Periodic       bool
+	Interval       time.Duration
+	Payload        string
+	Status         string    `gorm:"index"`
+	RunAt          time.Time `gorm:"index"`
+	Attempts       int
+	Runs           int64
+	Failures       int64
+	LastRunAt      *time.Time
+	LastDurationMs int64
+	LastError      *string
+	LockedBy       *string
+	LockedAt       *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (job2025060501) TableName() string {
+	return "scheduler_jobs"
+}
+
+func init() {
+	hostname, _ := os.Hostname()
+	owner = fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), uuid.NewString())
+	dbutils.OnClose(func(pool *sql.DB) {
+		instances.Delete(pool)
+	})
+
+	migration.Register(&migration.Migration{
+		Version: 2025060501,
+		Name:    "create_scheduler_jobs",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(job2025060501{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(job2025060501{})
+		},
+	})
+
+	// delayed jobs refer to the bank data being removed, periodic jobs keep their state
+	snapshot.RegisterResetter(func(tx *gorm.DB, opts snapshot.ResetOptions) error {
+		return tx.Where("periodic = ?", false).Delete(&Job{}).Error
+	})
+
+	Register(&Definition{
+		Name:     CleanupJobName,
+		Interval: time.Hour,
+		Run: func(ctx context.Context, db *gorm.DB, payload []byte) error {
+			return db.Where("periodic = ? AND status IN ? AND updated_at < ?", false,
+				[]JobStatus{JobStatusDone, JobStatusFailed}, time.Now().Add(-finishedJobRetention)).
+				Delete(&Job{}).Error
+		},
+	})
+}
+
+// Register adds a job definition, it must be called in init.
+func Register(def *Definition) {
+	if def.Name == "" || def.Run == nil {
+		panic("invalid job definition")
+	}
+	if _, ok := definitions[def.Name]; ok {
+		panic("duplicate job " + def.Name)
+	}
+	definitions[def.Name] = def
+}
+
+// Schedule persists a run of the job at runAt. Pass the transaction of the change the
+// job follows up on, so both are committed together.
+func Schedule(db *gorm.DB, name string, runAt time.Time, payload any) error {
+	if _, ok := definitions[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return db.Create(&Job{
+		Name:    name,
+		Payload: string(data),
+		Status:  JobStatusScheduled,
+		RunAt:   runAt,
+	}).Error
+}
+
+// Trigger makes the scheduler run the periodic job soon, without waiting for its
+// interval. It doesn't touch the database so it's safe to call within transactions.
+func Trigger(name string) {
+	triggeredMu.Lock()
+	triggered[name] = struct{}{}
+	triggeredMu.Unlock()
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// RunNow runs a scheduled job right away, waits for it and returns its new state.
+// Handlers tell these runs apart with IsRunNow, e.g. to not wait for a deadline.
+func RunNow(ctx context.Context, db *gorm.DB, id uint64) (*Job, error) {
+	job, err := Get(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := definitions[job.Name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJob, job.Name)
+	}
+	update := db.Model(&Job{}).Where("id = ? AND status = ?", id, JobStatusScheduled).Updates(map[string]any{
+		"status":    JobStatusRunning,
+		"locked_by": owner,
+		"locked_at": time.Now(),
+	})
+	if update.Error != nil {
+		return nil, update.Error
+	}
+	if update.RowsAffected == 0 {
+		return nil, ErrJobNotScheduled
+	}
+	inst := instanceOf(db)
+	inst.running.Add(1)
+	run(context.WithValue(ctx, runNowKey, true), db, job)
+	inst.running.Done()
+	return Get(db, id)
+}
+
+// IsRunNow reports whether the job was started by RunNow rather than at its time.
+func IsRunNow(ctx context.Context) bool {
+	runNow, _ := ctx.Value(runNowKey).(bool)
+	return runNow
+}
+
+func Get(db *gorm.DB, id uint64) (*Job, error) {
+	var job Job
+	err := db.Take(&job, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+type ListFilter struct {
+	Name   string
+	Status JobStatus
+	Limit  int
+}
+
+// List returns the periodic jobs first, then the delayed ones by their run time.
+func List(db *gorm.DB, filter *ListFilter) ([]*Job, error) {
+	query := db.Order("periodic desc, run_at, id")
+	if filter.Name != "" {
+		query = query.Where("name = ?", filter.Name)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	var jobs []*Job
+	err := query.Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// Start runs the due jobs in background until Stop is called.
+func Start(db *gorm.DB) error {
+	err := ensurePeriodic(db)
+	if err != nil {
+		return err
+	}
+
+	loopInstance = instanceOf(db)
+	var loopCtx, jobsCtx context.Context
+	loopCtx, stopLoop = context.WithCancel(context.Background())
+	jobsCtx, cancelJobs = context.WithCancel(context.Background())
+	loopDone = make(chan struct{})
+	go func() {
+		defer close(loopDone)
+		defer lastPoll.Store(0)
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			runDue(jobsCtx, db)
+			lastPoll.Store(time.Now().UnixNano())
+			select {
+			case <-loopCtx.Done():
+				return
+			case <-ticker.C:
+			case <-wakeup:
+			}
+		}
+	}()
+	return nil
+}
+
+// Running reports whether the loop is polling for due jobs. A loop stuck for longer
+// than a few poll intervals, e.g. on a locked database, isn't running.
+func Running() bool {
+	last := lastPoll.Load()
+	return last != 0 && time.Since(time.Unix(0, last)) < 10*pollInterval
+}
+
+// RunDue runs the due jobs of db once and waits for them. It's meant for processes
+// that don't run the loop, like the test servers of unit tests.
+func RunDue(ctx context.Context, db *gorm.DB) {
+	runDue(ctx, db)
+	instanceOf(db).running.Wait()
+}
+
+// Stop stops picking up jobs and waits for the running ones. They are cancelled once
+// ctx is done.
+func Stop(ctx context.Context) {
+	if stopLoop == nil {
+		return
+	}
+	stopLoop()
+	<-loopDone
+
+	done := make(chan struct{})
+	go func() {
+		loopInstance.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("cancelling the running jobs")
+		cancelJobs()
+		<-done
+	}
+	cancelJobs()
+}
+
+// ensurePeriodic creates the persisted state of new periodic jobs. Existing jobs keep
+// their next run time across restarts.
+func ensurePeriodic(db *gorm.DB) error {
+	for _, def := range sortedDefinitions() {
+		if def.Interval <= 0 {
+			continue
+		}
+		if def.InMemory {
+			// persisted by the releases before it ran in memory
+			err := db.Where("name = ? AND periodic = ?", def.Name, true).Delete(&Job{}).Error
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		var job Job
+		err := db.Where("name = ? AND periodic = ?", def.Name, true).Take(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = db.Create(&Job{
+				Name:     def.Name,
+				Periodic: true,
+				Interval: def.Interval,
+				Status:   JobStatusScheduled,
+				RunAt:    time.Now(),
+			}).Error
+		} else if err == nil && job.Interval != def.Interval {
+			runAt := job.RunAt
+			if next := time.Now().Add(def.Interval); next.Before(runAt) {
+				runAt = next
+			}
+			err = db.Model(&job).Updates(map[string]any{
+				"interval": def.Interval,
+				"run_at":   runAt,
+			}).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runDue(ctx context.Context, db *gorm.DB) {
+	names := make([]string, 0, len(definitions))
+	for name, def := range definitions {
+		if !def.InMemory {
+			names = append(names, name)
+		}
+	}
+	triggeredMu.Lock()
+	triggeredNames := []string{}
+	for name := range triggered {
+		triggeredNames = append(triggeredNames, name)
+	}
+	triggered = map[string]struct{}{}
+	triggeredMu.Unlock()
+
+	inst := instanceOf(db)
+	runInMemory(ctx, db, inst, triggeredNames)
+
+	staleAt := time.Now().Add(-staleLockAge)
+	var jobs []*Job
+	err := db.Where("name IN ?", names).
+		Where(db.Where("status = ? AND run_at <= ?", JobStatusScheduled, time.Now()).
+			Or("status = ? AND periodic = ? AND name IN ?", JobStatusScheduled, true, triggeredNames).
+			Or("status = ? AND locked_at < ?", JobStatusRunning, staleAt)).
+		Order("run_at").
+		Limit(batchSize).
+		Find(&jobs).Error
+	if err != nil {
+		slog.Error("failed to fetch the due jobs", "error", err)
+		return
+	}
+
+	for _, job := range jobs {
+		claimedAt := time.Now()
+		claim := db.Model(&Job{}).Where("id = ? AND status = ?", job.ID, job.Status)
+		if job.Status == JobStatusRunning {
+			slog.Warn("job was left running, running it again", "jobId", job.ID, "job", job.Name, "lockedBy", pointers.DerefZero(job.LockedBy))
+			claim = claim.Where("locked_at < ?", staleAt)
+		}
+		update := claim.Updates(map[string]any{
+			"status":    JobStatusRunning,
+			"locked_by": owner,
+			"locked_at": claimedAt,
+		})
+		if update.Error != nil {
+			slog.Error("failed to claim job", "jobId", job.ID, "job", job.Name, "error", update.Error)
+			continue
+		}
+		if update.RowsAffected == 0 {
+			// another instance was faster
+			continue
+		}
+		inst.running.Add(1)
+		go func(job *Job) {
+			defer inst.running.Done()
+			run(ctx, db, job)
+		}(job)
+	}
+}
+
+// runInMemory starts the in-memory periodic jobs that are due or triggered, unless
+// their previous run is still going.
+func runInMemory(ctx context.Context, db *gorm.DB, inst *instance, triggeredNames []string) {
+	now := time.Now()
+	inst.inMemoryMu.Lock()
+	defer inst.inMemoryMu.Unlock()
+	for _, def := range sortedDefinitions() {
+		if !def.InMemory || def.Interval <= 0 || inst.inMemoryRunning[def.Name] {
+			continue
+		}
+		if now.Before(inst.inMemoryNextRun[def.Name]) && !slices.Contains(triggeredNames, def.Name) {
+			continue
+		}
+		inst.inMemoryRunning[def.Name] = true
+		inst.running.Add(1)
+		go func(def *Definition) {
+			defer inst.running.Done()
+			err := call(ctx, db, def, nil, slog.With("job", def.Name))
+			if err != nil {
+				slog.Warn("job failed", "job", def.Name, "error", err)
+			}
+			inst.inMemoryMu.Lock()
+			inst.inMemoryRunning[def.Name] = false
+			inst.inMemoryNextRun[def.Name] = time.Now().Add(def.Interval)
+			inst.inMemoryMu.Unlock()
+		}(def)
+	}
+}
+
+func run(ctx context.Context, db *gorm.DB, job *Job) {
+	def := definitions[job.Name]
+	start := time.Now()
+	err := call(ctx, db, def, []byte(job.Payload), slog.With("jobId", job.ID, "job", job.Name))
+	finished := time.Now()
+
+	updates := map[string]any{
+		"locked_by":        nil,
+		"locked_at":        nil,
+		"runs":             gorm.Expr("runs + 1"),
+		"last_run_at":      start,
+		"last_duration_ms": finished.Sub(start).Milliseconds(),
+		"last_error":       nil,
+	}
+	if err != nil {
+		slog.Warn("job failed", "jobId", job.ID, "job", job.Name, "error", err)
+		updates["last_error"] = err.Error()
+		updates["failures"] = gorm.Expr("failures + 1")
+	}
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// cancelled by the shutdown, the run doesn't count
+		updates = map[string]any{"status": JobStatusScheduled, "locked_by": nil, "locked_at": nil}
+	case job.Periodic:
+		updates["status"] = JobStatusScheduled
+		updates["run_at"] = finished.Add(job.Interval)
+	case err == nil:
+		updates["status"] = JobStatusDone
+	default:
+		maxAttempts := def.MaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = defaultMaxAttempts
+		}
+		updates["attempts"] = job.Attempts + 1
+		if job.Attempts+1 >= maxAttempts {
+			updates["status"] = JobStatusFailed
+		} else {
+			updates["status"] = JobStatusScheduled
+			updates["run_at"] = finished.Add(initialBackoff << job.Attempts)
+		}
+	}
+
+	err = db.Model(&Job{}).Where("id = ? AND locked_by = ?", job.ID, owner).Updates(updates).Error
+	if err != nil {
+		slog.Error("failed to update job", "jobId", job.ID, "job", job.Name, "error", err)
+	}
+}
+
+func call(ctx context.Context, db *gorm.DB, def *Definition, payload []byte, logger *slog.Logger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			logger.Error("job panicked", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+		}
+	}()
+	return def.Run(ctx, db, payload)
+}
+
+func sortedDefinitions() []*Definition {
+	result := make([]*Definition, 0, len(definitions))
+	for _, def := range definitions {
+		result = append(result, def)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,145 @@
+package scheduler_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/dbtest"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/scheduler"
+	"gorm.io/gorm"
+)
+
+const recordJobName = "test.record"
+
+type recordPayload struct {
+	Key string `json:"key"`
+}
+
+// runs of the record job by the key of their payload
+var runsMu sync.Mutex
+var runs = map[string]int{}
+
+func init() {
+	scheduler.Register(&scheduler.Definition{
+		Name: recordJobName,
+		Run: func(ctx context.Context, db *gorm.DB, payload []byte) error {
+			var p recordPayload
+			err := json.Unmarshal(payload, &p)
+			if err != nil {
+				return err
+			}
+			runsMu.Lock()
+			defer runsMu.Unlock()
+			runs[p.Key]++
+			return nil
+		},
+	})
+}
+
+func runsOf(key string) int {
+	runsMu.Lock()
+	defer runsMu.Unlock()
+	return runs[key]
+}
+
+func migrate(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	_, err := migration.Up(db, migration.UpOptions{})
+	if err != nil {
+		t.Fatalf("migrations failed: %v", err)
+	}
+}
+
+// makeDue moves the delayed jobs of key to the past, as if their time had come.
+func makeDue(t *testing.T, db *gorm.DB, key string) {
+	t.Helper()
+	payload, _ := json.Marshal(&recordPayload{Key: key})
+	err := db.Model(&scheduler.Job{}).Where("name = ? AND payload = ?", recordJobName, string(payload)).
+		Update("run_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func jobOf(t *testing.T, db *gorm.DB) *scheduler.Job {
+	t.Helper()
+	jobs, err := scheduler.List(db, &scheduler.ListFilter{Name: recordJobName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("there are %d jobs, want 1", len(jobs))
+	}
+	return jobs[0]
+}
+
+func TestDelayedJobRunsOnceDue(t *testing.T) {
+	ctx := context.Background()
+	db := dbtest.Open(t)
+	migrate(t, db)
+	key := t.Name()
+
+	err := scheduler.Schedule(db, recordJobName, time.Now().Add(time.Hour), &recordPayload{Key: key})
+	if err != nil {
+		t.Fatalf("schedule failed: %v", err)
+	}
+	scheduler.RunDue(ctx, db)
+	if runsOf(key) != 0 {
+		t.Fatal("the job ran before it was due")
+	}
+	if job := jobOf(t, db); job.Status != scheduler.JobStatusScheduled {
+		t.Fatalf("the job is %s before it was due", job.Status)
+	}
+
+	makeDue(t, db, key)
+	scheduler.RunDue(ctx, db)
+	if runsOf(key) != 1 {
+		t.Fatalf("the due job ran %d times, want 1", runsOf(key))
+	}
+	if job := jobOf(t, db); job.Status != scheduler.JobStatusDone || job.Runs != 1 {
+		t.Errorf("the job is %s after %d runs, want done after 1", job.Status, job.Runs)
+	}
+
+	scheduler.RunDue(ctx, db)
+	if runsOf(key) != 1 {
+		t.Errorf("the done job ran again")
+	}
+}
+
+func TestDelayedJobSurvivesReopening(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("IRBANKMOCK_DATA_PATH", t.TempDir())
+	t.Setenv("IRBANKMOCK_DB_DRIVER", "sqlite")
+	t.Setenv("IRBANKMOCK_DB_IN_MEMORY", "")
+	key := t.Name()
+
+	db, err := dbutils.InitializeDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrate(t, db)
+	err = scheduler.Schedule(db, recordJobName, time.Now().Add(time.Hour), &recordPayload{Key: key})
+	if err != nil {
+		t.Fatalf("schedule failed: %v", err)
+	}
+	err = dbutils.Close(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = dbutils.InitializeDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbutils.Close(db) })
+	makeDue(t, db, key)
+	scheduler.RunDue(ctx, db)
+	if runsOf(key) != 1 {
+		t.Errorf("the job persisted before reopening ran %d times, want 1", runsOf(key))
+	}
+}
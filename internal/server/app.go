@@ -0,0 +1,87 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/abramad-labs/irbankmock/internal/auth"
+	"github.com/abramad-labs/irbankmock/internal/banks/registry"
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/health"
+	"github.com/abramad-labs/irbankmock/internal/inspector"
+	"github.com/abramad-labs/irbankmock/internal/logging"
+	"github.com/abramad-labs/irbankmock/internal/management"
+	"github.com/abramad-labs/irbankmock/internal/metrics"
+	"github.com/abramad-labs/irbankmock/internal/openapi"
+	"github.com/abramad-labs/irbankmock/internal/tlscert"
+	fibererror "github.com/abramad-labs/irbankmock/internal/usererror/fiber"
+	"github.com/abramad-labs/irbankmock/internal/webapp"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"gorm.io/gorm"
+)
+
+type Options struct {
+	// hides the banner fiber prints once it listens, e.g. in the output of go test
+	DisableStartupMessage bool
+	// the background jobs are run by scheduler.RunDue rather than the loop, like in the
+	// test servers
+	ManualJobs bool
+}
+
+// NewApp builds the http server with all routes of the banks and the management api.
+// db is handed to every request, it may be nil when only the routes are inspected.
+func NewApp(db *gorm.DB, opts Options) *fiber.App {
+	trustedProxies := conf.GetTrustedProxies()
+	app := fiber.New(fiber.Config{
+		CaseSensitive: false,
+		ErrorHandler:  fibererror.FiberUserErrorHandling,
+		// nil trusts the forwarded headers of every client
+		EnableTrustedProxyCheck: trustedProxies != nil,
+		TrustedProxies:          trustedProxies,
+		DisableStartupMessage:   opts.DisableStartupMessage,
+	})
+
+	var staticNext func(*fiber.Ctx) bool
+	if !app.Config().CaseSensitive {
+		staticNext = func(c *fiber.Ctx) bool {
+			path := c.Path()
+			if strings.HasPrefix(path, registry.RegistryBanksPrefix) {
+				c.Path(strings.ToLower(path))
+			}
+			return false
+		}
+	}
+
+	app.Use(func(c *fiber.Ctx) error {
+		c = dbutils.ContextWithDb(c, db)
+		return c.Next()
+	})
+	app.Use(metrics.Middleware)
+	app.Use(requestid.New())
+	app.Use(logging.Middleware)
+	app.Use(inspector.Middleware)
+	app.Use(fibererror.Middleware)
+	if webapp.ServeEmbedded(conf.GetWebAppPath(), conf.IsWebAppPathSet()) {
+		app.Use(webapp.Handler(staticNext))
+	} else {
+		// after the middlewares: fiber appends later middlewares to the static route,
+		// which is shared by GET and HEAD, and would run them twice
+		app.Static("/", conf.GetWebAppPath(), fiber.Static{
+			Browse: false,
+			Next:   staticNext,
+		})
+	}
+
+	management.ConfigRouters(app.Group(management.RouterPrefix, auth.RequireAdmin))
+
+	rootGroup := app.Group("/")
+	registry.ConfigAppRouters(rootGroup.(*fiber.Group))
+
+	tlscert.Routes(app)
+	metrics.Routes(app)
+	registry.ConfigBanksRouter(app)
+	health.Routes(app, health.Options{ManualJobs: opts.ManualJobs})
+	openapi.Routes(app)
+	return app
+}
@@ -0,0 +1,300 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/openapi"
+	"github.com/abramad-labs/irbankmock/internal/usererror"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CAPath is the route serving the generated CA certificate.
+const CAPath = "/tls/ca.pem"
+
+const caFileName = "ca.pem"
+const caKeyFileName = "ca-key.pem"
+const certFileName = "cert.pem"
+const keyFileName = "key.pem"
+
+const caValidity = 10 * 365 * 24 * time.Hour
+const certValidity = 397 * 24 * time.Hour
+
+// certificates expiring sooner than this are renewed at startup
+const renewBefore = 30 * 24 * time.Hour
+
+var ErrNoGeneratedCA = errors.New("the certificate is not issued by the generated ca")
+var ErrTLSDisabled = errors.New("tls is not enabled")
+
+// pem of the CA generated for an in-memory database, which is not written to the data
+// path
+var memoryCA atomic.Pointer[[]byte]
+
+// Routes adds the route serving the generated CA certificate.
+func Routes(r fiber.Router) {
+	openapi.Route(r, fiber.MethodGet, CAPath, &openapi.Operation{
+		Summary:             "Download the generated tls ca certificate",
+		Description:         "Clients trust the https listener by adding this certificate to their trust store.",
+		Tags:                []string{"tls"},
+		ResponseContentType: "application/x-pem-file",
+		Response:            openapi.BinarySchema,
+	}, ServeCA)
+}
+
+// Config returns the tls config of the https listener. The certificate comes from the
+// configured files, or is issued by a local CA generated in the data dir. The CA is
+// kept across restarts so clients only need to trust it once. With an in-memory
+// database nothing is written to the data dir, the CA lives as long as the process.
+func Config() (*tls.Config, error) {
+	if certFile := conf.GetTLSCertFile(); certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, conf.GetTLSKeyFile())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the tls certificate: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+	if conf.IsInMemoryDb() {
+		return memoryConfig()
+	}
+
+	err := os.MkdirAll(conf.GetTLSPath(), 0o700)
+	if err != nil {
+		return nil, err
+	}
+	caCert, caKey, err := loadOrCreateCA()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := loadOrIssueCert(caCert, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{*cert}}, nil
+}
+
+func loadOrCreateCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPath := path.Join(conf.GetTLSPath(), caFileName)
+	keyPath := path.Join(conf.GetTLSPath(), caKeyFileName)
+	cert, key, err := loadPair(certPath, keyPath)
+	if err == nil && time.Until(cert.NotAfter) > renewBefore {
+		return cert, key, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	slog.Info("generating a local tls ca", "path", certPath)
+	der, key, err := createCA()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = writePair(certPath, keyPath, der, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	// certificates of the previous ca must be reissued
+	os.Remove(path.Join(conf.GetTLSPath(), certFileName))
+	cert, err = x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+func createCA() ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{Organization: []string{"irbankmock"}, CommonName: "irbankmock local ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return der, key, nil
+}
+
+func loadOrIssueCert(caCert *x509.Certificate, caKey *ecdsa.PrivateKey) (*tls.Certificate, error) {
+	certPath := path.Join(conf.GetTLSPath(), certFileName)
+	keyPath := path.Join(conf.GetTLSPath(), keyFileName)
+	hosts := conf.GetTLSHosts()
+	cert, _, err := loadPair(certPath, keyPath)
+	if err == nil && time.Until(cert.NotAfter) > renewBefore && coversHosts(cert, hosts) &&
+		cert.CheckSignatureFrom(caCert) == nil {
+		pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+		return &pair, err
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	slog.Info("issuing a tls certificate", "hosts", hosts)
+	der, key, err := issueCert(caCert, caKey, hosts)
+	if err != nil {
+		return nil, err
+	}
+	err = writePair(certPath, keyPath, der, key)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	return &pair, err
+}
+
+func issueCert(caCert *x509.Certificate, caKey *ecdsa.PrivateKey, hosts []string) ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{Organization: []string{"irbankmock"}, CommonName: hosts[0]},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return der, key, nil
+}
+
+// memoryConfig issues a certificate by a CA generated for this process only.
+func memoryConfig() (*tls.Config, error) {
+	slog.Info("generating an in-memory tls ca")
+	caDer, caKey, err := createCA()
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDer)
+	if err != nil {
+		return nil, err
+	}
+	der, key, err := issueCert(caCert, caKey, conf.GetTLSHosts())
+	if err != nil {
+		return nil, err
+	}
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer})
+	memoryCA.Store(&caPem)
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+func coversHosts(cert *x509.Certificate, hosts []string) bool {
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+				return false
+			}
+		} else if !slices.Contains(cert.DNSNames, h) {
+			return false
+		}
+	}
+	return true
+}
+
+func loadPair(certPath string, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPem, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPem, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	certBlock, _ := pem.Decode(certPem)
+	keyBlock, _ := pem.Decode(keyPem)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("invalid pem file %s or %s", certPath, keyPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func writePair(certPath string, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic(err)
+	}
+	return serial
+}
+
+// ServeCA lets clients download the generated CA certificate to trust it.
+func ServeCA(c *fiber.Ctx) error {
+	if conf.GetTLSCertFile() != "" {
+		return usererror.NewWithStatus(ErrNoGeneratedCA, fiber.StatusNotFound)
+	}
+	if conf.IsInMemoryDb() {
+		content := memoryCA.Load()
+		if content == nil {
+			return usererror.NewWithStatus(ErrTLSDisabled, fiber.StatusNotFound)
+		}
+		return sendCA(c, *content)
+	}
+	content, err := os.ReadFile(path.Join(conf.GetTLSPath(), caFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return usererror.NewWithStatus(ErrTLSDisabled, fiber.StatusNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	return sendCA(c, content)
+}
+
+func sendCA(c *fiber.Ctx, content []byte) error {
+	c.Set(fiber.HeaderContentType, "application/x-pem-file")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="irbankmock-ca.pem"`)
+	return c.Send(content)
+}
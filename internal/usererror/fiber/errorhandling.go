@@ -3,10 +3,10 @@ package fiber
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 
 	"github.com/abramad-labs/irbankmock/internal/usererror"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/google/uuid"
 )
 
@@ -35,7 +35,7 @@ func FiberUserErrorHandling(c *fiber.Ctx, err error) error {
 		})
 	}
 	errUuid := uuid.NewString()
-	log.Errorf("server error [%s]: %s", errUuid, err.Error())
+	slog.ErrorContext(c.UserContext(), "server error", "errorId", errUuid, "error", err)
 
 	code := fiber.StatusInternalServerError
 	message := ""
@@ -60,3 +60,17 @@ func FiberUserErrorHandling(c *fiber.Ctx, err error) error {
 		RequestId: c.Locals("requestid").(string),
 	})
 }
+
+// Middleware writes the error response as soon as a handler fails, instead of fiber
+// after all middlewares, so the middlewares before it log and count the status that
+// is sent. It must be the last middleware of the app.
+func Middleware(c *fiber.Ctx) error {
+	err := c.Next()
+	if err == nil {
+		return nil
+	}
+	if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return nil
+}
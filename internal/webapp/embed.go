@@ -0,0 +1,21 @@
+//go:build embedwebapp
+
+package webapp
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// dist is a copy of web/app/out, go:embed can't reach outside of the package.
+//
+//go:embed all:dist
+var dist embed.FS
+
+func init() {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err)
+	}
+	files = sub
+}
@@ -0,0 +1,76 @@
+package webapp
+
+import (
+	"errors"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// files is the exported web app embedded in the binary, nil unless built with the
+// embedwebapp tag.
+var files fs.FS
+
+func IsEmbedded() bool {
+	return files != nil
+}
+
+// ServeEmbedded reports whether the embedded web app is served instead of the one in
+// dir. A configured dir always wins, the default one if it exists, e.g. a fresh export
+// in a checkout.
+func ServeEmbedded(dir string, configured bool) bool {
+	if !IsEmbedded() || configured {
+		return false
+	}
+	stat, err := os.Stat(dir)
+	return err != nil || !stat.IsDir()
+}
+
+// Handler serves the embedded web app like fiber's Static serves it from disk:
+// directories serve their index.html, and requests of missing files, or other methods
+// than GET and HEAD, continue to the next routes. next may rewrite the request before
+// the lookup, returning true skips it.
+func Handler(next func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if next != nil && next(c) {
+			return c.Next()
+		}
+		if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+			return c.Next()
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+c.Path()), "/")
+		if name == "" {
+			name = "."
+		}
+		content, name, err := readFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return c.Next()
+		}
+		if err != nil {
+			return err
+		}
+
+		if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+			c.Set(fiber.HeaderContentType, ct)
+		}
+		return c.Send(content)
+	}
+}
+
+// readFile reads the file at name, or its index.html if it's a directory.
+func readFile(name string) ([]byte, string, error) {
+	stat, err := fs.Stat(files, name)
+	if err != nil {
+		return nil, name, err
+	}
+	if stat.IsDir() {
+		name = path.Join(name, "index.html")
+	}
+	content, err := fs.ReadFile(files, name)
+	return content, name, err
+}
@@ -0,0 +1,166 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/conf"
+	"github.com/abramad-labs/irbankmock/internal/scheduler"
+	"gorm.io/gorm"
+)
+
+const SignatureHeader = "X-IRBankMock-Signature"
+const EventHeader = "X-IRBankMock-Event"
+const DeliveryHeader = "X-IRBankMock-Delivery"
+
+const pollInterval = 2 * time.Second
+const batchSize = 20
+const initialBackoff = 5 * time.Second
+const maxBackoff = time.Hour
+
+// every instance polls the deliveries, a delivery being sent is claimed this long so
+// the others skip it. It's retried once the claim ends if the instance crashed.
+const claimDuration = time.Minute
+
+var client = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// DispatchJobName is the scheduler job sending the pending deliveries.
+const DispatchJobName = "webhook.dispatch"
+
+func init() {
+	scheduler.Register(&scheduler.Definition{
+		Name:     DispatchJobName,
+		Interval: pollInterval,
+		InMemory: true,
+		Run: func(ctx context.Context, db *gorm.DB, payload []byte) error {
+			return dispatchPending(ctx, db)
+		},
+	})
+}
+
+// Wake lets the dispatcher send the queued deliveries right away instead of at its
+// next poll. Call it once the transaction passed to Publish committed, the dispatcher
+// doesn't see the deliveries before.
+func Wake() {
+	scheduler.Trigger(DispatchJobName)
+}
+
+// Sign returns the value of the signature header for the payload.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func dispatchPending(ctx context.Context, db *gorm.DB) error {
+	for ctx.Err() == nil {
+		var deliveries []*Delivery
+		err := db.Preload("Subscription").
+			Where("status = ? AND next_attempt_at <= ?", DeliveryStatusPending, time.Now()).
+			Order("next_attempt_at").
+			Limit(batchSize).
+			Find(&deliveries).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch webhook deliveries: %w", err)
+		}
+		for _, d := range deliveries {
+			attempt(ctx, db, d)
+		}
+		if len(deliveries) < batchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+func attempt(ctx context.Context, db *gorm.DB, d *Delivery) {
+	start := time.Now()
+	claim := db.Model(&Delivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", d.ID, DeliveryStatusPending, start).
+		Update("next_attempt_at", start.Add(claimDuration))
+	if claim.Error != nil {
+		slog.Error("failed to claim webhook delivery", "deliveryId", d.ID, "error", claim.Error)
+		return
+	}
+	if claim.RowsAffected == 0 {
+		// sent by another instance
+		return
+	}
+
+	statusCode, err := send(ctx, d)
+	latency := time.Since(start).Milliseconds()
+	if ctx.Err() != nil {
+		// interrupted by the shutdown, sent again once the claim ends
+		return
+	}
+
+	d.Attempts++
+	updates := map[string]any{
+		"attempts":        d.Attempts,
+		"last_attempt_at": start,
+		"latency_ms":      latency,
+	}
+	if statusCode != 0 {
+		updates["last_status_code"] = statusCode
+	}
+	if err == nil {
+		updates["status"] = DeliveryStatusDelivered
+		updates["delivered_at"] = time.Now()
+		updates["last_error"] = nil
+	} else {
+		updates["last_error"] = err.Error()
+		if d.Attempts >= conf.GetWebhookMaxAttempts() {
+			updates["status"] = DeliveryStatusFailed
+		} else {
+			updates["next_attempt_at"] = time.Now().Add(backoff(d.Attempts))
+		}
+	}
+	err = db.Model(&Delivery{}).Where("id = ?", d.ID).Updates(updates).Error
+	if err != nil {
+		slog.Error("failed to update webhook delivery", "deliveryId", d.ID, "error", err)
+	}
+}
+
+// backoff doubles the wait after every failed attempt
+func backoff(attempts int) time.Duration {
+	wait := initialBackoff
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+func send(ctx context.Context, d *Delivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "irbankmock-webhook")
+	req.Header.Set(EventHeader, string(d.Event))
+	req.Header.Set(DeliveryHeader, d.EventId)
+	req.Header.Set(SignatureHeader, Sign(d.Subscription.Secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import "time"
+
+type DeliveryStatus string
+
+const DeliveryStatusPending = DeliveryStatus("pending")
+const DeliveryStatusDelivered = DeliveryStatus("delivered")
+const DeliveryStatusFailed = DeliveryStatus("failed")
+
+// A Subscription receives events of a terminal, a bank, a namespace or all of them.
+// Empty filters match everything.
+type Subscription struct {
+	ID  uint64 `gorm:"primarykey"`
+	URL string `gorm:"size:2083"`
+
+	// key used to sign the payloads using HMAC-SHA256
+	Secret string
+
+	// comma separated list of event types, empty for all events
+	Events string
+
+	Bank       string
+	TerminalId *int64
+	Namespace  string `gorm:"size:64"`
+
+	CreatedAt time.Time
+}
+
+// A Delivery is a persisted event waiting to be, or already, sent to a subscription.
+type Delivery struct {
+	ID             uint64       `gorm:"primarykey"`
+	SubscriptionId uint64       `gorm:"index"`
+	Subscription   Subscription `gorm:"foreignKey:SubscriptionId;constraint:OnDelete:CASCADE"`
+
+	EventId string `gorm:"size:36"`
+	Event   EventType
+	Payload string
+
+	Status   DeliveryStatus `gorm:"index"`
+	Attempts int
+
+	NextAttemptAt  time.Time `gorm:"index"`
+	LastAttemptAt  *time.Time
+	LastStatusCode *int
+	LastError      *string
+	LatencyMs      *int64
+
+	CreatedAt   time.Time
+	DeliveredAt *time.Time
+}
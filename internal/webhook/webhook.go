@@ -0,0 +1,298 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/internal/clock"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/namespace"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type EventType string
+
+const EventTokenCreated = EventType("token.created")
+const EventPaymentPaid = EventType("payment.paid")
+const EventPaymentCancelled = EventType("payment.cancelled")
+const EventPaymentFailed = EventType("payment.failed")
+const EventPaymentVerified = EventType("payment.verified")
+const EventPaymentReversed = EventType("payment.reversed")
+const EventPaymentExpired = EventType("payment.expired")
+
+var EventTypes = []EventType{
+	EventTokenCreated,
+	EventPaymentPaid,
+	EventPaymentCancelled,
+	EventPaymentFailed,
+	EventPaymentVerified,
+	EventPaymentReversed,
+	EventPaymentExpired,
+}
+
+var ErrInvalidURL = errors.New("webhook url must be an absolute http or https url")
+var ErrInvalidEvent = errors.New("unknown webhook event")
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+type Event struct {
+	Type       EventType
+	Bank       string
+	Namespace  string
+	TerminalId int64
+	Data       any
+}
+
+// Payload is the json body posted to the subscribers.
+type Payload struct {
+	Id         string    `json:"id"`
+	Event      EventType `json:"event"`
+	Bank       string    `json:"bank"`
+	Namespace  string    `json:"namespace"`
+	TerminalId int64     `json:"terminalId"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Data       any       `json:"data"`
+}
+
+type SubscriptionRequest struct {
+	URL        string      `json:"url"`
+	Secret     string      `json:"secret"`
+	Events     []EventType `json:"events"`
+	Bank       string      `json:"bank"`
+	TerminalId *int64      `json:"terminalId"`
+	Namespace  string      `json:"namespace"`
+}
+
+// the models as of the migration creating them
+type subscription2025060301 struct {
+	ID         uint64 `gorm:"primarykey"`
+	URL        string `gorm:"size:2083"`
+	Secret     string
+	Events     string
+	Bank       string
+	TerminalId *int64
+	Namespace  string `gorm:"size:64"`
+	CreatedAt  time.Time
+}
+
+func (subscription2025060301) TableName() string {
+	return "subscriptions"
+}
+
+type delivery2025060301 struct {
+	ID             uint64                 `gorm:"primarykey"`
+	SubscriptionId uint64                 `gorm:"index"`
+	Subscription   subscription2025060301 `gorm:"foreignKey:SubscriptionId;constraint:OnDelete:CASCADE"`
+	EventId        string                 `gorm:"size:36"`
+	Event          string
+	Payload        string
+	Status         string `gorm:"index"`
+	Attempts       int
+	NextAttemptAt  time.Time `gorm:"index"`
+	LastAttemptAt  *time.Time
+	LastStatusCode *int
+	LastError      *string
+	LatencyMs      *int64
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+func (delivery2025060301) TableName() string {
+	return "deliveries"
+}
+
+func init() {
+	migration.Register(&migration.Migration{
+		Version: 2025060301,
+		Name:    "create_webhooks",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AutoMigrate(subscription2025060301{}, delivery2025060301{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(delivery2025060301{}, subscription2025060301{})
+		},
+	})
+
+	snapshot.RegisterResetter(func(tx *gorm.DB, opts snapshot.ResetOptions) error {
+		return tx.Where("1 = 1").Delete(&Delivery{}).Error
+	})
+
+	namespace.RegisterDestroyer(func(tx *gorm.DB, ns string) error {
+		subscriptions := tx.Model(&Subscription{}).Select("id").Where("namespace = ?", ns)
+		err := tx.Where("subscription_id IN (?)", subscriptions).Delete(&Delivery{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("namespace = ?", ns).Delete(&Subscription{}).Error
+	})
+}
+
+func (s *Subscription) EventList() []EventType {
+	if s.Events == "" {
+		return []EventType{}
+	}
+	parts := strings.Split(s.Events, ",")
+	events := make([]EventType, len(parts))
+	for i, p := range parts {
+		events[i] = EventType(p)
+	}
+	return events
+}
+
+func (s *Subscription) accepts(event EventType) bool {
+	return s.Events == "" || slices.Contains(s.EventList(), event)
+}
+
+func CreateSubscription(db *gorm.DB, req *SubscriptionRequest) (*Subscription, error) {
+	u, err := url.ParseRequestURI(req.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, ErrInvalidURL
+	}
+	events := make([]string, len(req.Events))
+	for i, e := range req.Events {
+		if !slices.Contains(EventTypes, e) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidEvent, e)
+		}
+		events[i] = string(e)
+	}
+	secret := req.Secret
+	if secret == "" {
+		secret = uuid.NewString()
+	}
+
+	sub := &Subscription{
+		URL:        req.URL,
+		Secret:     secret,
+		Events:     strings.Join(events, ","),
+		Bank:       req.Bank,
+		TerminalId: req.TerminalId,
+		Namespace:  strings.ToLower(req.Namespace),
+	}
+	err = db.Create(sub).Error
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func ListSubscriptions(db *gorm.DB) ([]*Subscription, error) {
+	var subs []*Subscription
+	err := db.Order("id").Find(&subs).Error
+	return subs, err
+}
+
+func DeleteSubscription(db *gorm.DB, id uint64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("subscription_id = ?", id).Delete(&Delivery{}).Error
+		if err != nil {
+			return err
+		}
+		res := tx.Delete(&Subscription{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrSubscriptionNotFound
+		}
+		return nil
+	})
+}
+
+type DeliveryFilter struct {
+	SubscriptionId *uint64
+	Status         *DeliveryStatus
+	Limit          int
+}
+
+func ListDeliveries(db *gorm.DB, filter *DeliveryFilter) ([]*Delivery, error) {
+	query := db.Model(&Delivery{}).Order("id desc")
+	if filter.SubscriptionId != nil {
+		query = query.Where("subscription_id = ?", *filter.SubscriptionId)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	var deliveries []*Delivery
+	err := query.Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// Redeliver schedules the delivery to be sent again as soon as possible.
+func Redeliver(db *gorm.DB, id uint64) error {
+	res := db.Model(&Delivery{}).Where("id = ?", id).Updates(map[string]any{
+		"status":          DeliveryStatusPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrDeliveryNotFound
+	}
+	Wake()
+	return nil
+}
+
+// Publish queues a delivery of the event for every matching subscription. Pass the
+// transaction that changed the state so the deliveries are only kept if it commits,
+// and call Wake once it did.
+func Publish(db *gorm.DB, event *Event) error {
+	var subs []*Subscription
+	err := db.Model(&Subscription{}).
+		Where("bank = '' OR bank = ?", event.Bank).
+		Where("terminal_id IS NULL OR terminal_id = ?", event.TerminalId).
+		Where("namespace = '' OR namespace = ?", event.Namespace).
+		Find(&subs).Error
+	if err != nil {
+		return err
+	}
+
+	// the subscribers see the time of the simulated world, the deliveries are sent by
+	// the real time like the other jobs of the server
+	occurredAt := clock.For(db, event.Namespace).Now()
+	now := time.Now()
+	deliveries := make([]*Delivery, 0, len(subs))
+	for _, sub := range subs {
+		if !sub.accepts(event.Type) {
+			continue
+		}
+		payload := &Payload{
+			Id:         uuid.NewString(),
+			Event:      event.Type,
+			Bank:       event.Bank,
+			Namespace:  event.Namespace,
+			TerminalId: event.TerminalId,
+			OccurredAt: occurredAt,
+			Data:       event.Data,
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, &Delivery{
+			SubscriptionId: sub.ID,
+			EventId:        payload.Id,
+			Event:          event.Type,
+			Payload:        string(body),
+			Status:         DeliveryStatusPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return db.Create(deliveries).Error
+}
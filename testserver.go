@@ -0,0 +1,197 @@
+// Package irbankmock runs the mock in the process of Go tests, so they don't need a
+// running container. Use the client package to drive servers running elsewhere.
+package irbankmock
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/abramad-labs/irbankmock/client"
+	_ "github.com/abramad-labs/irbankmock/internal/banks"
+	"github.com/abramad-labs/irbankmock/internal/dbutils"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/migration"
+	"github.com/abramad-labs/irbankmock/internal/dbutils/snapshot"
+	"github.com/abramad-labs/irbankmock/internal/eventbus"
+	"github.com/abramad-labs/irbankmock/internal/fixtures"
+	"github.com/abramad-labs/irbankmock/internal/scheduler"
+	"github.com/abramad-labs/irbankmock/internal/server"
+	"gorm.io/gorm"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// TestServer is a mock server with its own in-memory database, listening on a random
+// loopback port. Settings are taken from the IRBANKMOCK_* environment variables like
+// the binary, except the database which is always a fresh in-memory one.
+//
+// Background jobs such as token expiry don't run by themselves, call RunDueJobs.
+type TestServer struct {
+	// URL is the base url of the server, e.g. http://127.0.0.1:41234
+	URL string
+	// Client calls the server in the default namespace
+	Client *client.Client
+
+	t  testing.TB
+	db *gorm.DB
+}
+
+// NewTestServer starts a server which is shut down by t.Cleanup. Failures to start
+// fail the test.
+func NewTestServer(t testing.TB) *TestServer {
+	t.Helper()
+	s, err := startTestServer(t)
+	if err != nil {
+		t.Fatalf("irbankmock: failed to start the test server: %v", err)
+	}
+	return s
+}
+
+func startTestServer(t testing.TB) (*TestServer, error) {
+	db, err := dbutils.OpenInMemory()
+	if err != nil {
+		return nil, err
+	}
+	_, err = migration.Up(db, migration.UpOptions{})
+	if err != nil {
+		dbutils.Close(db)
+		return nil, err
+	}
+
+	// fiber can't be served by httptest without buffering the streamed responses of
+	// the live feed, so it gets a listener of its own
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		dbutils.Close(db)
+		return nil, err
+	}
+	app := server.NewApp(db, server.Options{DisableStartupMessage: true, ManualJobs: true})
+	served := make(chan error, 1)
+	go func() {
+		served <- app.Listener(ln)
+	}()
+
+	s := &TestServer{
+		URL: "http://" + ln.Addr().String(),
+		t:   t,
+		db:  db,
+	}
+	s.Client = client.New(s.URL)
+	t.Cleanup(func() {
+		// live feed streams never finish by themselves
+		eventbus.CloseAll(db)
+		err := app.ShutdownWithTimeout(shutdownTimeout)
+		if err != nil {
+			t.Errorf("irbankmock: failed to shut down the test server: %v", err)
+		}
+		<-served
+		dbutils.Close(db)
+	})
+	return s, nil
+}
+
+// Saman returns the client of the Saman bank routes in the default namespace.
+func (s *TestServer) Saman() *client.SamanClient {
+	return s.Client.Saman()
+}
+
+// Namespace creates a namespace and returns a client that selects it.
+func (s *TestServer) Namespace(name string) *client.Client {
+	s.t.Helper()
+	c, err := s.Client.CreateNamespace(context.Background(), name)
+	if err != nil {
+		s.t.Fatalf("irbankmock: failed to create namespace %s: %v", name, err)
+	}
+	return c
+}
+
+// SamanTerminal creates a terminal in the default namespace.
+func (s *TestServer) SamanTerminal(name string) *client.SamanTerminal {
+	s.t.Helper()
+	terminal, err := s.Saman().CreateTerminal(context.Background(), name)
+	if err != nil {
+		s.t.Fatalf("irbankmock: failed to create terminal %s: %v", name, err)
+	}
+	return terminal
+}
+
+// Pay finishes the payment page of a Saman token with the outcome, paying with
+// client.TestCard.
+func (s *TestServer) Pay(token string, outcome client.Outcome) *client.SamanPayment {
+	s.t.Helper()
+	payment, err := s.Saman().Pay(context.Background(), token, client.TestCard, outcome)
+	if err != nil {
+		s.t.Fatalf("irbankmock: failed to finish token %s with %s: %v", token, outcome, err)
+	}
+	return payment
+}
+
+// Seed applies fixtures, in the layout of the fixtures file, e.g.
+//
+//	banks:
+//	  saman:
+//	    terminals:
+//	      - id: 1001
+//	        name: my-shop
+func (s *TestServer) Seed(content string) {
+	s.t.Helper()
+	err := fixtures.Apply(s.db, []byte(content))
+	if err != nil {
+		s.t.Fatalf("irbankmock: failed to apply fixtures: %v", err)
+	}
+}
+
+// SeedFile applies a fixtures file. go test runs in the directory of the package, so
+// relative paths like testdata/fixtures.yaml work as expected.
+func (s *TestServer) SeedFile(path string) {
+	s.t.Helper()
+	err := fixtures.ApplyFile(s.db, path)
+	if err != nil {
+		s.t.Fatalf("irbankmock: failed to apply fixtures %s: %v", path, err)
+	}
+}
+
+// RunDueJobs runs the background jobs that are due, e.g. expiring the tokens whose
+// time is up, and waits for them.
+func (s *TestServer) RunDueJobs() {
+	scheduler.RunDue(context.Background(), s.db)
+}
+
+// Reset removes the data of all banks, terminals included unless keepTerminals is set.
+func (s *TestServer) Reset(keepTerminals bool) {
+	s.t.Helper()
+	err := snapshot.Reset(s.db, snapshot.ResetOptions{KeepTerminals: keepTerminals})
+	if err != nil {
+		s.t.Fatalf("irbankmock: failed to reset: %v", err)
+	}
+}
+
+// Freeze stops the global clock, which the namespaces without a clock of their own
+// follow, at its current time.
+func (s *TestServer) Freeze() {
+	s.t.Helper()
+	_, err := s.Client.FreezeClock(context.Background())
+	if err != nil {
+		s.t.Fatalf("irbankmock: failed to freeze the clock: %v", err)
+	}
+}
+
+// Advance moves the global clock forward by d. Unpaid tokens that become due are
+// expired right away, deadlines like the one of verify are checked against it.
+func (s *TestServer) Advance(d time.Duration) {
+	s.t.Helper()
+	_, err := s.Client.AdvanceClock(context.Background(), d)
+	if err != nil {
+		s.t.Fatalf("irbankmock: failed to advance the clock by %s: %v", d, err)
+	}
+}
+
+// SetTime moves the global clock to t.
+func (s *TestServer) SetTime(t time.Time) {
+	s.t.Helper()
+	_, err := s.Client.SetClock(context.Background(), t)
+	if err != nil {
+		s.t.Fatalf("irbankmock: failed to set the clock to %s: %v", t, err)
+	}
+}
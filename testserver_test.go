@@ -0,0 +1,92 @@
+package irbankmock_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/abramad-labs/irbankmock"
+	"github.com/abramad-labs/irbankmock/client"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestServersInOneProcess(t *testing.T) {
+	ctx := context.Background()
+	servers := []*irbankmock.TestServer{irbankmock.NewTestServer(t), irbankmock.NewTestServer(t)}
+
+	for i, ts := range servers {
+		status, body := get(t, ts.URL+"/readyz")
+		if status != http.StatusOK {
+			t.Errorf("server %d isn't ready: %d %s", i, status, body)
+		}
+
+		terminal := ts.SamanTerminal("shop")
+		token, err := ts.Saman().RequestToken(ctx, client.NewTokenRequest(terminal.ID, 120000, "order-1", "http://shop.test/callback"))
+		if err != nil {
+			t.Fatalf("server %d: token request failed: %v", i, err)
+		}
+		payment := ts.Pay(token, client.OutcomePaid)
+		verification, err := ts.Saman().Verify(ctx, terminal.ID, payment.CallbackData.RefNum)
+		if err != nil {
+			t.Fatalf("server %d: verify failed: %v", i, err)
+		}
+		if !verification.Success {
+			t.Fatalf("server %d: verify failed with %d: %s", i, verification.ResultCode, verification.ResultDescription)
+		}
+	}
+
+	for i, ts := range servers {
+		_, body := get(t, ts.URL+"/metrics")
+		issued := `irbankmock_saman_tokens_total{result="issued",terminal="1"} 1` + "\n"
+		if !strings.Contains(body, issued) {
+			t.Errorf("server %d doesn't count only its own token:\n%s", i, body)
+		}
+	}
+}
+
+func TestUnknownTerminalsShareASeries(t *testing.T) {
+	ctx := context.Background()
+	ts := irbankmock.NewTestServer(t)
+
+	verification, err := ts.Saman().Verify(ctx, 987654, "no-such-ref")
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if verification.ResultCode != -105 {
+		t.Fatalf("verify with a bogus terminal responded with %d, want -105", verification.ResultCode)
+	}
+	_, err = ts.Saman().Reverse(ctx, 987655, "no-such-ref")
+	if err != nil {
+		t.Fatalf("reverse failed: %v", err)
+	}
+
+	_, body := get(t, ts.URL+"/metrics")
+	for _, number := range []string{"987654", "987655"} {
+		if strings.Contains(body, `terminal="`+number+`"`) {
+			t.Errorf("the bogus terminal %s has a series of its own:\n%s", number, body)
+		}
+	}
+	for _, series := range []string{
+		`irbankmock_saman_verify_total{result_code="-105",terminal="unknown"} 1`,
+		`irbankmock_saman_reverse_total{result_code="-105",terminal="unknown"} 1`,
+	} {
+		if !strings.Contains(body, series+"\n") {
+			t.Errorf("the metrics have no %s:\n%s", series, body)
+		}
+	}
+}
@@ -3,6 +3,7 @@
 import {
     cancelToken,
     failToken,
+    samanPrefix,
     submitToken,
 } from "@/clients/banks/saman/saman";
 import { toaster } from "@/components/ui/toaster";
@@ -61,11 +62,12 @@ const BankInputForm = ({
 }) => {
     const searchParams = useSearchParams();
     const token = searchParams.get("token") ?? "";
+    const namespace = searchParams.get("namespace") ?? "";
     const { data, error, isLoading, mutate } = useSWR<
         SamanPublicTokenInfoResponse,
         ResponseError<SuccessErrorPair>
     >(
-        `/banks/saman/public/token/?token=${encodeURIComponent(token)}`,
+        `${samanPrefix(namespace)}/public/token/?token=${encodeURIComponent(token)}`,
         fetcherWithError
     );
 
@@ -95,7 +97,7 @@ const BankInputForm = ({
             cvv: parseInt(formData.cvv, 10),
             expiryMonth: parseInt(formData.expiryMonth, 10),
             expiryYear: parseInt(formData.expiryYear, 10),
-        })
+        }, namespace)
             .then((resp) => {
                 setFinalizeResponse(resp.data);
             })
@@ -114,7 +116,7 @@ const BankInputForm = ({
         setFormLoading(true);
         failToken({
             token: token,
-        })
+        }, namespace)
             .then((resp) => {
                 setFinalizeResponse(resp.data);
             })
@@ -133,7 +135,7 @@ const BankInputForm = ({
         setFormLoading(true);
         cancelToken({
             token: token,
-        })
+        }, namespace)
             .then((resp) => {
                 setFinalizeResponse(resp.data);
             })
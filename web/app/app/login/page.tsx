@@ -0,0 +1,101 @@
+"use client";
+
+import { checkAuth } from "@/clients/management/auth";
+import { toaster } from "@/components/ui/toaster";
+import {
+    basicAuthorization,
+    bearerAuthorization,
+    setAuthorization,
+} from "@/lib/auth";
+import { CommonError } from "@/types/errors";
+import {
+    Button,
+    Container,
+    Field,
+    Heading,
+    Input,
+    Stack,
+    Text,
+} from "@chakra-ui/react";
+import { AxiosError } from "axios";
+import { useSearchParams } from "next/navigation";
+import { Suspense, useState } from "react";
+
+const LoginForm = () => {
+    const searchParams = useSearchParams();
+    const next = searchParams.get("next") ?? "/";
+    const [submitting, setSubmitting] = useState(false);
+    const [token, setToken] = useState("");
+    const [username, setUsername] = useState("");
+    const [password, setPassword] = useState("");
+
+    const onSubmit = () => {
+        const authorization = token
+            ? bearerAuthorization(token)
+            : basicAuthorization(username, password);
+        setSubmitting(true);
+        checkAuth(authorization)
+            .then(() => {
+                setAuthorization(authorization);
+                // only local paths are accepted to avoid open redirects
+                window.location.href = next.startsWith("/") && !next.startsWith("//") ? next : "/";
+            })
+            .catch((err: AxiosError<CommonError>) => {
+                const error = err.response?.data?.error ?? err.message;
+                toaster.create({
+                    title: "Login",
+                    description: `Login failed: ${error}`,
+                    type: "error",
+                });
+            })
+            .finally(() => {
+                setSubmitting(false);
+            });
+    };
+
+    return (
+        <Stack gap={4} maxW="md">
+            <Text>
+                Management routes of this server require authentication. Enter either
+                the admin token or the admin username and password.
+            </Text>
+            <Field.Root>
+                <Field.Label>Token</Field.Label>
+                <Input
+                    type="password"
+                    value={token}
+                    onChange={(v) => setToken(v.target.value)}
+                />
+            </Field.Root>
+            <Field.Root disabled={token !== ""}>
+                <Field.Label>Username</Field.Label>
+                <Input
+                    value={username}
+                    onChange={(v) => setUsername(v.target.value)}
+                />
+            </Field.Root>
+            <Field.Root disabled={token !== ""}>
+                <Field.Label>Password</Field.Label>
+                <Input
+                    type="password"
+                    value={password}
+                    onChange={(v) => setPassword(v.target.value)}
+                />
+            </Field.Root>
+            <Button alignSelf="start" onClick={onSubmit} loading={submitting}>
+                Login
+            </Button>
+        </Stack>
+    );
+};
+
+export default function Login() {
+    return (
+        <Container p={10}>
+            <Heading mb={5}>Login</Heading>
+            <Suspense>
+                <LoginForm />
+            </Suspense>
+        </Container>
+    );
+}
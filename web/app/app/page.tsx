@@ -1,39 +1,79 @@
+"use client";
+
+import { fetcher } from "@/lib/fetcher";
+import { BankInfo } from "@/types/banks/registry";
 import {
+    Badge,
     Button,
     Card,
     Center,
     Container,
-    Grid,
     Group,
     Heading,
+    Image,
     Link as ChakraLink,
+    ProgressCircle,
     Stack,
+    Text,
 } from "@chakra-ui/react";
 import Link from "next/link";
+import useSWR from "swr";
+
+const BankCard = ({ bank }: { bank: BankInfo }) => (
+    <Card.Root>
+        <Card.Header>
+            <Group>
+                {bank.logo && <Image src={bank.logo} alt={bank.displayName} boxSize="40px" />}
+                <Stack gap={0}>
+                    <Heading>{bank.displayName}</Heading>
+                    <Text dir="rtl" color="fg.muted">{bank.persianName}</Text>
+                </Stack>
+            </Group>
+        </Card.Header>
+        <Card.Body>
+            <Group>
+                {bank.protocolVersions.map((v) => (
+                    <Badge key={v}>{v}</Badge>
+                ))}
+            </Group>
+        </Card.Body>
+        <Card.Footer>
+            {bank.managementPage && (
+                <Button asChild>
+                    <ChakraLink asChild>
+                        <Link href={bank.managementPage}>Manage</Link>
+                    </ChakraLink>
+                </Button>
+            )}
+            {bank.documentationUrl && (
+                <Button asChild variant="outline">
+                    <ChakraLink href={bank.documentationUrl} target="_blank">Documentation</ChakraLink>
+                </Button>
+            )}
+        </Card.Footer>
+    </Card.Root>
+);
 
 export default function Home() {
+    const { data, error, isLoading } = useSWR<BankInfo[]>("/banks", fetcher);
+
     return (
         <Container p={10}>
             <main>
                 <Center>
                     <Stack>
                         <Heading>IR Bank Mock</Heading>
+                        {error && <div>failed loading banks</div>}
+                        {isLoading && (
+                            <ProgressCircle.Root value={null} size="sm">
+                                <ProgressCircle.Circle>
+                                    <ProgressCircle.Track />
+                                    <ProgressCircle.Range />
+                                </ProgressCircle.Circle>
+                            </ProgressCircle.Root>
+                        )}
                         <Group>
-                            <Card.Root>
-                                <Card.Header>
-                                    <Heading>Saman</Heading>
-                                </Card.Header>
-                                <Card.Body>
-                                    Manage Saman Electronic Payment
-                                </Card.Body>
-                                <Card.Footer>
-                                    <Button asChild>
-                                        <ChakraLink asChild>
-                                            <Link href="/banks/saman/management">Manage</Link>
-                                        </ChakraLink>
-                                    </Button>
-                                </Card.Footer>
-                            </Card.Root>
+                            {data?.map((bank) => <BankCard key={bank.name} bank={bank} />)}
                         </Group>
                     </Stack>
                 </Center>
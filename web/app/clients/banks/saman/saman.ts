@@ -1,18 +1,22 @@
 import { BankSepCancelOrFailTokenRequest, BankSepSubmitTokenRequest, BankSepTokenFinalizeResponse, SamanTerminal, type CreateTerminalPayload } from "@/types/banks/saman/types";
-import axios from "axios";
+import { http } from "@/lib/http";
+
+// tokens of a namespace are only found under the prefix of their namespace
+export const samanPrefix = (namespace?: string) =>
+    namespace ? `/ns/${encodeURIComponent(namespace)}/banks/saman` : '/banks/saman'
 
 export const createTerminal = (payload: CreateTerminalPayload) => {
-    return axios.post<SamanTerminal>('/banks/saman/management/terminal', payload)
+    return http.post<SamanTerminal>('/banks/saman/management/terminal', payload)
 }
 
-export const submitToken = (payload: BankSepSubmitTokenRequest) => {
-    return axios.post<BankSepTokenFinalizeResponse>('/banks/saman/management/token/submit', payload)
+export const submitToken = (payload: BankSepSubmitTokenRequest, namespace?: string) => {
+    return http.post<BankSepTokenFinalizeResponse>(`${samanPrefix(namespace)}/management/token/submit`, payload)
 }
 
-export const failToken = (payload: BankSepCancelOrFailTokenRequest) => {
-    return axios.post<BankSepTokenFinalizeResponse>('/banks/saman/management/token/fail', payload)
+export const failToken = (payload: BankSepCancelOrFailTokenRequest, namespace?: string) => {
+    return http.post<BankSepTokenFinalizeResponse>(`${samanPrefix(namespace)}/management/token/fail`, payload)
 }
 
-export const cancelToken = (payload: BankSepCancelOrFailTokenRequest) => {
-    return axios.post<BankSepTokenFinalizeResponse>('/banks/saman/management/token/cancel', payload)
-}
\ No newline at end of file
+export const cancelToken = (payload: BankSepCancelOrFailTokenRequest, namespace?: string) => {
+    return http.post<BankSepTokenFinalizeResponse>(`${samanPrefix(namespace)}/management/token/cancel`, payload)
+}
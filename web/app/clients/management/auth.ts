@@ -0,0 +1,12 @@
+import axios from "axios";
+
+export type CheckAuthResponse = {
+    success: boolean;
+    authEnabled: boolean;
+};
+
+export const checkAuth = (authorization: string) => {
+    return axios.get<CheckAuthResponse>('/management/auth/check', {
+        headers: { Authorization: authorization },
+    })
+}
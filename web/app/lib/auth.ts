@@ -0,0 +1,36 @@
+const storageKey = "irbankmock:authorization";
+
+export const getAuthorization = (): string | null => {
+    if (typeof window === "undefined") {
+        return null;
+    }
+    return window.localStorage.getItem(storageKey);
+};
+
+export const setAuthorization = (authorization: string) => {
+    window.localStorage.setItem(storageKey, authorization);
+};
+
+export const clearAuthorization = () => {
+    window.localStorage.removeItem(storageKey);
+};
+
+export const bearerAuthorization = (token: string) => `Bearer ${token}`;
+
+export const basicAuthorization = (username: string, password: string) =>
+    `Basic ${btoa(`${username}:${password}`)}`;
+
+export const authHeaders = (): Record<string, string> => {
+    const authorization = getAuthorization();
+    return authorization ? { Authorization: authorization } : {};
+};
+
+export const isAuthFailure = (status?: number) => status === 401 || status === 403;
+
+export const redirectToLogin = () => {
+    if (window.location.pathname.startsWith("/login")) {
+        return;
+    }
+    const next = window.location.pathname + window.location.search;
+    window.location.href = `/login/?next=${encodeURIComponent(next)}`;
+};
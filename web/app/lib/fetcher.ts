@@ -1,4 +1,15 @@
-export const fetcher = (...args: Parameters<typeof fetch>) => fetch(...args).then(res => res.json())
+import { authHeaders, isAuthFailure, redirectToLogin } from "./auth"
+
+const fetchWithAuth = (input: Parameters<typeof fetch>[0], init?: Parameters<typeof fetch>[1]) =>
+    fetch(input, { ...init, headers: { ...authHeaders(), ...init?.headers } })
+    .then(res => {
+        if (isAuthFailure(res.status)) {
+            redirectToLogin()
+        }
+        return res
+    })
+
+export const fetcher = (...args: Parameters<typeof fetch>) => fetchWithAuth(...args).then(res => res.json())
 
 
 export class ResponseError<T = any> extends Error {
@@ -13,7 +24,7 @@ export class ResponseError<T = any> extends Error {
 }
 
 export const fetcherWithError = (...args: Parameters<typeof fetch>) =>
-    fetch(...args)
+    fetchWithAuth(...args)
     .then(async res => {
         if(!res.ok) {
             const err = new ResponseError("error occured in fetch", res)
@@ -21,4 +32,4 @@ export const fetcherWithError = (...args: Parameters<typeof fetch>) =>
             throw err
         }
         return res.json()
-    })
\ No newline at end of file
+    })
@@ -0,0 +1,16 @@
+import axios from "axios";
+import { authHeaders, isAuthFailure, redirectToLogin } from "./auth";
+
+export const http = axios.create();
+
+http.interceptors.request.use((config) => {
+    Object.entries(authHeaders()).forEach(([key, value]) => config.headers.set(key, value));
+    return config;
+});
+
+http.interceptors.response.use(undefined, (error) => {
+    if (isAuthFailure(error.response?.status)) {
+        redirectToLogin();
+    }
+    return Promise.reject(error);
+});
@@ -0,0 +1,20 @@
+export type BankEndpoint = {
+    name: string,
+    method: string,
+    path: string,
+    description?: string,
+    url: string,
+}
+
+export type BankInfo = {
+    name: string,
+    displayName: string,
+    persianName: string,
+    logo?: string,
+    protocolVersions: string[],
+    documentationUrl?: string,
+    managementPage?: string,
+    prefix: string,
+    endpoints: BankEndpoint[],
+    capabilities: string[],
+}
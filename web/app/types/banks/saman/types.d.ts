@@ -3,6 +3,7 @@ export type SamanTerminal = {
     name: string;
     username: string;
     password: string;
+    namespace: string;
 };
 
 export type SamanTerminalsResponse = {